@@ -0,0 +1,232 @@
+// Package async implements a reporter wrapper which decouples the
+// registry's flush cycle from slow or blocking reporters.
+package async
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/bsm/instruments"
+)
+
+var _ instruments.MetadataReporter = (*Reporter)(nil)
+
+// DefaultQueueSize is the default number of queued cycles.
+const DefaultQueueSize = 8
+
+// DropPolicy determines which cycles are dropped when the queue is full.
+type DropPolicy uint8
+
+const (
+	// DropOldest drops the oldest queued cycle to make room for the newest.
+	DropOldest DropPolicy = iota
+	// DropNewest drops the newest cycle and keeps the queued ones.
+	DropNewest
+)
+
+// Options configure the reporter.
+type Options struct {
+	// QueueSize is the maximum number of queued cycles.
+	// Default: DefaultQueueSize
+	QueueSize int
+
+	// Policy determines which cycles are dropped when the queue is full.
+	// Default: DropOldest
+	Policy DropPolicy
+
+	// OnError is called with errors returned by the wrapped reporter.
+	OnError func(error)
+}
+
+func (o *Options) norm() *Options {
+	var oo Options
+	if o != nil {
+		oo = *o
+	}
+	if oo.QueueSize < 1 {
+		oo.QueueSize = DefaultQueueSize
+	}
+	return &oo
+}
+
+// Reporter wraps another reporter. It copies the values of each cycle
+// into a bounded, in-memory queue and delivers them to the wrapped
+// reporter in a background goroutine.
+//
+// Please note that the wrapped reporter's Prep is called at the time of
+// delivery rather than at the beginning of the original cycle.
+type Reporter struct {
+	rep  instruments.Reporter
+	opt  *Options
+	curr *cycle
+
+	queue  chan *cycle
+	closed bool
+	done   chan struct{}
+	mutex  sync.Mutex
+
+	dropped, failed uint64
+}
+
+// New wraps a reporter and starts the background delivery.
+// You must call Close() to drain the queue and release resources.
+func New(rep instruments.Reporter, opt *Options) *Reporter {
+	opt = opt.norm()
+	r := &Reporter{
+		rep:   rep,
+		opt:   opt,
+		queue: make(chan *cycle, opt.QueueSize),
+		done:  make(chan struct{}),
+	}
+	go r.loop()
+	return r
+}
+
+// Dropped returns the number of dropped cycles.
+func (r *Reporter) Dropped() uint64 {
+	return atomic.LoadUint64(&r.dropped)
+}
+
+// Failed returns the number of cycles which failed to be delivered.
+func (r *Reporter) Failed() uint64 {
+	return atomic.LoadUint64(&r.failed)
+}
+
+// Prep implements instruments.Reporter
+func (r *Reporter) Prep() error {
+	r.curr = new(cycle)
+	return nil
+}
+
+// Discrete implements instruments.Reporter
+func (r *Reporter) Discrete(name string, tags []string, val float64) error {
+	r.curr.Append(entry{Name: name, Tags: copyTags(tags), Value: val})
+	return nil
+}
+
+// DiscreteWithMetadata implements instruments.MetadataReporter
+func (r *Reporter) DiscreteWithMetadata(name string, tags []string, meta instruments.Metadata, val float64) error {
+	r.curr.Append(entry{Name: name, Tags: copyTags(tags), Value: val, Meta: &meta})
+	return nil
+}
+
+// Sample implements instruments.Reporter
+func (r *Reporter) Sample(name string, tags []string, dist instruments.Distribution) error {
+	r.curr.Append(entry{Name: name, Tags: copyTags(tags), Dist: instruments.RetainDistribution(dist)})
+	return nil
+}
+
+// SampleWithMetadata implements instruments.MetadataReporter
+func (r *Reporter) SampleWithMetadata(name string, tags []string, meta instruments.Metadata, dist instruments.Distribution) error {
+	r.curr.Append(entry{Name: name, Tags: copyTags(tags), Dist: instruments.RetainDistribution(dist), Meta: &meta})
+	return nil
+}
+
+// Flush implements instruments.Reporter
+func (r *Reporter) Flush() error {
+	c := r.curr
+	r.curr = nil
+	if c == nil {
+		return nil
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.closed {
+		atomic.AddUint64(&r.dropped, 1)
+		return nil
+	}
+
+	select {
+	case r.queue <- c:
+		return nil
+	default:
+	}
+
+	if r.opt.Policy == DropNewest {
+		atomic.AddUint64(&r.dropped, 1)
+		return nil
+	}
+
+	select {
+	case <-r.queue:
+		atomic.AddUint64(&r.dropped, 1)
+	default:
+	}
+	r.queue <- c
+	return nil
+}
+
+// Close stops accepting new cycles, waits until all queued
+// cycles are delivered and releases resources.
+func (r *Reporter) Close() error {
+	r.mutex.Lock()
+	if !r.closed {
+		r.closed = true
+		close(r.queue)
+	}
+	r.mutex.Unlock()
+
+	<-r.done
+	return nil
+}
+
+func (r *Reporter) loop() {
+	defer close(r.done)
+
+	for c := range r.queue {
+		if err := c.Deliver(r.rep); err != nil {
+			atomic.AddUint64(&r.failed, 1)
+			if r.opt.OnError != nil {
+				r.opt.OnError(err)
+			}
+		}
+	}
+}
+
+// --------------------------------------------------------------------
+
+type entry struct {
+	Name  string
+	Tags  []string
+	Value float64
+	Dist  instruments.Distribution
+	Meta  *instruments.Metadata
+}
+
+type cycle struct {
+	entries []entry
+}
+
+func (c *cycle) Append(e entry) {
+	if c != nil {
+		c.entries = append(c.entries, e)
+	}
+}
+
+func (c *cycle) Deliver(rep instruments.Reporter) error {
+	if err := rep.Prep(); err != nil {
+		return err
+	}
+
+	for _, e := range c.entries {
+		var err error
+		if e.Dist != nil {
+			err = instruments.ReportSample(rep, e.Name, e.Tags, e.Meta, e.Dist)
+		} else {
+			err = instruments.ReportDiscrete(rep, e.Name, e.Tags, e.Meta, e.Value)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return rep.Flush()
+}
+
+func copyTags(tags []string) []string {
+	if len(tags) == 0 {
+		return nil
+	}
+	return append(make([]string, 0, len(tags)), tags...)
+}
@@ -0,0 +1,242 @@
+package async
+
+import (
+	"errors"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/bsm/ginkgo/v2"
+	. "github.com/bsm/gomega"
+	"github.com/bsm/instruments"
+)
+
+var _ = ginkgo.Describe("Reporter", func() {
+	var subject *Reporter
+	var target *mockReporter
+
+	cycle := func(vals ...float64) {
+		Expect(subject.Prep()).To(Succeed())
+		for _, v := range vals {
+			Expect(subject.Discrete("cnt", []string{"a"}, v)).To(Succeed())
+		}
+		Expect(subject.Flush()).To(Succeed())
+	}
+
+	ginkgo.BeforeEach(func() {
+		target = newMockReporter()
+	})
+
+	ginkgo.It("should deliver cycles", func() {
+		subject = New(target, nil)
+		target.Unblock()
+
+		cycle(1, 2)
+		Expect(subject.Prep()).To(Succeed())
+		Expect(subject.DiscreteWithMetadata("cnt", []string{"b"}, instruments.Metadata{Kind: instruments.KindCounter}, 3)).To(Succeed())
+		Expect(subject.Sample("tmr", nil, newDistribution(4, 6))).To(Succeed())
+		Expect(subject.Flush()).To(Succeed())
+		Expect(subject.Close()).To(Succeed())
+
+		Expect(target.Cycles()).To(Equal([][]string{
+			{"cnt|a=1", "cnt|a=2"},
+			{"cnt|b=3(counter)", "tmr=5"},
+		}))
+		Expect(subject.Dropped()).To(Equal(uint64(0)))
+	})
+
+	ginkgo.It("should copy distributions", func() {
+		subject = New(target, nil)
+		dist := &mutableDistribution{mean: 1}
+
+		Expect(subject.Prep()).To(Succeed())
+		Expect(subject.Sample("tmr", nil, dist)).To(Succeed())
+		Expect(subject.Flush()).To(Succeed())
+		dist.mean = 7
+
+		target.Unblock()
+		Expect(subject.Close()).To(Succeed())
+		Expect(target.Cycles()).To(Equal([][]string{{"tmr=1"}}))
+	})
+
+	ginkgo.It("should retain immutable snapshots", func() {
+		subject = New(target, nil)
+		sketch := instruments.NewSketch(0.01)
+		for i := 1; i <= 1000; i++ {
+			sketch.Update(float64(i))
+		}
+		dist := sketch.Snapshot()
+
+		Expect(subject.Prep()).To(Succeed())
+		Expect(subject.Sample("tmr", nil, dist)).To(Succeed())
+		Expect(subject.Flush()).To(Succeed())
+
+		target.Unblock()
+		Expect(subject.Close()).To(Succeed())
+		Expect(target.Dists()).To(HaveLen(1))
+		Expect(target.Dists()[0]).To(BeIdenticalTo(dist))
+	})
+
+	ginkgo.It("should drop oldest", func() {
+		subject = New(target, &Options{QueueSize: 2})
+
+		cycle(1) // picked up by the loop and blocked
+		Eventually(target.Pending).Should(Equal(1))
+
+		cycle(2)
+		cycle(3)
+		cycle(4)
+		cycle(5)
+		Expect(subject.Dropped()).To(Equal(uint64(2)))
+
+		target.Unblock()
+		Expect(subject.Close()).To(Succeed())
+		Expect(target.Cycles()).To(Equal([][]string{
+			{"cnt|a=1"},
+			{"cnt|a=4"},
+			{"cnt|a=5"},
+		}))
+
+		cycle(6)
+		Expect(subject.Dropped()).To(Equal(uint64(3)))
+	})
+
+	ginkgo.It("should drop newest", func() {
+		subject = New(target, &Options{QueueSize: 2, Policy: DropNewest})
+
+		cycle(1)
+		Eventually(target.Pending).Should(Equal(1))
+
+		cycle(2)
+		cycle(3)
+		cycle(4)
+		cycle(5)
+		Expect(subject.Dropped()).To(Equal(uint64(2)))
+
+		target.Unblock()
+		Expect(subject.Close()).To(Succeed())
+		Expect(target.Cycles()).To(Equal([][]string{
+			{"cnt|a=1"},
+			{"cnt|a=2"},
+			{"cnt|a=3"},
+		}))
+	})
+
+	ginkgo.It("should report errors", func() {
+		var errs []error
+		subject = New(target, &Options{OnError: func(err error) { errs = append(errs, err) }})
+		target.FailFlush = errors.New("doh!")
+		target.Unblock()
+
+		cycle(1)
+		cycle(2)
+		Expect(subject.Close()).To(Succeed())
+		Expect(subject.Failed()).To(Equal(uint64(2)))
+		Expect(errs).To(ConsistOf(MatchError("doh!"), MatchError("doh!")))
+	})
+})
+
+// --------------------------------------------------------------------
+
+func TestSuite(t *testing.T) {
+	RegisterFailHandler(ginkgo.Fail)
+	ginkgo.RunSpecs(t, "instruments/async")
+}
+
+func newDistribution(vals ...float64) instruments.Distribution {
+	r := instruments.NewReservoir()
+	for _, v := range vals {
+		r.Update(v)
+	}
+	return r.Snapshot()
+}
+
+type mutableDistribution struct {
+	instruments.Distribution
+	mean float64
+}
+
+func (d *mutableDistribution) Count() int        { return 1 }
+func (d *mutableDistribution) Min() float64      { return d.mean }
+func (d *mutableDistribution) Max() float64      { return d.mean }
+func (d *mutableDistribution) Sum() float64      { return d.mean }
+func (d *mutableDistribution) Mean() float64     { return d.mean }
+func (d *mutableDistribution) Variance() float64 { return 0 }
+func (d *mutableDistribution) NumBins() int      { return 0 }
+
+type mockReporter struct {
+	FailFlush error
+
+	current []string
+	cycles  [][]string
+	dists   []instruments.Distribution
+	pending int
+	unblock chan struct{}
+	mutex   sync.Mutex
+}
+
+func newMockReporter() *mockReporter {
+	return &mockReporter{unblock: make(chan struct{})}
+}
+
+func (m *mockReporter) Unblock() { close(m.unblock) }
+
+func (m *mockReporter) Pending() int {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.pending
+}
+
+func (m *mockReporter) Dists() []instruments.Distribution {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.dists
+}
+
+func (m *mockReporter) Cycles() [][]string {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.cycles
+}
+
+func (m *mockReporter) Prep() error {
+	m.mutex.Lock()
+	m.pending++
+	m.mutex.Unlock()
+
+	<-m.unblock
+	m.current = nil
+	return nil
+}
+
+func (m *mockReporter) Discrete(name string, tags []string, val float64) error {
+	m.current = append(m.current, instruments.MetricID(name, tags)+"="+formatFloat(val))
+	return nil
+}
+
+func (m *mockReporter) DiscreteWithMetadata(name string, tags []string, meta instruments.Metadata, val float64) error {
+	m.current = append(m.current, instruments.MetricID(name, tags)+"="+formatFloat(val)+"("+meta.Kind.String()+")")
+	return nil
+}
+
+func (m *mockReporter) Sample(name string, tags []string, dist instruments.Distribution) error {
+	m.dists = append(m.dists, dist)
+	m.current = append(m.current, instruments.MetricID(name, tags)+"="+formatFloat(dist.Mean()))
+	return nil
+}
+
+func (m *mockReporter) SampleWithMetadata(name string, tags []string, _ instruments.Metadata, dist instruments.Distribution) error {
+	return m.Sample(name, tags, dist)
+}
+
+func (m *mockReporter) Flush() error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.cycles = append(m.cycles, m.current)
+	return m.FailFlush
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
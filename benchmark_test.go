@@ -18,6 +18,25 @@ func BenchmarkCounter(b *testing.B) {
 	})
 }
 
+func BenchmarkStripedCounter(b *testing.B) {
+	c := instruments.NewStripedCounter()
+	benchmarkInstrument(b, func(i int) {
+		c.Update(float64(i))
+		if i%10 == 0 {
+			c.Snapshot()
+		}
+	})
+}
+
+func BenchmarkCounter_Update(b *testing.B) {
+	b.Run("Counter", func(b *testing.B) {
+		benchmarkParallel(b, instruments.NewCounter().Update)
+	})
+	b.Run("StripedCounter", func(b *testing.B) {
+		benchmarkParallel(b, instruments.NewStripedCounter().Update)
+	})
+}
+
 func BenchmarkRate(b *testing.B) {
 	r := instruments.NewRate()
 	benchmarkInstrument(b, func(i int) {
@@ -58,6 +77,25 @@ func BenchmarkReservoir(b *testing.B) {
 	})
 }
 
+func BenchmarkShardedReservoir(b *testing.B) {
+	r := instruments.NewShardedReservoir()
+	benchmarkInstrument(b, func(i int) {
+		r.Update(float64(i))
+		if i%10 == 0 {
+			instruments.ReleaseDistribution(r.Snapshot())
+		}
+	})
+}
+
+func BenchmarkReservoir_Update(b *testing.B) {
+	b.Run("Reservoir", func(b *testing.B) {
+		benchmarkParallel(b, instruments.NewReservoir().Update)
+	})
+	b.Run("ShardedReservoir", func(b *testing.B) {
+		benchmarkParallel(b, instruments.NewShardedReservoir().Update)
+	})
+}
+
 func BenchmarkTimer(b *testing.B) {
 	r := instruments.NewTimer()
 	s := time.Now()
@@ -69,6 +107,17 @@ func BenchmarkTimer(b *testing.B) {
 	})
 }
 
+func BenchmarkShardedTimer(b *testing.B) {
+	r := instruments.NewShardedTimer()
+	s := time.Now()
+	benchmarkInstrument(b, func(i int) {
+		r.Since(s)
+		if i%10 == 0 {
+			instruments.ReleaseDistribution(r.Snapshot())
+		}
+	})
+}
+
 func BenchmarkRegistry_Register(b *testing.B) {
 	r := instruments.New(time.Minute, "")
 	defer r.Close()
@@ -129,3 +178,16 @@ func benchmarkInstrument(b *testing.B, cb func(int)) {
 		})
 	})
 }
+
+// benchmarkParallel measures concurrent updates. Run with e.g. -cpu 1,4,16
+// to compare plain and sharded instruments, the latter only pay off
+// with several processors.
+func benchmarkParallel(b *testing.B, update func(float64)) {
+	b.Helper()
+
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			update(1)
+		}
+	})
+}
@@ -13,6 +13,29 @@ func (r *Registry) Counter(name string, tags []string) *Counter {
 
 func newCounter() interface{} { return NewCounter() }
 
+// StripedCounter fetches an instrument from the registry or creates a new one.
+//
+// If another instrument type is already registered with the same
+// name/tags, a blank one will be returned and an error
+// will be logged to the Errors() channel.
+func (r *Registry) StripedCounter(name string, tags []string) *StripedCounter {
+	return r.fetchStripedCounter(name, tags, newStripedCounter)
+}
+
+func newStripedCounter() interface{} { return NewStripedCounter() }
+
+// CumulativeCounter fetches an instrument from the registry or creates
+// a new one.
+//
+// If another instrument type is already registered with the same
+// name/tags, a blank one will be returned and an error
+// will be logged to the Errors() channel.
+func (r *Registry) CumulativeCounter(name string, tags []string) *CumulativeCounter {
+	return r.fetchCumulativeCounter(name, tags, newCumulativeCounter)
+}
+
+func newCumulativeCounter() interface{} { return NewCumulativeCounter() }
+
 // Rate fetches an instrument from the registry or creates a new one.
 //
 // If another instrument type is already registered with the same
@@ -66,6 +89,29 @@ func (r *Registry) Reservoir(name string, tags []string) *Reservoir {
 	return r.fetchReservoir(name, tags, factory)
 }
 
+// ReservoirSize fetches an instrument from the registry or creates a new one
+// with up to size bins.
+//
+// If another instrument type is already registered with the same
+// name/tags, a blank one will be returned and an error
+// will be logged to the Errors() channel.
+func (r *Registry) ReservoirSize(name string, tags []string, size int) *Reservoir {
+	factory := func() interface{} { return NewReservoirSize(size) }
+	return r.fetchReservoir(name, tags, factory)
+}
+
+// ShardedReservoir fetches an instrument from the registry or creates
+// a new one.
+//
+// If another instrument type is already registered with the same
+// name/tags, a blank one will be returned and an error
+// will be logged to the Errors() channel.
+func (r *Registry) ShardedReservoir(name string, tags []string) *ShardedReservoir {
+	return r.fetchShardedReservoir(name, tags, newShardedReservoir)
+}
+
+func newShardedReservoir() interface{} { return NewShardedReservoir() }
+
 // Gauge fetches an instrument from the registry or creates a new one.
 //
 // If another instrument type is already registered with the same
@@ -77,6 +123,13 @@ func (r *Registry) Gauge(name string, tags []string) *Gauge {
 
 func newGauge() interface{} { return NewGauge() }
 
+// GaugeFunc registers a gauge which calls fn at flush time. It replaces
+// any instrument registered with the same name/tags and remains
+// registered until it is unregistered.
+func (r *Registry) GaugeFunc(name string, tags []string, fn func() float64) {
+	r.Register(name, tags, GaugeFunc(fn))
+}
+
 // Timer fetches an instrument from the registry or creates a new one.
 //
 // If another instrument type is already registered with the same
@@ -87,6 +140,95 @@ func (r *Registry) Timer(name string, tags []string) *Timer {
 	return r.fetchTimer(name, tags, factory)
 }
 
+// TimerSize fetches an instrument from the registry or creates a new one
+// with up to size bins.
+//
+// If another instrument type is already registered with the same
+// name/tags, a blank one will be returned and an error
+// will be logged to the Errors() channel.
+func (r *Registry) TimerSize(name string, tags []string, size int) *Timer {
+	factory := func() interface{} { return NewTimerSize(size) }
+	return r.fetchTimer(name, tags, factory)
+}
+
+// TimerUnit fetches an instrument from the registry or creates a new one
+// with up to size bins, recording durations as multiples of unit.
+//
+// If another instrument type is already registered with the same
+// name/tags, a blank one will be returned and an error
+// will be logged to the Errors() channel.
+func (r *Registry) TimerUnit(name string, tags []string, size int, unit time.Duration) *Timer {
+	factory := func() interface{} { return NewTimerUnit(size, unit) }
+	return r.fetchTimer(name, tags, factory)
+}
+
+// ShardedTimer fetches an instrument from the registry or creates a new one.
+//
+// If another instrument type is already registered with the same
+// name/tags, a blank one will be returned and an error
+// will be logged to the Errors() channel.
+func (r *Registry) ShardedTimer(name string, tags []string) *ShardedTimer {
+	return r.fetchShardedTimer(name, tags, newShardedTimer)
+}
+
+func newShardedTimer() interface{} { return NewShardedTimer() }
+
+// Meter fetches an instrument from the registry or creates a new one.
+//
+// If another instrument type is already registered with the same
+// name/tags, a blank one will be returned and an error
+// will be logged to the Errors() channel.
+func (r *Registry) Meter(name string, tags []string) *Meter {
+	return r.fetchMeter(name, tags, newMeter)
+}
+
+func newMeter() interface{} { return NewMeter() }
+
+// Histogram fetches an instrument from the registry or creates a new one
+// with the given bucket boundaries.
+//
+// If another instrument type is already registered with the same
+// name/tags, a blank one will be returned and an error
+// will be logged to the Errors() channel.
+func (r *Registry) Histogram(name string, tags []string, bounds []float64) *Histogram {
+	factory := func() interface{} { return NewHistogram(bounds) }
+	return r.fetchHistogram(name, tags, factory)
+}
+
+// ExpHistogram fetches an instrument from the registry or creates a new one
+// with up to maxSize buckets per range.
+//
+// If another instrument type is already registered with the same
+// name/tags, a blank one will be returned and an error
+// will be logged to the Errors() channel.
+func (r *Registry) ExpHistogram(name string, tags []string, maxSize int) *ExpHistogram {
+	factory := func() interface{} { return NewExpHistogram(maxSize) }
+	return r.fetchExpHistogram(name, tags, factory)
+}
+
+// Sketch fetches an instrument from the registry or creates a new one
+// with DefaultSketchAccuracy.
+//
+// If another instrument type is already registered with the same
+// name/tags, a blank one will be returned and an error
+// will be logged to the Errors() channel.
+func (r *Registry) Sketch(name string, tags []string) *Sketch {
+	return r.fetchSketch(name, tags, newSketch)
+}
+
+func newSketch() interface{} { return NewSketch(DefaultSketchAccuracy) }
+
+// SketchAccuracy fetches an instrument from the registry or creates a new
+// one with a custom relative accuracy.
+//
+// If another instrument type is already registered with the same
+// name/tags, a blank one will be returned and an error
+// will be logged to the Errors() channel.
+func (r *Registry) SketchAccuracy(name string, tags []string, relativeAccuracy float64) *Sketch {
+	factory := func() interface{} { return NewSketch(relativeAccuracy) }
+	return r.fetchSketch(name, tags, factory)
+}
+
 // --------------------------------------------------------------------
 
 func (r *Registry) fetchCounter(name string, tags []string, factory func() interface{}) *Counter {
@@ -98,6 +240,24 @@ func (r *Registry) fetchCounter(name string, tags []string, factory func() inter
 	return factory().(*Counter)
 }
 
+func (r *Registry) fetchStripedCounter(name string, tags []string, factory func() interface{}) *StripedCounter {
+	v := r.Fetch(name, tags, factory)
+	if i, ok := v.(*StripedCounter); ok {
+		return i
+	}
+	r.handleFetchError("striped counter", name, tags, v)
+	return factory().(*StripedCounter)
+}
+
+func (r *Registry) fetchCumulativeCounter(name string, tags []string, factory func() interface{}) *CumulativeCounter {
+	v := r.Fetch(name, tags, factory)
+	if i, ok := v.(*CumulativeCounter); ok {
+		return i
+	}
+	r.handleFetchError("cumulative counter", name, tags, v)
+	return factory().(*CumulativeCounter)
+}
+
 func (r *Registry) fetchRate(name string, tags []string, factory func() interface{}) *Rate {
 	v := r.Fetch(name, tags, factory)
 	if i, ok := v.(*Rate); ok {
@@ -125,6 +285,15 @@ func (r *Registry) fetchReservoir(name string, tags []string, factory func() int
 	return factory().(*Reservoir)
 }
 
+func (r *Registry) fetchShardedReservoir(name string, tags []string, factory func() interface{}) *ShardedReservoir {
+	v := r.Fetch(name, tags, factory)
+	if i, ok := v.(*ShardedReservoir); ok {
+		return i
+	}
+	r.handleFetchError("sharded reservoir", name, tags, v)
+	return factory().(*ShardedReservoir)
+}
+
 func (r *Registry) fetchGauge(name string, tags []string, factory func() interface{}) *Gauge {
 	v := r.Fetch(name, tags, factory)
 	if i, ok := v.(*Gauge); ok {
@@ -143,6 +312,51 @@ func (r *Registry) fetchTimer(name string, tags []string, factory func() interfa
 	return factory().(*Timer)
 }
 
+func (r *Registry) fetchShardedTimer(name string, tags []string, factory func() interface{}) *ShardedTimer {
+	v := r.Fetch(name, tags, factory)
+	if i, ok := v.(*ShardedTimer); ok {
+		return i
+	}
+	r.handleFetchError("sharded timer", name, tags, v)
+	return factory().(*ShardedTimer)
+}
+
+func (r *Registry) fetchMeter(name string, tags []string, factory func() interface{}) *Meter {
+	v := r.Fetch(name, tags, factory)
+	if i, ok := v.(*Meter); ok {
+		return i
+	}
+	r.handleFetchError("meter", name, tags, v)
+	return factory().(*Meter)
+}
+
+func (r *Registry) fetchHistogram(name string, tags []string, factory func() interface{}) *Histogram {
+	v := r.Fetch(name, tags, factory)
+	if i, ok := v.(*Histogram); ok {
+		return i
+	}
+	r.handleFetchError("histogram", name, tags, v)
+	return factory().(*Histogram)
+}
+
+func (r *Registry) fetchExpHistogram(name string, tags []string, factory func() interface{}) *ExpHistogram {
+	v := r.Fetch(name, tags, factory)
+	if i, ok := v.(*ExpHistogram); ok {
+		return i
+	}
+	r.handleFetchError("exponential histogram", name, tags, v)
+	return factory().(*ExpHistogram)
+}
+
+func (r *Registry) fetchSketch(name string, tags []string, factory func() interface{}) *Sketch {
+	v := r.Fetch(name, tags, factory)
+	if i, ok := v.(*Sketch); ok {
+		return i
+	}
+	r.handleFetchError("sketch", name, tags, v)
+	return factory().(*Sketch)
+}
+
 func (r *Registry) handleFetchError(kind, name string, tags []string, inst interface{}) {
 	key := MetricID(name, tags)
 	r.logf("expected a %s at '%s', found a stored %T", kind, key, inst)
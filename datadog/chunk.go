@@ -0,0 +1,250 @@
+package datadog
+
+import (
+	"bytes"
+	"compress/zlib"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// Default payload limits, as documented by the v2 series API.
+const (
+	DefaultMaxPayloadSize    = 5000000
+	DefaultMaxCompressedSize = 512000
+	DefaultConcurrency       = 4
+)
+
+var (
+	chunkHeader = []byte(`{"series":[`)
+	chunkFooter = []byte(`]}`)
+)
+
+// ChunkError is returned when the request for a chunk of metrics has failed.
+type ChunkError struct {
+	// Offset is the index of the first metric in the chunk.
+	Offset int
+	// Count is the number of metrics in the chunk.
+	Count int
+	// Err is the original error.
+	Err error
+}
+
+// Error implements error.
+func (e *ChunkError) Error() string {
+	return fmt.Sprintf("datadog: metrics %d-%d: %s", e.Offset, e.Offset+e.Count-1, e.Err.Error())
+}
+
+// Unwrap returns the original error.
+func (e *ChunkError) Unwrap() error { return e.Err }
+
+// PostError is returned when one or more chunks of a
+// payload, which was split into several requests, have failed.
+type PostError []*ChunkError
+
+// Error implements error.
+func (e PostError) Error() string {
+	msgs := make([]string, 0, len(e))
+	for _, err := range e {
+		msgs = append(msgs, err.Error())
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Permanent reports whether all chunks were rejected permanently.
+func (e PostError) Permanent() bool {
+	for _, err := range e {
+		var apiErr *APIError
+		if !errors.As(err, &apiErr) || !apiErr.Permanent() {
+			return false
+		}
+	}
+	return len(e) != 0
+}
+
+// --------------------------------------------------------------------
+
+type chunk struct {
+	offset, count int
+	buf           *bytes.Buffer
+}
+
+// postChunked encodes n items into one or more payloads within the
+// configured size limits and sends them with bounded parallelism.
+func (c *Client) postChunked(ctx context.Context, url string, n int, item func(int) interface{}) error {
+	enc := &chunkEncoder{
+		maxSize:       c.MaxPayloadSize,
+		maxCompressed: c.MaxCompressedSize,
+		compress:      !c.DisableCompression,
+	}
+	if enc.maxSize < 1 {
+		enc.maxSize = DefaultMaxPayloadSize
+	}
+	if enc.maxCompressed < 1 {
+		enc.maxCompressed = DefaultMaxCompressedSize
+	}
+
+	chunks, err := enc.Encode(n, item)
+	defer func() {
+		for _, ch := range chunks {
+			bufferPool.Put(ch.buf)
+		}
+	}()
+	if err != nil {
+		return err
+	}
+
+	if len(chunks) == 1 {
+		return c.post(ctx, url, chunks[0].buf.Bytes())
+	}
+
+	concurrency := c.Concurrency
+	if concurrency < 1 {
+		concurrency = DefaultConcurrency
+	}
+
+	errs := make([]error, len(chunks))
+	sema := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i := range chunks {
+		sema <- struct{}{}
+		wg.Add(1)
+
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-sema }()
+
+			errs[i] = c.post(ctx, url, chunks[i].buf.Bytes())
+		}(i)
+	}
+	wg.Wait()
+
+	var perr PostError
+	for i, err := range errs {
+		if err != nil {
+			perr = append(perr, &ChunkError{Offset: chunks[i].offset, Count: chunks[i].count, Err: err})
+		}
+	}
+	if len(perr) == 0 {
+		return nil
+	}
+	return perr
+}
+
+// chunkEncoder encodes items into JSON payloads. It tracks the
+// uncompressed size of the current payload and, when compressing, an
+// upper bound of its compressed size.
+type chunkEncoder struct {
+	maxSize, maxCompressed int
+	compress               bool
+
+	chunks  []chunk
+	curr    *chunk
+	zlw     *zlib.Writer
+	size    int // uncompressed size
+	pending int // uncompressed bytes written since the last zlib flush
+}
+
+func (e *chunkEncoder) Encode(n int, item func(int) interface{}) ([]chunk, error) {
+	if e.zlw != nil {
+		defer zlibWriterPool.Put(e.zlw)
+	}
+
+	for i := 0; i < n; i++ {
+		data, err := json.Marshal(item(i))
+		if err != nil {
+			return e.chunks, err
+		}
+
+		if e.curr != nil && !e.fits(len(data)+1) {
+			if err := e.finish(); err != nil {
+				return e.chunks, err
+			}
+		}
+		if e.curr == nil {
+			if err := e.begin(i); err != nil {
+				return e.chunks, err
+			}
+		} else if err := e.write([]byte{','}); err != nil {
+			return e.chunks, err
+		}
+		if err := e.write(data); err != nil {
+			return e.chunks, err
+		}
+		e.curr.count++
+	}
+
+	if e.curr == nil {
+		if err := e.begin(0); err != nil {
+			return e.chunks, err
+		}
+	}
+	return e.chunks, e.finish()
+}
+
+// fits reports whether n more bytes fit into the current chunk.
+func (e *chunkEncoder) fits(n int) bool {
+	n += len(chunkFooter)
+	if e.size+n > e.maxSize {
+		return false
+	}
+	if !e.compress {
+		return true
+	}
+
+	if e.curr.buf.Len()+compressBound(e.pending+n) <= e.maxCompressed {
+		return true
+	}
+	if e.pending == 0 || e.zlw.Flush() != nil {
+		return false
+	}
+	e.pending = 0
+	return e.curr.buf.Len()+compressBound(n) <= e.maxCompressed
+}
+
+func (e *chunkEncoder) begin(offset int) error {
+	e.chunks = append(e.chunks, chunk{offset: offset, buf: fetchBuffer()})
+	e.curr = &e.chunks[len(e.chunks)-1]
+	e.size, e.pending = 0, 0
+
+	if e.compress {
+		if e.zlw == nil {
+			e.zlw = fetcZlibWriter(e.curr.buf)
+		} else {
+			e.zlw.Reset(e.curr.buf)
+		}
+	}
+	return e.write(chunkHeader)
+}
+
+func (e *chunkEncoder) write(p []byte) error {
+	e.size += len(p)
+	if !e.compress {
+		_, err := e.curr.buf.Write(p)
+		return err
+	}
+
+	e.pending += len(p)
+	_, err := e.zlw.Write(p)
+	return err
+}
+
+func (e *chunkEncoder) finish() error {
+	if err := e.write(chunkFooter); err != nil {
+		return err
+	}
+	e.curr = nil
+	if e.compress {
+		return e.zlw.Close()
+	}
+	return nil
+}
+
+// compressBound returns the maximum compressed size of n bytes,
+// as calculated by zlib, including the stream trailer.
+func compressBound(n int) int {
+	return n + n>>12 + n>>14 + n>>25 + 13
+}
@@ -3,37 +3,191 @@ package datadog
 import (
 	"bytes"
 	"compress/zlib"
-	"encoding/json"
-	"fmt"
+	"context"
 	"io"
+	"math/rand"
 	"net"
 	"net/http"
+	"strconv"
 	"sync"
 	"time"
 )
 
 // Metric represents a flushed metric
 type Metric struct {
+	Name     string           `json:"metric"`
+	Points   [][2]interface{} `json:"points"`
+	Host     string           `json:"host,omitempty"`
+	Tags     []string         `json:"tags,omitempty"`
+	Type     MetricType       `json:"type,omitempty"`
+	Interval int64            `json:"interval,omitempty"`
+	Unit     string           `json:"-"`
+}
+
+// DistributionMetric represents a flushed distribution. Each point is a
+// pair of a timestamp and a list of sampled values.
+type DistributionMetric struct {
 	Name   string           `json:"metric"`
 	Points [][2]interface{} `json:"points"`
 	Host   string           `json:"host,omitempty"`
 	Tags   []string         `json:"tags,omitempty"`
 }
 
+// MetricType is the datadog metric type.
+type MetricType string
+
+// Supported metric types.
+const (
+	TypeGauge MetricType = "gauge"
+	TypeCount MetricType = "count"
+	TypeRate  MetricType = "rate"
+)
+
 // DefaultURL is the default series URL the client sends metric data to
 const DefaultURL = "https://app.datadoghq.com/api/v1/series"
 
+// Datadog sites.
+const (
+	SiteUS1 = "datadoghq.com"
+	SiteUS3 = "us3.datadoghq.com"
+	SiteUS5 = "us5.datadoghq.com"
+	SiteEU  = "datadoghq.eu"
+)
+
+// APIVersion is the series API version.
+type APIVersion uint8
+
+// Supported API versions.
+const (
+	V1 APIVersion = iota + 1
+	V2
+)
+
+// APIError is returned for unsuccessful API responses.
+type APIError struct {
+	// StatusCode is the HTTP response status code.
+	StatusCode int
+	// Status is the HTTP response status.
+	Status string
+}
+
+// Error implements error.
+func (e *APIError) Error() string {
+	return "datadog: bad API response: " + e.Status
+}
+
+// Permanent reports whether the payload was rejected and must not be
+// resubmitted. Other errors, such as authentication failures, may be
+// resolved without changing the payload.
+func (e *APIError) Permanent() bool {
+	switch e.StatusCode {
+	case http.StatusBadRequest, http.StatusNotFound, http.StatusRequestEntityTooLarge, http.StatusUnprocessableEntity:
+		return true
+	}
+	return false
+}
+
 type Client struct {
 	apiKey string
 	client *http.Client
 
 	// URL is the series URL to push data to.
-	// Default: DefaultURL
+	// Default: derived from Site and Version
 	URL string
 
+	// DistributionURL is the URL to push distribution points to.
+	// Default: derived from Site
+	DistributionURL string
+
+	// Site is the datadog site to push data to.
+	// Default: SiteUS1
+	Site string
+
+	// Version is the series API version.
+	// Default: V1
+	Version APIVersion
+
 	// Disables zlib payload compression when
 	// POSTing data to the API.
 	DisableCompression bool
+
+	// Backoff configures retries of failed requests.
+	// Default: DefaultBackoff
+	Backoff Backoff
+
+	// MaxPayloadSize limits the uncompressed size of each request.
+	// Default: DefaultMaxPayloadSize
+	MaxPayloadSize int
+
+	// MaxCompressedSize limits the compressed size of each request.
+	// Default: DefaultMaxCompressedSize
+	MaxCompressedSize int
+
+	// Concurrency limits the number of parallel requests, when
+	// payloads are split.
+	// Default: DefaultConcurrency
+	Concurrency int
+}
+
+// Backoff configures exponential backoff with jitter. Requests are
+// retried on network errors, 429 and 5xx responses.
+type Backoff struct {
+	// InitialInterval is the delay before the first retry.
+	InitialInterval time.Duration
+	// MaxInterval caps the delay between retries.
+	MaxInterval time.Duration
+	// Multiplier is applied to the delay after each retry.
+	Multiplier float64
+	// Jitter randomises each delay by up to +/- the given fraction.
+	Jitter float64
+	// MaxElapsedTime stops retries once exceeded. A
+	// negative value disables retries altogether.
+	MaxElapsedTime time.Duration
+}
+
+// DefaultBackoff is the default backoff configuration.
+var DefaultBackoff = Backoff{
+	InitialInterval: 500 * time.Millisecond,
+	MaxInterval:     30 * time.Second,
+	Multiplier:      2,
+	Jitter:          0.5,
+	MaxElapsedTime:  2 * time.Minute,
+}
+
+func (b Backoff) norm() Backoff {
+	if b.InitialInterval <= 0 {
+		b.InitialInterval = DefaultBackoff.InitialInterval
+	}
+	if b.MaxInterval <= 0 {
+		b.MaxInterval = DefaultBackoff.MaxInterval
+	}
+	if b.Multiplier < 1 {
+		b.Multiplier = DefaultBackoff.Multiplier
+	}
+	if b.Jitter < 0 || b.Jitter > 1 {
+		b.Jitter = DefaultBackoff.Jitter
+	}
+	if b.MaxElapsedTime == 0 {
+		b.MaxElapsedTime = DefaultBackoff.MaxElapsedTime
+	}
+	return b
+}
+
+// delay returns the jittered delay for the given interval.
+func (b Backoff) delay(interval time.Duration) time.Duration {
+	if b.Jitter == 0 {
+		return interval
+	}
+	delta := b.Jitter * float64(interval)
+	return time.Duration(float64(interval) - delta + rand.Float64()*(2*delta+1))
+}
+
+// next returns the interval following the given one.
+func (b Backoff) next(interval time.Duration) time.Duration {
+	if next := time.Duration(float64(interval) * b.Multiplier); next < b.MaxInterval {
+		return next
+	}
+	return b.MaxInterval
 }
 
 // NewClient creates a new API client.
@@ -50,46 +204,89 @@ func NewClient(apiKey string) *Client {
 			TLSHandshakeTimeout:   10 * time.Second,
 			ExpectContinueTimeout: 1 * time.Second,
 		}},
-		apiKey: apiKey,
-		URL:    DefaultURL,
+		apiKey:  apiKey,
+		Site:    SiteUS1,
+		Version: V1,
+		Backoff: DefaultBackoff,
+
+		MaxPayloadSize:    DefaultMaxPayloadSize,
+		MaxCompressedSize: DefaultMaxCompressedSize,
+		Concurrency:       DefaultConcurrency,
 	}
 }
 
 // Post delivers a metrics snapshot to datadog
 func (c *Client) Post(metrics []Metric) error {
-	series := struct {
-		Series []Metric `json:"series,omitempty"`
-	}{Series: metrics}
+	return c.PostContext(context.Background(), metrics)
+}
 
-	buf := fetchBuffer()
-	defer bufferPool.Put(buf)
+// PostContext delivers a metrics snapshot to datadog. Failed requests
+// are retried as configured by Backoff until ctx is cancelled.
+//
+// Large snapshots are split into several requests, as limited by
+// MaxPayloadSize and MaxCompressedSize. In this case, a PostError is
+// returned if any of the requests fail.
+func (c *Client) PostContext(ctx context.Context, metrics []Metric) error {
+	if c.Version == V2 {
+		series := newSeriesV2(metrics)
+		return c.postChunked(ctx, c.seriesURL(), len(series), func(i int) interface{} { return &series[i] })
+	}
+	return c.postChunked(ctx, c.seriesURL(), len(metrics), func(i int) interface{} { return &metrics[i] })
+}
 
-	var dst io.Writer = buf
-	if !c.DisableCompression {
-		zlw := fetcZlibWriter(buf)
-		defer zlibWriterPool.Put(zlw)
-		defer zlw.Close()
+// PostDistributions delivers distribution points to datadog
+func (c *Client) PostDistributions(metrics []DistributionMetric) error {
+	return c.PostDistributionsContext(context.Background(), metrics)
+}
 
-		dst = zlw
-	}
+// PostDistributionsContext delivers distribution points to datadog.
+// Failed requests are retried as configured by Backoff until ctx is
+// cancelled.
+func (c *Client) PostDistributionsContext(ctx context.Context, metrics []DistributionMetric) error {
+	return c.postChunked(ctx, c.distributionURL(), len(metrics), func(i int) interface{} { return &metrics[i] })
+}
 
-	if err := json.NewEncoder(dst).Encode(&series); err != nil {
-		return err
-	}
-	if c, ok := dst.(io.Closer); ok {
-		if err := c.Close(); err != nil {
+func (c *Client) post(ctx context.Context, url string, data []byte) error {
+	backoff := c.Backoff.norm()
+	interval := backoff.InitialInterval
+	start := time.Now()
+
+	for {
+		wait, err := c.attempt(ctx, url, data)
+		if err == nil {
+			return nil
+		} else if wait < 0 || backoff.MaxElapsedTime < 0 {
+			return err
+		}
+
+		if wait == 0 {
+			wait = backoff.delay(interval)
+			interval = backoff.next(interval)
+		}
+		if time.Since(start)+wait > backoff.MaxElapsedTime {
 			return err
 		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
 	}
-	return c.post(buf.Bytes(), 0)
 }
 
-func (c *Client) post(data []byte, retries int) error {
-	req, err := http.NewRequest("POST", c.URL+"?api_key="+c.apiKey, bytes.NewReader(data))
+// attempt performs a single request. It returns a negative wait if the
+// request must not be retried, a positive one if the server requested
+// a specific delay.
+func (c *Client) attempt(ctx context.Context, url string, data []byte) (time.Duration, error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(data))
 	if err != nil {
-		return err
+		return -1, err
 	}
 
+	req.Header.Set("DD-API-KEY", c.apiKey)
 	req.Header.Set("Content-Type", "application/json")
 	if !c.DisableCompression {
 		req.Header.Set("Content-Encoding", "deflate")
@@ -97,18 +294,126 @@ func (c *Client) post(data []byte, retries int) error {
 
 	resp, err := c.client.Do(req)
 	if err != nil {
-		return err
+		if ctx.Err() != nil {
+			return -1, err
+		}
+		return 0, err
 	}
 	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	apiErr := &APIError{StatusCode: resp.StatusCode, Status: resp.Status}
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return 0, nil
+	case resp.StatusCode == http.StatusTooManyRequests:
+		return parseRetryAfter(resp.Header.Get("Retry-After")), apiErr
+	case resp.StatusCode >= 500:
+		return 0, apiErr
+	default:
+		return -1, apiErr
+	}
+}
+
+func (c *Client) site() string {
+	if c.Site == "" {
+		return SiteUS1
+	}
+	return c.Site
+}
+
+func (c *Client) seriesURL() string {
+	if c.URL != "" {
+		return c.URL
+	}
+
+	site := c.site()
+	if c.Version == V2 {
+		return "https://api." + site + "/api/v2/series"
+	} else if site == SiteUS1 {
+		return DefaultURL
+	}
+	return "https://api." + site + "/api/v1/series"
+}
+
+func (c *Client) distributionURL() string {
+	if c.DistributionURL != "" {
+		return c.DistributionURL
+	}
+	return "https://api." + c.site() + "/api/v1/distribution_points"
+}
+
+// parseRetryAfter parses a Retry-After header value,
+// either in seconds or as an HTTP date.
+func parseRetryAfter(s string) time.Duration {
+	if s == "" {
+		return 0
+	}
+	if secs, err := strconv.ParseInt(s, 10, 64); err == nil && secs > 0 {
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(s); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
+
+// --------------------------------------------------------------------
+
+type metricV2 struct {
+	Name      string       `json:"metric"`
+	Type      int          `json:"type"`
+	Interval  int64        `json:"interval,omitempty"`
+	Unit      string       `json:"unit,omitempty"`
+	Points    []pointV2    `json:"points"`
+	Resources []resourceV2 `json:"resources,omitempty"`
+	Tags      []string     `json:"tags,omitempty"`
+}
+
+type pointV2 struct {
+	Timestamp interface{} `json:"timestamp"`
+	Value     interface{} `json:"value"`
+}
+
+type resourceV2 struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+func newSeriesV2(metrics []Metric) []metricV2 {
+	series := make([]metricV2, 0, len(metrics))
+	for _, m := range metrics {
+		mv := metricV2{
+			Name:     m.Name,
+			Type:     m.Type.v2(),
+			Interval: m.Interval,
+			Unit:     m.Unit,
+			Points:   make([]pointV2, 0, len(m.Points)),
+			Tags:     m.Tags,
+		}
+		for _, p := range m.Points {
+			mv.Points = append(mv.Points, pointV2{Timestamp: p[0], Value: p[1]})
+		}
+		if m.Host != "" {
+			mv.Resources = []resourceV2{{Name: m.Host, Type: "host"}}
+		}
+		series = append(series, mv)
+	}
+	return series
+}
 
-	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
-		return nil
-	} else if retries <= 3 && resp.StatusCode >= 500 {
-		time.Sleep(time.Duration(retries+1) * 200 * time.Second)
-		return c.post(data, retries+1)
-	} else {
-		return fmt.Errorf("datadog: bad API response: %s", resp.Status)
+func (t MetricType) v2() int {
+	switch t {
+	case TypeCount:
+		return 1
+	case TypeRate:
+		return 2
+	case TypeGauge:
+		return 3
 	}
+	return 0
 }
 
 // --------------------------------------------------------------------
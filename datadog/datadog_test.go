@@ -3,11 +3,19 @@ package datadog
 import (
 	"bytes"
 	"compress/zlib"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"sort"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/bsm/ginkgo/v2"
 	. "github.com/bsm/gomega"
@@ -38,7 +46,8 @@ var _ = ginkgo.Describe("Client", func() {
 		})
 		Expect(err).NotTo(HaveOccurred())
 		Expect(last.Method).To(Equal("POST"))
-		Expect(last.URL.RawQuery).To(Equal("api_key=TEST_API_TOKEN"))
+		Expect(last.URL.RawQuery).To(BeEmpty())
+		Expect(last.Header.Get("DD-API-KEY")).To(Equal("TEST_API_TOKEN"))
 		Expect(last.Body.Bytes()).To(MatchJSON(`{
 			"series": [
 				{"metric":"m1", "points":[[1414141414,27]],  "tags":["a","b"]},
@@ -48,6 +57,234 @@ var _ = ginkgo.Describe("Client", func() {
 
 	})
 
+	ginkgo.It("should post v2 series", func() {
+		subject.Version = V2
+		err := subject.Post([]Metric{
+			{Name: "m1", Points: [][2]interface{}{{1414141414, 27}}, Tags: []string{"a"}, Host: "h1", Type: TypeCount, Interval: 60, Unit: "request"},
+			{Name: "m2", Points: [][2]interface{}{{1414141415, 0.8}}},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(last.Body.Bytes()).To(MatchJSON(`{
+			"series": [
+				{"metric":"m1", "type":1, "interval":60, "unit":"request", "points":[{"timestamp":1414141414,"value":27}], "resources":[{"name":"h1","type":"host"}], "tags":["a"]},
+				{"metric":"m2", "type":0, "points":[{"timestamp":1414141415,"value":0.8}]}
+			]
+		}`))
+	})
+
+	ginkgo.It("should derive URLs from site", func() {
+		subject.URL = ""
+		Expect(subject.seriesURL()).To(Equal(DefaultURL))
+
+		subject.Site = SiteEU
+		Expect(subject.seriesURL()).To(Equal("https://api.datadoghq.eu/api/v1/series"))
+
+		subject.Site = SiteUS5
+		subject.Version = V2
+		Expect(subject.seriesURL()).To(Equal("https://api.us5.datadoghq.com/api/v2/series"))
+		Expect(subject.distributionURL()).To(Equal("https://api.us5.datadoghq.com/api/v1/distribution_points"))
+	})
+
+	ginkgo.Describe("chunking", func() {
+		var chunked *httptest.Server
+		var bodies []mockChunk
+		var mu sync.Mutex
+
+		metrics := make([]Metric, 50)
+		for i := range metrics {
+			metrics[i] = Metric{Name: fmt.Sprintf("metric.%02d.%x", i, i*7919), Points: [][2]interface{}{{1414141414, i}}}
+		}
+
+		ginkgo.BeforeEach(func() {
+			bodies = nil
+			chunked = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				defer r.Body.Close()
+
+				compressed, _ := io.ReadAll(r.Body)
+				z, err := zlib.NewReader(bytes.NewReader(compressed))
+				if err != nil {
+					http.Error(w, err.Error(), http.StatusInternalServerError)
+					return
+				}
+				raw, _ := io.ReadAll(z)
+
+				var payload struct{ Series []Metric }
+				if err := json.Unmarshal(raw, &payload); err != nil {
+					http.Error(w, err.Error(), http.StatusInternalServerError)
+					return
+				}
+
+				mu.Lock()
+				bodies = append(bodies, mockChunk{Size: len(raw), CompressedSize: len(compressed), Series: payload.Series})
+				mu.Unlock()
+
+				for _, m := range payload.Series {
+					if m.Name == metrics[7].Name {
+						w.WriteHeader(http.StatusBadRequest)
+						return
+					}
+				}
+				w.WriteHeader(http.StatusAccepted)
+			}))
+			subject.URL = chunked.URL
+			subject.Concurrency = 2
+		})
+
+		ginkgo.AfterEach(func() {
+			chunked.Close()
+		})
+
+		names := func() []string {
+			mu.Lock()
+			defer mu.Unlock()
+
+			sort.Slice(bodies, func(i, j int) bool { return bodies[i].Series[0].Name < bodies[j].Series[0].Name })
+			var names []string
+			for _, b := range bodies {
+				for _, m := range b.Series {
+					names = append(names, m.Name)
+				}
+			}
+			return names
+		}
+
+		ginkgo.It("should split by uncompressed size", func() {
+			subject.MaxPayloadSize = 400
+			Expect(subject.Post(metrics[10:])).To(Succeed())
+
+			Expect(len(bodies)).To(BeNumerically(">", 5))
+			for _, b := range bodies {
+				Expect(b.Size).To(BeNumerically("<=", 400))
+			}
+			Expect(names()).To(HaveLen(40))
+			Expect(names()[0]).To(Equal(metrics[10].Name))
+			Expect(names()[39]).To(Equal(metrics[49].Name))
+		})
+
+		ginkgo.It("should split by compressed size", func() {
+			subject.MaxCompressedSize = 200
+			Expect(subject.Post(metrics[10:])).To(Succeed())
+
+			Expect(len(bodies)).To(BeNumerically(">", 1))
+			for _, b := range bodies {
+				Expect(b.CompressedSize).To(BeNumerically("<=", 200))
+			}
+			Expect(names()).To(HaveLen(40))
+		})
+
+		ginkgo.It("should report errors per chunk", func() {
+			subject.MaxPayloadSize = 400
+			err := subject.Post(metrics)
+
+			var perr PostError
+			Expect(errors.As(err, &perr)).To(BeTrue())
+			Expect(perr).To(HaveLen(1))
+			Expect(perr[0].Offset).To(BeNumerically("<=", 7))
+			Expect(perr[0].Offset + perr[0].Count).To(BeNumerically(">", 7))
+			Expect(perr[0].Err).To(MatchError("datadog: bad API response: 400 Bad Request"))
+			Expect(perr.Permanent()).To(BeTrue())
+			Expect(names()).To(HaveLen(50))
+		})
+	})
+
+	ginkgo.Describe("retries", func() {
+		var retrying *httptest.Server
+		var statuses []int
+		var attempts int32
+
+		ginkgo.BeforeEach(func() {
+			statuses, attempts = nil, 0
+			retrying = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				defer r.Body.Close()
+
+				status := http.StatusAccepted
+				if n := int(atomic.AddInt32(&attempts, 1)) - 1; n < len(statuses) {
+					status = statuses[n]
+				}
+
+				if status == http.StatusTooManyRequests {
+					w.Header().Set("Retry-After", "1")
+				}
+				w.WriteHeader(status)
+			}))
+
+			subject.URL = retrying.URL
+			subject.Backoff = Backoff{
+				InitialInterval: time.Millisecond,
+				MaxInterval:     5 * time.Millisecond,
+				MaxElapsedTime:  time.Second,
+			}
+		})
+
+		ginkgo.AfterEach(func() {
+			retrying.Close()
+		})
+
+		ginkgo.It("should retry server errors", func() {
+			statuses = []int{http.StatusServiceUnavailable, http.StatusBadGateway}
+			Expect(subject.Post([]Metric{{Name: "m1"}})).To(Succeed())
+			Expect(atomic.LoadInt32(&attempts)).To(Equal(int32(3)))
+		})
+
+		ginkgo.It("should not retry client errors", func() {
+			statuses = []int{http.StatusBadRequest}
+			err := subject.Post([]Metric{{Name: "m1"}})
+			Expect(err).To(MatchError("datadog: bad API response: 400 Bad Request"))
+			Expect(err).To(BeAssignableToTypeOf(&APIError{}))
+			Expect(err.(*APIError).Permanent()).To(BeTrue())
+			Expect(atomic.LoadInt32(&attempts)).To(Equal(int32(1)))
+		})
+
+		ginkgo.It("should not treat authentication errors as permanent", func() {
+			statuses = []int{http.StatusForbidden}
+			err := subject.Post([]Metric{{Name: "m1"}})
+			Expect(err).To(MatchError("datadog: bad API response: 403 Forbidden"))
+			Expect(err.(*APIError).Permanent()).To(BeFalse())
+			Expect(atomic.LoadInt32(&attempts)).To(Equal(int32(1)))
+		})
+
+		ginkgo.It("should honour Retry-After", func() {
+			statuses = []int{http.StatusTooManyRequests}
+			subject.Backoff.MaxElapsedTime = 2 * time.Second
+
+			start := time.Now()
+			Expect(subject.Post([]Metric{{Name: "m1"}})).To(Succeed())
+			Expect(atomic.LoadInt32(&attempts)).To(Equal(int32(2)))
+			Expect(time.Since(start)).To(BeNumerically(">=", time.Second))
+		})
+
+		ginkgo.It("should give up after max elapsed time", func() {
+			statuses = []int{http.StatusTooManyRequests}
+			subject.Backoff.MaxElapsedTime = 500 * time.Millisecond
+
+			err := subject.Post([]Metric{{Name: "m1"}})
+			Expect(err).To(MatchError("datadog: bad API response: 429 Too Many Requests"))
+			Expect(err.(*APIError).Permanent()).To(BeFalse())
+			Expect(atomic.LoadInt32(&attempts)).To(Equal(int32(1)))
+		})
+
+		ginkgo.It("should retry network errors", func() {
+			retrying.Close()
+			subject.Backoff.MaxElapsedTime = 50 * time.Millisecond
+
+			err := subject.Post([]Metric{{Name: "m1"}})
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("connection refused"))
+		})
+
+		ginkgo.It("should stop when cancelled", func() {
+			for i := 0; i < 1000; i++ {
+				statuses = append(statuses, http.StatusServiceUnavailable)
+			}
+			subject.Backoff.MaxElapsedTime = time.Minute
+
+			ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+			defer cancel()
+
+			Expect(subject.PostContext(ctx, []Metric{{Name: "m1"}})).To(MatchError(context.DeadlineExceeded))
+			Expect(atomic.LoadInt32(&attempts)).To(BeNumerically(">", 1))
+		})
+	})
 })
 
 // --------------------------------------------------------------------
@@ -61,9 +298,15 @@ func init() {
 	unixTime = func() int64 { return 1414141414 }
 }
 
+type mockChunk struct {
+	Size, CompressedSize int
+	Series               []Metric
+}
+
 type mockServerRequest struct {
 	Method string
 	URL    *url.URL
+	Header http.Header
 	Body   bytes.Buffer
 }
 
@@ -73,6 +316,7 @@ func newMockServer(last *mockServerRequest) *httptest.Server {
 
 		last.Method = r.Method
 		last.URL = r.URL
+		last.Header = r.Header
 		last.Body.Reset()
 
 		z, err := zlib.NewReader(r.Body)
@@ -1,16 +1,26 @@
 package datadog
 
 import (
+	"context"
+	"errors"
+	"math"
 	"os"
 	"time"
 
 	"github.com/bsm/instruments"
 )
 
-var _ instruments.Reporter = (*Reporter)(nil)
+var (
+	_ instruments.MetadataReporter = (*Reporter)(nil)
+	_ instruments.ContextFlusher   = (*Reporter)(nil)
+)
 
 var unixTime = func() int64 { return time.Now().Unix() }
 
+// DefaultMaxDistributionValues is the default maximum
+// number of values per distribution point.
+const DefaultMaxDistributionValues = 1000
+
 // Reporter implements instruments.Reporter and simply logs metrics
 type Reporter struct {
 	// Client is a customisable reporter client
@@ -20,9 +30,45 @@ type Reporter struct {
 	// Default: set via os.Hostname()
 	Hostname string
 
+	// Stats configure the statistics emitted for each distribution.
+	// Default: DefaultStats
+	Stats Stats
+
+	// Overrides configure statistics per metric name. The first
+	// matching override is applied instead of Stats.
+	Overrides []Override
+
+	// Suffix returns the name suffix for each statistic.
+	// Default: DefaultSuffix
+	Suffix SuffixFunc
+
+	// Distributions enables submission of samples as distribution points
+	// instead of statistics. Datadog can then aggregate percentiles across
+	// hosts and tags server-side. Points are reconstructed from the
+	// histogram bins of each distribution.
+	Distributions bool
+
+	// MaxDistributionValues limits the number of values submitted per
+	// distribution point. Distributions with more observations are
+	// submitted as several points with the same timestamp.
+	// Default: DefaultMaxDistributionValues
+	MaxDistributionValues int
+
+	// Interval is the registry's flush interval, submitted along with
+	// count and rate metrics.
+	// Default: measured as the time between consecutive cycles
+	Interval time.Duration
+
 	metrics   []Metric
+	dists     []DistributionMetric
 	timestamp int64
-	refs      map[string]int8
+	interval  int64
+	refs      map[string]*metricRef
+}
+
+type metricRef struct {
+	ttl  int8
+	kind MetricType
 }
 
 // New creates a new reporter.
@@ -32,56 +78,257 @@ func New(apiKey string) *Reporter {
 	return &Reporter{
 		Client:   NewClient(apiKey),
 		Hostname: hostname,
-		refs:     make(map[string]int8),
+		Stats:    DefaultStats,
+		Suffix:   DefaultSuffix,
+		refs:     make(map[string]*metricRef),
 	}
 }
 
 // Prepare implements instruments.Reporter
 func (r *Reporter) Prep() error {
-	r.timestamp = unixTime()
+	now := unixTime()
+	if r.Interval > 0 {
+		r.interval = int64(r.Interval / time.Second)
+	} else if r.timestamp != 0 {
+		r.interval = now - r.timestamp
+	}
+	r.timestamp = now
 	return nil
 }
 
 // Metric appends a new metric to the reporter. The value v must be either an
 // int64 or float64, otherwise an error is returned
 func (r *Reporter) Metric(name string, tags []string, v float32) {
-	r.metrics = append(r.metrics, Metric{
+	r.metric(name, tags, "", "", v)
+}
+
+func (r *Reporter) metric(name string, tags []string, kind MetricType, unit string, v float32) {
+	m := Metric{
 		Name:   name,
 		Points: [][2]interface{}{[2]interface{}{r.timestamp, v}},
 		Tags:   tags,
 		Host:   r.Hostname,
-	})
+		Type:   kind,
+		Unit:   unit,
+	}
+	if kind == TypeCount || kind == TypeRate {
+		m.Interval = r.interval
+	}
+	r.metrics = append(r.metrics, m)
 }
 
 // Discrete implements instruments.Reporter
 func (r *Reporter) Discrete(name string, tags []string, val float64) error {
+	return r.discrete(name, tags, "", "", val)
+}
+
+// DiscreteWithMetadata implements instruments.MetadataReporter.
+// Cumulative values are submitted as counts of their delta.
+func (r *Reporter) DiscreteWithMetadata(name string, tags []string, meta instruments.Metadata, val float64) error {
+	if meta.Kind == instruments.KindCumulative {
+		val = meta.Delta
+	}
+	return r.discrete(name, tags, metricType(meta.Kind), metricUnit(meta.Unit), val)
+}
+
+// SampleWithMetadata implements instruments.MetadataReporter
+func (r *Reporter) SampleWithMetadata(name string, tags []string, meta instruments.Metadata, dist instruments.Distribution) error {
+	return r.sample(name, tags, metricUnit(meta.Unit), dist)
+}
+
+func (r *Reporter) discrete(name string, tags []string, kind MetricType, unit string, val float64) error {
 	metricID := instruments.MetricID(name, tags)
-	r.refs[metricID] = 2
-	r.Metric(name, tags, float32(val))
+	r.refs[metricID] = &metricRef{ttl: 2, kind: kind}
+	r.metric(name, tags, kind, unit, float32(val))
 	return nil
 }
 
 // Sample implements instruments.Reporter
 func (r *Reporter) Sample(name string, tags []string, dist instruments.Distribution) error {
-	r.Metric(name+".p95", tags, float32(dist.Quantile(0.95)))
-	r.Metric(name+".p99", tags, float32(dist.Quantile(0.99)))
+	return r.sample(name, tags, "", dist)
+}
+
+func (r *Reporter) sample(name string, tags []string, unit string, dist instruments.Distribution) error {
+	if r.Distributions && dist.NumBins() != 0 {
+		// submit large distributions as several metrics, these
+		// can then be split across requests
+		values, limit := distributionValues(dist), r.maxDistributionValues()
+		for len(values) != 0 {
+			n := limit
+			if n > len(values) {
+				n = len(values)
+			}
+			r.dists = append(r.dists, DistributionMetric{
+				Name:   name,
+				Points: [][2]interface{}{{r.timestamp, values[:n:n]}},
+				Tags:   tags,
+				Host:   r.Hostname,
+			})
+			values = values[n:]
+		}
+		return nil
+	}
+
+	suffix := r.Suffix
+	if suffix == nil {
+		suffix = DefaultSuffix
+	}
+
+	// statistics may be undefined, e.g. the variance of a single
+	// observation, and cannot be encoded as JSON
+	stats := r.statsFor(name)
+	for a := AggregateMin; a <= AggregateVariance; a <<= 1 {
+		if stats.Aggregates&a != 0 {
+			if v := a.value(dist); isFinite(v) {
+				r.metric(name+suffix(Statistic{Aggregate: a}), tags, "", a.unit(unit), float32(v))
+			}
+		}
+	}
+	for _, q := range stats.Quantiles {
+		if v := dist.Quantile(q); isFinite(v) {
+			r.metric(name+suffix(Statistic{Quantile: q}), tags, "", unit, float32(v))
+		}
+	}
 	return nil
 }
 
 // Flush implements instruments.Reporter
 func (r *Reporter) Flush() error {
-	for metricID := range r.refs {
-		if r.refs[metricID]--; r.refs[metricID] < 1 {
+	return r.FlushContext(context.Background())
+}
+
+// FlushContext implements instruments.ContextFlusher. Series and
+// distributions are submitted independently. Metrics are retained and
+// resubmitted with the next cycle if a submission fails, unless they
+// were rejected permanently. When a submission was split into several
+// requests, only the metrics of the failed requests are retained.
+func (r *Reporter) FlushContext(ctx context.Context) error {
+	for metricID, ref := range r.refs {
+		if ref.ttl--; ref.ttl < 1 {
 			name, tags := instruments.SplitMetricID(metricID)
-			r.Metric(name, tags, 0)
+			r.metric(name, tags, ref.kind, "", 0)
 			delete(r.refs, metricID)
 		}
 	}
+
+	var err error
 	if len(r.metrics) != 0 {
-		if err := r.Client.Post(r.metrics); err != nil {
-			return err
+		err = r.Client.PostContext(ctx, r.metrics)
+		r.metrics = r.metrics[:retain(err, len(r.metrics), func(dst, src int) {
+			r.metrics[dst] = r.metrics[src]
+		})]
+	}
+	if len(r.dists) != 0 {
+		derr := r.Client.PostDistributionsContext(ctx, r.dists)
+		r.dists = r.dists[:retain(derr, len(r.dists), func(dst, src int) {
+			r.dists[dst] = r.dists[src]
+		})]
+		if err == nil {
+			err = derr
 		}
-		r.metrics = r.metrics[:0]
 	}
-	return nil
+	return err
+}
+
+func (r *Reporter) maxDistributionValues() int {
+	if r.MaxDistributionValues < 1 {
+		return DefaultMaxDistributionValues
+	}
+	return r.MaxDistributionValues
+}
+
+func (r *Reporter) statsFor(name string) Stats {
+	for i := range r.Overrides {
+		if o := &r.Overrides[i]; o.match(name) {
+			return o.Stats
+		}
+	}
+	return r.Stats
+}
+
+func metricType(kind instruments.Kind) MetricType {
+	switch kind {
+	case instruments.KindCounter, instruments.KindCumulative:
+		return TypeCount
+	case instruments.KindRate:
+		return TypeRate
+	}
+	return TypeGauge
+}
+
+// metricUnit converts UCUM unit symbols into datadog unit names.
+// Unknown units are passed through.
+func metricUnit(unit string) string {
+	switch unit {
+	case "ns":
+		return "nanosecond"
+	case "us":
+		return "microsecond"
+	case "ms":
+		return "millisecond"
+	case "s":
+		return "second"
+	case "min":
+		return "minute"
+	case "h":
+		return "hour"
+	case "By":
+		return "byte"
+	case "%":
+		return "percent"
+	}
+	return unit
+}
+
+func isFinite(v float64) bool {
+	return !math.IsNaN(v) && !math.IsInf(v, 0)
+}
+
+// isPermanent reports whether err is a permanent rejection,
+// which would fail again when resubmitted.
+func isPermanent(err error) bool {
+	var p interface{ Permanent() bool }
+	return errors.As(err, &p) && p.Permanent()
+}
+
+// retain moves the n items which failed with err and should be
+// resubmitted to the front and returns their number.
+func retain(err error, n int, move func(dst, src int)) int {
+	if err == nil || isPermanent(err) {
+		return 0
+	}
+
+	var perr PostError
+	if !errors.As(err, &perr) {
+		return n
+	}
+
+	// chunks are ordered by offset, items are only moved forward
+	pos := 0
+	for _, cerr := range perr {
+		if isPermanent(cerr) {
+			continue
+		}
+		for i := cerr.Offset; i < cerr.Offset+cerr.Count; i++ {
+			move(pos, i)
+			pos++
+		}
+	}
+	return pos
+}
+
+// distributionValues expands histogram bins into a list of values,
+// one per observation.
+func distributionValues(dist instruments.Distribution) []float64 {
+	// round cumulative weights to avoid accumulating rounding errors
+	var cum float64
+	values := make([]float64, 0, dist.Count())
+	for i := 0; i < dist.NumBins(); i++ {
+		v, w := dist.Bin(i)
+		cum += math.Abs(w)
+		for n := int(math.Round(cum)) - len(values); n > 0; n-- {
+			values = append(values, v)
+		}
+	}
+	return values
 }
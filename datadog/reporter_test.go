@@ -1,7 +1,13 @@
 package datadog
 
 import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
 	"net/http/httptest"
+	"strconv"
+	"time"
 
 	"github.com/bsm/ginkgo/v2"
 	. "github.com/bsm/gomega"
@@ -97,10 +103,279 @@ var _ = ginkgo.Describe("Reporter", func() {
 		}`))
 	})
 
+	ginkgo.It("should submit metric types", func() {
+		counter := instruments.Metadata{Kind: instruments.KindCounter}
+		rate := instruments.Metadata{Kind: instruments.KindRate}
+		gauge := instruments.Metadata{Kind: instruments.KindGauge}
+		subject.Interval = time.Minute
+
+		Expect(subject.Prep()).To(Succeed())
+		Expect(subject.DiscreteWithMetadata("cnt", []string{"a"}, counter, 3)).To(Succeed())
+		Expect(subject.DiscreteWithMetadata("rate", nil, rate, 1.5)).To(Succeed())
+		Expect(subject.DiscreteWithMetadata("gauge", nil, gauge, 7)).To(Succeed())
+		Expect(subject.Flush()).To(Succeed())
+
+		Expect(last.Body.Bytes()).To(MatchJSON(`{
+			"series":[
+				{"metric":"cnt","points":[[1414141414,3]],"tags":["a"],"host":"test.host","type":"count","interval":60},
+				{"metric":"rate","points":[[1414141414,1.5]],"host":"test.host","type":"rate","interval":60},
+				{"metric":"gauge","points":[[1414141414,7]],"host":"test.host","type":"gauge"}
+			]
+		}`))
+
+		subject.Client.Version = V2
+		Expect(subject.Prep()).To(Succeed())
+		Expect(subject.DiscreteWithMetadata("rate", nil, rate, 2.5)).To(Succeed())
+		Expect(subject.DiscreteWithMetadata("gauge", nil, gauge, 8)).To(Succeed())
+		Expect(subject.Flush()).To(Succeed())
+
+		Expect(last.Body.Bytes()).To(MatchJSON(`{
+			"series":[
+				{"metric":"rate","type":2,"interval":60,"points":[{"timestamp":1414141414,"value":2.5}],"resources":[{"name":"test.host","type":"host"}]},
+				{"metric":"gauge","type":3,"points":[{"timestamp":1414141414,"value":8}],"resources":[{"name":"test.host","type":"host"}]},
+				{"metric":"cnt","type":1,"interval":60,"points":[{"timestamp":1414141414,"value":0}],"resources":[{"name":"test.host","type":"host"}],"tags":["a"]}
+			]
+		}`))
+	})
+
+	ginkgo.It("should submit cumulative deltas", func() {
+		total := instruments.Metadata{Kind: instruments.KindCumulative, StartTime: time.Unix(1414141000, 0), Delta: 4}
+		subject.Interval = time.Minute
+
+		Expect(subject.Prep()).To(Succeed())
+		Expect(subject.DiscreteWithMetadata("total", nil, total, 25)).To(Succeed())
+		Expect(subject.Flush()).To(Succeed())
+
+		Expect(last.Body.Bytes()).To(MatchJSON(`{
+			"series":[
+				{"metric":"total","points":[[1414141414,4]],"host":"test.host","type":"count","interval":60}
+			]
+		}`))
+	})
+
+	ginkgo.It("should submit units", func() {
+		timer := instruments.Metadata{Kind: instruments.KindDistribution, Unit: "us"}
+		subject.Client.Version = V2
+		subject.Stats = Stats{Quantiles: []float64{0.5}, Aggregates: AggregateMax | AggregateCount}
+
+		Expect(subject.Prep()).To(Succeed())
+		Expect(subject.SampleWithMetadata("tmr", nil, timer, mockDistribution{})).To(Succeed())
+		Expect(subject.DiscreteWithMetadata("mem", nil, instruments.Metadata{Unit: "By"}, 5)).To(Succeed())
+		Expect(subject.Flush()).To(Succeed())
+
+		Expect(last.Body.Bytes()).To(MatchJSON(`{
+			"series":[
+				{"metric":"tmr.max","type":0,"unit":"microsecond","points":[{"timestamp":1414141414,"value":200}],"resources":[{"name":"test.host","type":"host"}]},
+				{"metric":"tmr.count","type":0,"points":[{"timestamp":1414141414,"value":3}],"resources":[{"name":"test.host","type":"host"}]},
+				{"metric":"tmr.p50","type":0,"unit":"microsecond","points":[{"timestamp":1414141414,"value":100.1}],"resources":[{"name":"test.host","type":"host"}]},
+				{"metric":"mem","type":3,"unit":"byte","points":[{"timestamp":1414141414,"value":5}],"resources":[{"name":"test.host","type":"host"}]}
+			]
+		}`))
+	})
+
+	ginkgo.It("should submit distributions", func() {
+		subject.Distributions = true
+		subject.Client.DistributionURL = server.URL + "/api/v1/distribution_points"
+
+		Expect(subject.Prep()).To(Succeed())
+		Expect(subject.Sample("tmr", []string{"a"}, mockDistribution{})).To(Succeed())
+		Expect(subject.Flush()).To(Succeed())
+
+		Expect(last.URL.Path).To(Equal("/api/v1/distribution_points"))
+		Expect(last.Body.Bytes()).To(MatchJSON(`{
+			"series":[
+				{"metric":"tmr","points":[[1414141414,[0.1,99.9,99.9]]],"tags":["a"],"host":"test.host"}
+			]
+		}`))
+	})
+
+	ginkgo.It("should split large distributions", func() {
+		subject.Distributions = true
+		subject.MaxDistributionValues = 4
+		subject.Client.DistributionURL = server.URL + "/api/v1/distribution_points"
+
+		h := instruments.NewHistogram([]float64{10})
+		for i := 0; i < 5; i++ {
+			h.Update(1)
+		}
+		for i := 0; i < 3; i++ {
+			h.Update(20)
+		}
+
+		Expect(subject.Prep()).To(Succeed())
+		Expect(subject.Sample("tmr", nil, h.Snapshot())).To(Succeed())
+		Expect(subject.Flush()).To(Succeed())
+
+		Expect(last.Body.Bytes()).To(MatchJSON(`{
+			"series":[
+				{"metric":"tmr","points":[[1414141414,[5.5,5.5,5.5,5.5]]],"host":"test.host"},
+				{"metric":"tmr","points":[[1414141414,[5.5,15,15,15]]],"host":"test.host"}
+			]
+		}`))
+	})
+
+	ginkgo.It("should drop permanently rejected distributions", func() {
+		var status, requests int
+		rejecting := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			requests++
+			w.WriteHeader(status)
+		}))
+		defer rejecting.Close()
+
+		subject.Distributions = true
+		subject.Client.DistributionURL = rejecting.URL
+		subject.Client.Backoff.MaxElapsedTime = -1
+
+		status = http.StatusServiceUnavailable
+		Expect(subject.Prep()).To(Succeed())
+		Expect(subject.Sample("tmr", nil, mockDistribution{})).To(Succeed())
+		Expect(subject.Flush()).To(MatchError("datadog: bad API response: 503 Service Unavailable"))
+		Expect(subject.dists).To(HaveLen(1))
+
+		status = http.StatusBadRequest
+		Expect(subject.Flush()).To(MatchError("datadog: bad API response: 400 Bad Request"))
+		Expect(subject.dists).To(BeEmpty())
+		Expect(subject.Flush()).To(Succeed())
+		Expect(requests).To(Equal(2))
+	})
+
+	ginkgo.It("should submit distributions when series fail", func() {
+		var requests int
+		failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			requests++
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}))
+		defer failing.Close()
+
+		subject.Distributions = true
+		subject.Client.URL = failing.URL
+		subject.Client.DistributionURL = server.URL + "/api/v1/distribution_points"
+		subject.Client.Backoff.MaxElapsedTime = -1
+
+		Expect(subject.Prep()).To(Succeed())
+		Expect(subject.Discrete("cnt", nil, 1)).To(Succeed())
+		Expect(subject.Sample("tmr", nil, mockDistribution{})).To(Succeed())
+		Expect(subject.Flush()).To(MatchError("datadog: bad API response: 503 Service Unavailable"))
+		Expect(requests).To(Equal(1))
+		Expect(subject.metrics).To(HaveLen(1))
+		Expect(subject.dists).To(BeEmpty())
+		Expect(last.URL.Path).To(Equal("/api/v1/distribution_points"))
+	})
+
+	ginkgo.It("should only retain metrics of failed chunks", func() {
+		partial := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := io.ReadAll(r.Body)
+			switch {
+			case bytes.Contains(body, []byte(`"m07"`)):
+				w.WriteHeader(http.StatusServiceUnavailable)
+			case bytes.Contains(body, []byte(`"m15"`)):
+				w.WriteHeader(http.StatusBadRequest)
+			default:
+				w.WriteHeader(http.StatusAccepted)
+			}
+		}))
+		defer partial.Close()
+
+		subject.Client.URL = partial.URL
+		subject.Client.MaxPayloadSize = 300
+		subject.Client.DisableCompression = true
+		subject.Client.Backoff.MaxElapsedTime = -1
+
+		Expect(subject.Prep()).To(Succeed())
+		for i := 0; i < 20; i++ {
+			Expect(subject.Discrete(fmt.Sprintf("m%02d", i), nil, float64(i))).To(Succeed())
+		}
+		Expect(subject.Flush()).To(HaveOccurred())
+
+		var names []string
+		for _, m := range subject.metrics {
+			names = append(names, m.Name)
+		}
+		Expect(names).To(ContainElement("m07"))
+		Expect(names).NotTo(ContainElement("m15"))
+		Expect(names).NotTo(ContainElement("m00"))
+		Expect(len(names)).To(BeNumerically("<", 10))
+	})
+
+	ginkgo.It("should emit configured statistics", func() {
+		subject.Stats = Stats{
+			Quantiles:  []float64{0.5, 0.999},
+			Aggregates: AggregateMax | AggregateCount,
+		}
+		subject.Overrides = []Override{
+			{Pattern: "http.*", Stats: Stats{Aggregates: AggregateMean}},
+		}
+
+		Expect(subject.Prep()).To(Succeed())
+		Expect(subject.Sample("tmr", []string{"a"}, mockDistribution{})).To(Succeed())
+		Expect(subject.Sample("http.req", nil, mockDistribution{})).To(Succeed())
+		Expect(subject.Flush()).To(Succeed())
+
+		Expect(last.Body.Bytes()).To(MatchJSON(`{
+			"series":[
+				{"metric":"tmr.max","points":[[1414141414,200]],"tags":["a"],"host":"test.host"},
+				{"metric":"tmr.count","points":[[1414141414,3]],"tags":["a"],"host":"test.host"},
+				{"metric":"tmr.p50","points":[[1414141414,100.1]],"tags":["a"],"host":"test.host"},
+				{"metric":"tmr.p999","points":[[1414141414,100.1]],"tags":["a"],"host":"test.host"},
+				{"metric":"http.req.mean","points":[[1414141414,100.1]],"host":"test.host"}
+			]
+		}`))
+	})
+
+	ginkgo.It("should skip undefined statistics", func() {
+		subject.Stats = Stats{Aggregates: AggregateCount | AggregateVariance}
+
+		res := instruments.NewReservoir()
+		res.Update(5)
+
+		for i := 0; i < 2; i++ {
+			Expect(subject.Prep()).To(Succeed())
+			Expect(subject.Sample("tmr", nil, res.Snapshot())).To(Succeed())
+			Expect(subject.Flush()).To(Succeed())
+
+			Expect(last.Body.Bytes()).To(MatchJSON(`{
+				"series":[
+					{"metric":"tmr.count","points":[[1414141414,1]],"host":"test.host"}
+				]
+			}`))
+		}
+	})
+
+	ginkgo.It("should support custom suffixes", func() {
+		subject.Stats = Stats{Quantiles: []float64{0.95}, Aggregates: AggregateMin}
+		subject.Suffix = func(s Statistic) string {
+			if s.Aggregate != 0 {
+				return "_" + s.Aggregate.String()
+			}
+			return "_q" + strconv.Itoa(int(s.Quantile*100))
+		}
+
+		Expect(subject.Prep()).To(Succeed())
+		Expect(subject.Sample("tmr", nil, mockDistribution{})).To(Succeed())
+		Expect(subject.Flush()).To(Succeed())
+
+		Expect(last.Body.Bytes()).To(MatchJSON(`{
+			"series":[
+				{"metric":"tmr_min","points":[[1414141414,0.1]],"host":"test.host"},
+				{"metric":"tmr_q95","points":[[1414141414,100.1]],"host":"test.host"}
+			]
+		}`))
+	})
 })
 
 type mockDistribution struct {
 	instruments.Distribution
 }
 
+func (mockDistribution) Count() int                 { return 3 }
+func (mockDistribution) Min() float64               { return 0.1 }
+func (mockDistribution) Max() float64               { return 200 }
+func (mockDistribution) Mean() float64              { return 100.1 }
 func (mockDistribution) Quantile(_ float64) float64 { return 100.1 }
+func (mockDistribution) NumBins() int               { return 2 }
+func (mockDistribution) Bin(i int) (float64, float64) {
+	if i == 0 {
+		return 0.1, 1
+	}
+	return 99.9, -2
+}
@@ -0,0 +1,109 @@
+package datadog
+
+import (
+	"math"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/bsm/instruments"
+)
+
+// Aggregate is a bit-set of aggregate statistics.
+type Aggregate uint8
+
+// Supported aggregates.
+const (
+	AggregateMin Aggregate = 1 << iota
+	AggregateMax
+	AggregateMean
+	AggregateSum
+	AggregateCount
+	AggregateVariance
+)
+
+var aggregateNames = []string{"min", "max", "mean", "sum", "count", "variance"}
+
+// String returns the name of a single aggregate.
+func (a Aggregate) String() string {
+	for i, name := range aggregateNames {
+		if a == 1<<uint(i) {
+			return name
+		}
+	}
+	return "Aggregate(" + strconv.Itoa(int(a)) + ")"
+}
+
+func (a Aggregate) value(dist instruments.Distribution) float64 {
+	switch a {
+	case AggregateMin:
+		return dist.Min()
+	case AggregateMax:
+		return dist.Max()
+	case AggregateMean:
+		return dist.Mean()
+	case AggregateSum:
+		return dist.Sum()
+	case AggregateCount:
+		return float64(dist.Count())
+	case AggregateVariance:
+		return dist.Variance()
+	}
+	return 0
+}
+
+// unit returns the unit of the aggregate, given the unit of the
+// distribution. Counts and variances are reported without a unit.
+func (a Aggregate) unit(unit string) string {
+	if a == AggregateCount || a == AggregateVariance {
+		return ""
+	}
+	return unit
+}
+
+// Statistic identifies a single statistic of a distribution,
+// either an aggregate or a quantile.
+type Statistic struct {
+	// Aggregate is set for aggregates, zero for quantiles.
+	Aggregate Aggregate
+	// Quantile is set for quantiles.
+	Quantile float64
+}
+
+// SuffixFunc returns the metric name suffix for a statistic.
+type SuffixFunc func(Statistic) string
+
+// DefaultSuffix appends .pXX for quantiles, i.e. .p95 or .p999,
+// and the aggregate name, i.e. .max or .count, for aggregates.
+func DefaultSuffix(s Statistic) string {
+	if s.Aggregate != 0 {
+		return "." + s.Aggregate.String()
+	}
+	v := strconv.FormatFloat(math.Round(s.Quantile*1e4)/1e2, 'f', -1, 64)
+	return ".p" + strings.Replace(v, ".", "", 1)
+}
+
+// Stats configure the statistics emitted for each distribution.
+type Stats struct {
+	// Quantiles to emit.
+	Quantiles []float64
+	// Aggregates to emit.
+	Aggregates Aggregate
+}
+
+// DefaultStats are the statistics emitted by default.
+var DefaultStats = Stats{Quantiles: []float64{0.95, 0.99}}
+
+// Override configures statistics for metrics with a matching name.
+type Override struct {
+	// Pattern is matched against the full metric name using path.Match
+	// syntax, i.e. "myapp.http.*".
+	Pattern string
+	// Stats to emit instead of the reporter default.
+	Stats Stats
+}
+
+func (o *Override) match(name string) bool {
+	ok, _ := path.Match(o.Pattern, name)
+	return ok
+}
@@ -1,6 +1,9 @@
 package instruments
 
 import (
+	"encoding/binary"
+	"errors"
+	"math"
 	"sync"
 
 	"github.com/bsm/histogram/v3"
@@ -30,8 +33,12 @@ type Distribution interface {
 
 // --------------------------------------------------------------------
 
-const defaultHistogramSize = 20
+// DefaultReservoirSize is the default number of bins
+// of Reservoir and Timer instruments.
+const DefaultReservoirSize = 20
 
+// histogramPool holds histograms of any size, newHistogram
+// resizes them as required.
 var histogramPool sync.Pool
 
 func newHistogram(sz int) (h *histogram.Histogram) {
@@ -53,3 +60,418 @@ func releaseDistribution(d Distribution) {
 		releaseHistogram(h)
 	}
 }
+
+// --------------------------------------------------------------------
+
+// MergeDistributions merges dists into a single Distribution.
+//
+// Snapshots of Histogram instruments with the same bounds, of ExpHistogram
+// instruments and of Sketch instruments with the same accuracy are merged
+// bucket by bucket and return a snapshot of the same type. Empty dists are
+// ignored when determining the type.
+//
+// Other dists are re-binned into a *DistributionSnapshot. Bins are
+// combined where available, distributions without bins contribute their
+// min, max and mean. Count, sum, mean and variance are merged exactly.
+func MergeDistributions(dists ...Distribution) Distribution {
+	if s := mergeSnapshots(dists); s != nil {
+		return s
+	}
+
+	size := DefaultReservoirSize
+	for _, d := range dists {
+		if n := d.NumBins(); n > size {
+			size = n
+		}
+	}
+
+	h := newHistogram(size)
+	defer releaseHistogram(h)
+
+	var count int
+	var sum, mean, m2 float64
+	for _, d := range dists {
+		n := d.Count()
+		if n == 0 {
+			continue
+		}
+		addDistribution(h, d)
+
+		// combine moments, see:
+		// https://en.wikipedia.org/wiki/Algorithms_for_calculating_variance#Parallel_algorithm
+		total := float64(count + n)
+		delta := d.Mean() - mean
+		mean += delta * float64(n) / total
+		m2 += delta * delta * float64(count) * float64(n) / total
+		if n > 1 {
+			m2 += distributionVariance(d) * float64(n-1)
+		}
+		sum += d.Sum()
+		count += n
+	}
+
+	s := CopyDistribution(h)
+	if count == 0 {
+		return s
+	}
+
+	s.count, s.sum, s.mean = count, sum, mean
+	s.variance = math.NaN()
+	if count > 1 {
+		s.variance = m2 / float64(count-1)
+	}
+	return s
+}
+
+// mergeSnapshots merges dists bucket by bucket, if all non-empty dists
+// share the same type and a compatible layout. It returns nil otherwise.
+func mergeSnapshots(dists []Distribution) Distribution {
+	nonEmpty := make([]Distribution, 0, len(dists))
+	for _, d := range dists {
+		if d.Count() != 0 {
+			nonEmpty = append(nonEmpty, d)
+		}
+	}
+	if len(nonEmpty) == 0 {
+		nonEmpty = dists
+	}
+	if len(nonEmpty) == 0 {
+		return nil
+	}
+
+	switch nonEmpty[0].(type) {
+	case *HistogramSnapshot:
+		if s := mergeHistogramSnapshots(nonEmpty); s != nil {
+			return s
+		}
+	case *ExpHistogramSnapshot:
+		if s := mergeExpHistogramSnapshots(nonEmpty); s != nil {
+			return s
+		}
+	case *SketchSnapshot:
+		if s := mergeSketchSnapshots(nonEmpty); s != nil {
+			return s
+		}
+	}
+	return nil
+}
+
+// distributionVariance returns the variance of d. Histograms backing
+// Reservoir and Timer weigh merged bins negatively when calculating the
+// variance, it is therefore recalculated from absolute bin weights.
+func distributionVariance(d Distribution) float64 {
+	h, ok := d.(*histogram.Histogram)
+	if !ok {
+		return d.Variance()
+	}
+
+	var vv float64
+	mean := h.Mean()
+	for i := 0; i < h.NumBins(); i++ {
+		v, w := h.Bin(i)
+		vv += (v - mean) * (v - mean) * math.Abs(w)
+	}
+	return vv / (h.Weight() - 1)
+}
+
+// addDistribution adds the observations of d to h. Bins are added with
+// their absolute weight and clamped to the observed range. The exact min
+// and max of d are preserved by carving them out of the outer bins.
+func addDistribution(h *histogram.Histogram, d Distribution) {
+	count := d.Count()
+	if count == 0 {
+		return
+	}
+
+	min, max := d.Min(), d.Max()
+	h.AddWeight(min, 1)
+	if count > 1 {
+		h.AddWeight(max, 1)
+	}
+
+	lo, hi := -1, -1
+	for i := 0; i < d.NumBins(); i++ {
+		if _, w := d.Bin(i); w != 0 {
+			if lo < 0 {
+				lo = i
+			}
+			hi = i
+		}
+	}
+	if lo < 0 {
+		if count > 2 {
+			h.AddWeight(d.Mean(), float64(count-2))
+		}
+		return
+	}
+
+	for i := lo; i <= hi; i++ {
+		v, w := d.Bin(i)
+		w = math.Abs(w)
+		if i == lo {
+			w--
+		}
+		if i == hi && count > 1 {
+			w--
+		}
+		h.AddWeight(math.Max(min, math.Min(max, v)), w)
+	}
+}
+
+// scaleDistribution returns d with all values multiplied by factor > 0.
+func scaleDistribution(d Distribution, factor float64) Distribution {
+	if factor == 1 {
+		return d
+	}
+	return scaledDistribution{Distribution: d, factor: factor}
+}
+
+type scaledDistribution struct {
+	Distribution
+	factor float64
+}
+
+func (s scaledDistribution) Min() float64  { return s.Distribution.Min() * s.factor }
+func (s scaledDistribution) Max() float64  { return s.Distribution.Max() * s.factor }
+func (s scaledDistribution) Sum() float64  { return s.Distribution.Sum() * s.factor }
+func (s scaledDistribution) Mean() float64 { return s.Distribution.Mean() * s.factor }
+
+func (s scaledDistribution) Quantile(q float64) float64 {
+	return s.Distribution.Quantile(q) * s.factor
+}
+
+func (s scaledDistribution) Variance() float64 {
+	return s.Distribution.Variance() * s.factor * s.factor
+}
+
+func (s scaledDistribution) Bin(index int) (value, weight float64) {
+	value, weight = s.Distribution.Bin(index)
+	return value * s.factor, weight
+}
+
+// --------------------------------------------------------------------
+
+// Bin is a distribution bin/bucket.
+type Bin struct {
+	Value  float64
+	Weight float64
+}
+
+var _ Distribution = (*DistributionSnapshot)(nil)
+
+// DistributionSnapshot is a static, self-contained Distribution.
+type DistributionSnapshot struct {
+	count    int
+	min, max float64
+	sum      float64
+	mean     float64
+	variance float64
+	bins     []Bin
+}
+
+// CopyDistribution returns a copy of d as a DistributionSnapshot which
+// remains valid after d has been released by the registry.
+func CopyDistribution(d Distribution) *DistributionSnapshot {
+	s := &DistributionSnapshot{
+		count:    d.Count(),
+		min:      d.Min(),
+		max:      d.Max(),
+		sum:      d.Sum(),
+		mean:     d.Mean(),
+		variance: d.Variance(),
+	}
+	if n := d.NumBins(); n != 0 {
+		s.bins = make([]Bin, n)
+		for i := range s.bins {
+			s.bins[i].Value, s.bins[i].Weight = d.Bin(i)
+		}
+	}
+	return s
+}
+
+// RetainDistribution returns a Distribution which remains valid after d
+// has been released by the registry. Pooled histograms, as returned by
+// Reservoir and Timer, and unknown distributions are copied. Immutable
+// snapshots are returned as they are, preserving their own quantile
+// algorithms.
+func RetainDistribution(d Distribution) Distribution {
+	switch d.(type) {
+	case *DistributionSnapshot, *HistogramSnapshot, *ExpHistogramSnapshot, *SketchSnapshot:
+		return d
+	}
+	return CopyDistribution(d)
+}
+
+// Count implements Distribution.
+func (s *DistributionSnapshot) Count() int { return s.count }
+
+// Min implements Distribution.
+func (s *DistributionSnapshot) Min() float64 { return s.min }
+
+// Max implements Distribution.
+func (s *DistributionSnapshot) Max() float64 { return s.max }
+
+// Sum implements Distribution.
+func (s *DistributionSnapshot) Sum() float64 { return s.sum }
+
+// Mean implements Distribution.
+func (s *DistributionSnapshot) Mean() float64 { return s.mean }
+
+// Variance implements Distribution.
+func (s *DistributionSnapshot) Variance() float64 { return s.variance }
+
+// Quantile implements Distribution. It interpolates between bins, using
+// the same algorithm as the histograms backing Reservoir and Timer.
+func (s *DistributionSnapshot) Quantile(q float64) float64 {
+	var weight float64
+	for _, b := range s.bins {
+		weight += math.Abs(b.Weight)
+	}
+
+	if s.count == 0 || q < 0.0 || q > 1.0 {
+		return math.NaN()
+	} else if q == 0.0 {
+		return s.min
+	} else if q == 1.0 {
+		return s.max
+	} else if weight == 0 {
+		return s.min + (s.max-s.min)*q
+	}
+
+	delta := q * weight
+	pos := 0
+	for w0 := 0.0; pos < len(s.bins); pos++ {
+		w1 := math.Abs(s.bins[pos].Weight) / 2.0
+		if delta-w1-w0 < 0 {
+			break
+		}
+		delta -= (w1 + w0)
+		w0 = w1
+	}
+
+	switch pos {
+	case 0: // lower bound
+		return solveBins(Bin{Value: s.min}, s.bins[pos], delta)
+	case len(s.bins): // upper bound
+		return solveBins(s.bins[pos-1], Bin{Value: s.max}, delta)
+	default:
+		return solveBins(s.bins[pos-1], s.bins[pos], delta)
+	}
+}
+
+// NumBins implements Distribution.
+func (s *DistributionSnapshot) NumBins() int { return len(s.bins) }
+
+// Bin implements Distribution.
+func (s *DistributionSnapshot) Bin(index int) (value, weight float64) {
+	b := s.bins[index]
+	return b.Value, b.Weight
+}
+
+// MarshalBinary implements encoding.BinaryMarshaler.
+func (s *DistributionSnapshot) MarshalBinary() ([]byte, error) {
+	b := make([]byte, 0, 48+16*len(s.bins))
+	b = appendUvarint(b, uint64(s.count))
+	b = appendFloat64(b, s.min)
+	b = appendFloat64(b, s.max)
+	b = appendFloat64(b, s.sum)
+	b = appendFloat64(b, s.mean)
+	b = appendFloat64(b, s.variance)
+	b = appendUvarint(b, uint64(len(s.bins)))
+	for _, bin := range s.bins {
+		b = appendFloat64(b, bin.Value)
+		b = appendFloat64(b, bin.Weight)
+	}
+	return b, nil
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler.
+func (s *DistributionSnapshot) UnmarshalBinary(data []byte) error {
+	r := binaryReader{data: data}
+	s.count = int(r.uvarint())
+	s.min = r.float64()
+	s.max = r.float64()
+	s.sum = r.float64()
+	s.mean = r.float64()
+	s.variance = r.float64()
+
+	n := r.uvarint()
+	if n > uint64(len(data)/16) {
+		return errInvalidSnapshot
+	}
+	s.bins = make([]Bin, int(n))
+	for i := range s.bins {
+		s.bins[i].Value = r.float64()
+		s.bins[i].Weight = r.float64()
+	}
+	if r.err {
+		return errInvalidSnapshot
+	}
+	return nil
+}
+
+// solveBins interpolates a value between two bins. Bins with a positive
+// weight are exact, bins with a negative weight were merged.
+func solveBins(b1, b2 Bin, delta float64) float64 {
+	w1, w2 := b1.Weight, b2.Weight
+
+	// return if both bins are exact (unmerged)
+	if w1 > 0 && w2 > 0 {
+		return b2.Value
+	}
+
+	// normalise
+	w1, w2 = math.Abs(w1), math.Abs(w2)
+
+	// calculate multiplier
+	var z float64
+	if w1 == w2 {
+		z = delta / w1
+	} else {
+		a := 2 * (w2 - w1)
+		b := 2 * w1
+		z = (math.Sqrt(b*b+4*a*delta) - b) / a
+	}
+	return b1.Value + (b2.Value-b1.Value)*z
+}
+
+var errInvalidSnapshot = errors.New("instruments: invalid distribution snapshot")
+
+func appendUvarint(b []byte, v uint64) []byte {
+	var buf [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(buf[:], v)
+	return append(b, buf[:n]...)
+}
+
+func appendFloat64(b []byte, v float64) []byte {
+	var buf [8]byte
+	binary.LittleEndian.PutUint64(buf[:], math.Float64bits(v))
+	return append(b, buf[:]...)
+}
+
+type binaryReader struct {
+	data []byte
+	err  bool
+}
+
+func (r *binaryReader) uvarint() uint64 {
+	v, n := binary.Uvarint(r.data)
+	if n <= 0 {
+		r.err = true
+		r.data = nil
+		return 0
+	}
+	r.data = r.data[n:]
+	return v
+}
+
+func (r *binaryReader) float64() float64 {
+	if len(r.data) < 8 {
+		r.err = true
+		r.data = nil
+		return 0
+	}
+	v := math.Float64frombits(binary.LittleEndian.Uint64(r.data))
+	r.data = r.data[8:]
+	return v
+}
@@ -0,0 +1,154 @@
+package instruments
+
+import (
+	"math"
+
+	"github.com/bsm/ginkgo/v2"
+	. "github.com/bsm/gomega"
+)
+
+var _ = ginkgo.Describe("DistributionSnapshot", func() {
+	var hist Distribution
+
+	ginkgo.BeforeEach(func() {
+		r := NewReservoir()
+		for i := 0; i < 1000; i++ {
+			r.Update(float64(i % 97))
+		}
+		hist = r.Snapshot()
+	})
+
+	ginkgo.AfterEach(func() {
+		releaseDistribution(hist)
+	})
+
+	ginkgo.It("should copy distributions", func() {
+		s := CopyDistribution(hist)
+		Expect(s.Count()).To(Equal(1000))
+		Expect(s.Min()).To(Equal(0.0))
+		Expect(s.Max()).To(Equal(96.0))
+		Expect(s.Sum()).To(BeNumerically("~", hist.Sum(), 0.001))
+		Expect(s.Mean()).To(BeNumerically("~", hist.Mean(), 0.001))
+		Expect(s.Variance()).To(BeNumerically("~", hist.Variance(), 0.001))
+		Expect(s.NumBins()).To(Equal(hist.NumBins()))
+
+		for _, q := range []float64{0, 0.1, 0.25, 0.5, 0.75, 0.95, 0.99, 1} {
+			Expect(s.Quantile(q)).To(BeNumerically("~", hist.Quantile(q), 0.001), "for q=%v", q)
+		}
+		Expect(math.IsNaN(s.Quantile(1.1))).To(BeTrue())
+	})
+
+	ginkgo.It("should retain distributions", func() {
+		s := RetainDistribution(hist)
+		Expect(s).To(BeAssignableToTypeOf(&DistributionSnapshot{}))
+		Expect(s).To(Equal(CopyDistribution(hist)))
+
+		sketch := NewSketch(0.01)
+		sketch.Update(1)
+		for _, d := range []Distribution{
+			sketch.Snapshot(),
+			NewHistogram([]float64{1}).Snapshot(),
+			NewExpHistogram(0).Snapshot(),
+			CopyDistribution(hist),
+		} {
+			Expect(RetainDistribution(d)).To(BeIdenticalTo(d))
+		}
+	})
+
+	ginkgo.It("should marshal/unmarshal", func() {
+		data, err := CopyDistribution(hist).MarshalBinary()
+		Expect(err).NotTo(HaveOccurred())
+
+		s := new(DistributionSnapshot)
+		Expect(s.UnmarshalBinary(data)).To(Succeed())
+		Expect(s).To(Equal(CopyDistribution(hist)))
+
+		Expect(s.UnmarshalBinary(data[:len(data)-1])).To(MatchError("instruments: invalid distribution snapshot"))
+		Expect(s.UnmarshalBinary(nil)).To(MatchError("instruments: invalid distribution snapshot"))
+	})
+	ginkgo.It("should merge distributions", func() {
+		r := NewReservoir()
+		for i := 0; i < 1000; i++ {
+			r.Update(float64(i%97 + 100))
+		}
+		other := r.Snapshot()
+		defer releaseDistribution(other)
+
+		h := NewHistogram([]float64{250, 500})
+		h.Update(300)
+		h.Update(700)
+
+		s := MergeDistributions(hist, other, h.Snapshot(), NewReservoir().Snapshot())
+		Expect(s.Count()).To(Equal(2002))
+		Expect(s.Min()).To(Equal(0.0))
+		Expect(s.Max()).To(Equal(700.0))
+		Expect(s.Sum()).To(BeNumerically("~", hist.Sum()+other.Sum()+1000, 0.001))
+		Expect(s.Mean()).To(BeNumerically("~", s.Sum()/2002, 0.001))
+		Expect(s.Variance()).To(BeNumerically("~", 3496, 10))
+		Expect(s.NumBins()).To(BeNumerically("<=", DefaultReservoirSize))
+		Expect(s.Quantile(0.25)).To(BeNumerically("~", 48, 5))
+		Expect(s.Quantile(0.75)).To(BeNumerically("~", 148, 5))
+	})
+
+	ginkgo.It("should merge distributions of the same type by bucket", func() {
+		h := NewHistogram(LinearBuckets(10, 10, 10))
+		e := NewExpHistogram(0)
+		k := NewSketch(0.01)
+		for i := 0; i < 100; i++ {
+			h.Update(float64(i))
+			e.Update(float64(i))
+		}
+		for i := 1; i <= 1000; i++ {
+			k.Update(float64(i))
+		}
+
+		hs := h.Snapshot()
+		s := MergeDistributions(hs, hs, NewReservoir().Snapshot())
+		Expect(s).To(BeAssignableToTypeOf(&HistogramSnapshot{}))
+		Expect(s.(*HistogramSnapshot).Bounds()).To(Equal(LinearBuckets(10, 10, 10)))
+		Expect(s.Count()).To(Equal(200))
+		Expect(s.Sum()).To(Equal(2 * hs.Sum()))
+		Expect(s.Min()).To(Equal(0.0))
+		Expect(s.Max()).To(Equal(99.0))
+		Expect(s.Variance()).To(BeNumerically("~", hs.Variance(), 10))
+		Expect(s.Quantile(0.5)).To(Equal(hs.Quantile(0.5)))
+		Expect(s.Quantile(0.9)).To(Equal(hs.Quantile(0.9)))
+
+		ks := k.Snapshot()
+		s = MergeDistributions(ks, ks)
+		Expect(s).To(BeAssignableToTypeOf(&SketchSnapshot{}))
+		Expect(s.Count()).To(Equal(2000))
+		Expect(s.Quantile(0.99)).To(BeNumerically("~", 990, 990*0.01))
+
+		es := e.Snapshot()
+		s = MergeDistributions(es, es)
+		Expect(s).To(BeAssignableToTypeOf(&ExpHistogramSnapshot{}))
+		Expect(s.(*ExpHistogramSnapshot).Scale()).To(Equal(es.(*ExpHistogramSnapshot).Scale()))
+		Expect(s.Count()).To(Equal(200))
+		Expect(s.Quantile(0.5)).To(Equal(es.Quantile(0.5)))
+
+		// incompatible layouts are re-binned
+		Expect(MergeDistributions(hs, NewHistogram([]float64{50}).Snapshot())).To(BeAssignableToTypeOf(&HistogramSnapshot{}))
+		other := NewHistogram([]float64{50})
+		other.Update(1)
+		Expect(MergeDistributions(hs, other.Snapshot())).To(BeAssignableToTypeOf(&DistributionSnapshot{}))
+		Expect(MergeDistributions(ks, NewSketch(0.05).Snapshot())).To(BeAssignableToTypeOf(&SketchSnapshot{}))
+		coarse := NewSketch(0.05)
+		coarse.Update(1)
+		Expect(MergeDistributions(ks, coarse.Snapshot())).To(BeAssignableToTypeOf(&DistributionSnapshot{}))
+		Expect(MergeDistributions(ks, es)).To(BeAssignableToTypeOf(&DistributionSnapshot{}))
+	})
+
+	ginkgo.It("should merge distributions without bins", func() {
+		s := MergeDistributions(&DistributionSnapshot{count: 3, min: 1, max: 5, sum: 9, mean: 3, variance: 4})
+		Expect(s.Count()).To(Equal(3))
+		Expect(s.Min()).To(Equal(1.0))
+		Expect(s.Max()).To(Equal(5.0))
+		Expect(s.Mean()).To(Equal(3.0))
+		Expect(s.Variance()).To(Equal(4.0))
+
+		s = MergeDistributions()
+		Expect(s.Count()).To(Equal(0))
+		Expect(math.IsNaN(s.Quantile(0.5))).To(BeTrue())
+	})
+})
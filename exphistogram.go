@@ -0,0 +1,514 @@
+package instruments
+
+import (
+	"math"
+	"sync"
+)
+
+// Defaults for exponential histograms.
+const (
+	DefaultExpHistogramSize  = 160
+	DefaultExpHistogramScale = 20
+)
+
+// Limits of exponential histograms, as specified by OpenTelemetry.
+const (
+	minExpHistogramSize  = 2
+	minExpHistogramScale = -10
+	maxExpHistogramScale = 20
+)
+
+// ExpHistogram tracks the distribution of values using base-2 exponential
+// buckets, as specified by OpenTelemetry. Bucket boundaries are powers of
+// base = 2^(2^-scale), which bounds the relative error of each bucket.
+//
+// The histogram starts at the maximum scale and automatically reduces it,
+// merging neighbouring buckets, whenever the range of observed values
+// would exceed the maximum number of buckets. Positive and negative
+// values are tracked in separate ranges, zeros are counted separately.
+type ExpHistogram struct {
+	updateFlag
+
+	maxSize  int
+	maxScale int
+	state    expHistogramState
+	m        sync.Mutex
+}
+
+// NewExpHistogram creates a new exponential histogram with up to
+// maxSize buckets per range. A maxSize < 1 uses DefaultExpHistogramSize,
+// the minimum is 2.
+func NewExpHistogram(maxSize int) *ExpHistogram {
+	return NewExpHistogramScale(maxSize, DefaultExpHistogramScale)
+}
+
+// NewExpHistogramScale creates a new exponential histogram with up to
+// maxSize buckets per range and a custom maximum scale (-10..20).
+func NewExpHistogramScale(maxSize, maxScale int) *ExpHistogram {
+	if maxSize < 1 {
+		maxSize = DefaultExpHistogramSize
+	} else if maxSize < minExpHistogramSize {
+		maxSize = minExpHistogramSize
+	}
+	if maxScale > maxExpHistogramScale {
+		maxScale = maxExpHistogramScale
+	} else if maxScale < minExpHistogramScale {
+		maxScale = minExpHistogramScale
+	}
+
+	h := &ExpHistogram{maxSize: maxSize, maxScale: maxScale}
+	h.state.scale = maxScale
+	return h
+}
+
+// Update adds a value to the histogram.
+func (h *ExpHistogram) Update(v float64) {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return
+	}
+
+	h.mark()
+	h.m.Lock()
+	h.state.add(v, h.maxSize)
+	h.m.Unlock()
+}
+
+// Snapshot returns a Distribution
+func (h *ExpHistogram) Snapshot() Distribution {
+	h.m.Lock()
+	s := h.state.copy()
+	h.m.Unlock()
+	return s.snapshot()
+}
+
+// Reset returns a Distribution and resets the histogram.
+func (h *ExpHistogram) Reset() Distribution {
+	h.m.Lock()
+	s := h.state
+	h.state = expHistogramState{scale: h.maxScale}
+	h.m.Unlock()
+	return s.snapshot()
+}
+
+// Merge merges the observations of x into h, reducing the scale
+// where necessary.
+func (h *ExpHistogram) Merge(x *ExpHistogram) {
+	if h == x {
+		return
+	}
+
+	x.m.Lock()
+	other := x.state.copy()
+	x.m.Unlock()
+
+	h.mark()
+	h.m.Lock()
+	h.state.merge(&other, h.maxSize)
+	h.m.Unlock()
+}
+
+// --------------------------------------------------------------------
+
+type expBuckets struct {
+	offset int
+	counts []uint64
+}
+
+func (b *expBuckets) end() int { return b.offset + len(b.counts) - 1 }
+
+// downscale merges neighbouring buckets by 2^change.
+func (b *expBuckets) downscale(change int) {
+	if change == 0 || len(b.counts) == 0 {
+		return
+	}
+
+	offset := b.offset >> uint(change)
+	counts := make([]uint64, (b.end()>>uint(change))-offset+1)
+	for i, c := range b.counts {
+		counts[((b.offset+i)>>uint(change))-offset] += c
+	}
+	b.offset, b.counts = offset, counts
+}
+
+// add adds n to the bucket at index, which must be within
+// range after growing.
+func (b *expBuckets) add(index int, n uint64) {
+	if len(b.counts) == 0 {
+		b.offset, b.counts = index, append(b.counts[:0], n)
+		return
+	}
+
+	if lo, hi := b.offset, b.end(); index < lo || index > hi {
+		if index < lo {
+			lo = index
+		}
+		if index > hi {
+			hi = index
+		}
+		counts := make([]uint64, hi-lo+1)
+		copy(counts[b.offset-lo:], b.counts)
+		b.offset, b.counts = lo, counts
+	}
+	b.counts[index-b.offset] += n
+}
+
+// changeFor returns the scale reduction required to fit indices lo..hi,
+// up to maxChange. Ranges may exceed maxSize at the minimum scale.
+func (b *expBuckets) changeFor(lo, hi, maxSize, maxChange int) int {
+	if len(b.counts) != 0 {
+		if b.offset < lo {
+			lo = b.offset
+		}
+		if end := b.end(); end > hi {
+			hi = end
+		}
+	}
+
+	change := 0
+	for change < maxChange && (hi>>uint(change))-(lo>>uint(change))+1 > maxSize {
+		change++
+	}
+	return change
+}
+
+type expHistogramState struct {
+	scale      int
+	pos, neg   expBuckets
+	zero       uint64
+	count      uint64
+	sum, sumsq float64
+	min, max   float64
+}
+
+func (s *expHistogramState) add(v float64, maxSize int) {
+	if s.count == 0 || v < s.min {
+		s.min = v
+	}
+	if s.count == 0 || v > s.max {
+		s.max = v
+	}
+	s.count++
+	s.sum += v
+	s.sumsq += v * v
+
+	if v == 0 {
+		s.zero++
+		return
+	}
+
+	b := &s.pos
+	if v < 0 {
+		b, v = &s.neg, -v
+	}
+
+	index := expIndex(v, s.scale)
+	if change := b.changeFor(index, index, maxSize, s.maxChange()); change != 0 {
+		s.downscale(change)
+		index = expIndex(v, s.scale)
+	}
+	b.add(index, 1)
+}
+
+// merge merges x into s. Both states are downscaled to a common scale
+// at which the combined ranges fit maxSize.
+func (s *expHistogramState) merge(x *expHistogramState, maxSize int) {
+	if x.count == 0 {
+		return
+	}
+
+	if s.count == 0 || x.min < s.min {
+		s.min = x.min
+	}
+	if s.count == 0 || x.max > s.max {
+		s.max = x.max
+	}
+	s.count += x.count
+	s.sum += x.sum
+	s.sumsq += x.sumsq
+	s.zero += x.zero
+
+	if x.scale < s.scale {
+		s.downscale(s.scale - x.scale)
+	} else if x.scale > s.scale {
+		x.downscale(x.scale - s.scale)
+	}
+
+	change := 0
+	if len(x.pos.counts) != 0 {
+		change = s.pos.changeFor(x.pos.offset, x.pos.end(), maxSize, s.maxChange())
+	}
+	if len(x.neg.counts) != 0 {
+		if c := s.neg.changeFor(x.neg.offset, x.neg.end(), maxSize, s.maxChange()); c > change {
+			change = c
+		}
+	}
+	s.downscale(change)
+	x.downscale(change)
+
+	for i, c := range x.pos.counts {
+		if c != 0 {
+			s.pos.add(x.pos.offset+i, c)
+		}
+	}
+	for i, c := range x.neg.counts {
+		if c != 0 {
+			s.neg.add(x.neg.offset+i, c)
+		}
+	}
+}
+
+// maxChange returns the maximum scale reduction.
+func (s *expHistogramState) maxChange() int {
+	return s.scale - minExpHistogramScale
+}
+
+func (s *expHistogramState) downscale(change int) {
+	s.pos.downscale(change)
+	s.neg.downscale(change)
+	s.scale -= change
+}
+
+func (s *expHistogramState) copy() expHistogramState {
+	c := *s
+	c.pos.counts = append([]uint64(nil), s.pos.counts...)
+	c.neg.counts = append([]uint64(nil), s.neg.counts...)
+	return c
+}
+
+func (s *expHistogramState) snapshot() *ExpHistogramSnapshot {
+	x := &ExpHistogramSnapshot{state: *s}
+
+	// collect non-empty bins in ascending value order
+	for i := len(s.neg.counts) - 1; i >= 0; i-- {
+		if c := s.neg.counts[i]; c != 0 {
+			lo, hi := expBounds(s.neg.offset+i, s.scale)
+			x.bins = append(x.bins, expBin{lo: -hi, hi: -lo, count: c})
+		}
+	}
+	if s.zero != 0 {
+		x.bins = append(x.bins, expBin{count: s.zero})
+	}
+	for i, c := range s.pos.counts {
+		if c != 0 {
+			lo, hi := expBounds(s.pos.offset+i, s.scale)
+			x.bins = append(x.bins, expBin{lo: lo, hi: hi, count: c})
+		}
+	}
+
+	// clamp to observed range
+	for i := range x.bins {
+		b := &x.bins[i]
+		b.lo, b.hi = math.Max(b.lo, s.min), math.Min(b.hi, s.max)
+	}
+	return x
+}
+
+// expIndex returns the bucket index of v > 0 at the given scale. Buckets
+// are upper-inclusive, i.e. bucket i covers (base^i, base^(i+1)].
+func expIndex(v float64, scale int) int {
+	frac, exp := math.Frexp(v)
+	if scale <= 0 {
+		if frac == 0.5 {
+			exp--
+		}
+		return (exp - 1) >> uint(-scale)
+	}
+
+	if frac == 0.5 {
+		return ((exp - 1) << uint(scale)) - 1
+	}
+	return int(math.Ceil(math.Log2(v)*math.Ldexp(1, scale))) - 1
+}
+
+// expBounds returns the lower and upper boundary of the bucket at index.
+func expBounds(index, scale int) (lo, hi float64) {
+	return expLowerBound(index, scale), expLowerBound(index+1, scale)
+}
+
+func expLowerBound(index, scale int) float64 {
+	if scale <= 0 {
+		return math.Ldexp(1, index<<uint(-scale))
+	}
+	return math.Exp2(math.Ldexp(float64(index), -scale))
+}
+
+// --------------------------------------------------------------------
+
+var _ Distribution = (*ExpHistogramSnapshot)(nil)
+
+type expBin struct {
+	lo, hi float64
+	count  uint64
+}
+
+// ExpHistogramSnapshot is the Distribution returned by ExpHistogram.
+type ExpHistogramSnapshot struct {
+	state expHistogramState
+	bins  []expBin
+}
+
+// Scale returns the scale.
+func (s *ExpHistogramSnapshot) Scale() int { return s.state.scale }
+
+// ZeroCount returns the number of observed zeros.
+func (s *ExpHistogramSnapshot) ZeroCount() uint64 { return s.state.zero }
+
+// Positive returns the index offset and the counts of the positive range.
+func (s *ExpHistogramSnapshot) Positive() (offset int, counts []uint64) {
+	return s.state.pos.offset, s.state.pos.counts
+}
+
+// Negative returns the index offset and the counts of the negative range,
+// indexed by absolute value.
+func (s *ExpHistogramSnapshot) Negative() (offset int, counts []uint64) {
+	return s.state.neg.offset, s.state.neg.counts
+}
+
+// Count implements Distribution.
+func (s *ExpHistogramSnapshot) Count() int { return int(s.state.count) }
+
+// Min implements Distribution.
+func (s *ExpHistogramSnapshot) Min() float64 {
+	if s.state.count == 0 {
+		return math.NaN()
+	}
+	return s.state.min
+}
+
+// Max implements Distribution.
+func (s *ExpHistogramSnapshot) Max() float64 {
+	if s.state.count == 0 {
+		return math.NaN()
+	}
+	return s.state.max
+}
+
+// Sum implements Distribution.
+func (s *ExpHistogramSnapshot) Sum() float64 {
+	if s.state.count == 0 {
+		return math.NaN()
+	}
+	return s.state.sum
+}
+
+// Mean implements Distribution.
+func (s *ExpHistogramSnapshot) Mean() float64 {
+	if s.state.count == 0 {
+		return math.NaN()
+	}
+	return s.state.sum / float64(s.state.count)
+}
+
+// Variance implements Distribution.
+func (s *ExpHistogramSnapshot) Variance() float64 {
+	if s.state.count <= 1 {
+		return math.NaN()
+	}
+	n := float64(s.state.count)
+	mean := s.state.sum / n
+	return math.Max(0, (s.state.sumsq-n*mean*mean)/(n-1))
+}
+
+// Quantile implements Distribution. It interpolates linearly within the
+// bucket which contains the quantile.
+func (s *ExpHistogramSnapshot) Quantile(q float64) float64 {
+	if s.state.count == 0 || q < 0.0 || q > 1.0 {
+		return math.NaN()
+	} else if q == 0.0 {
+		return s.state.min
+	} else if q == 1.0 {
+		return s.state.max
+	}
+
+	rank := q * float64(s.state.count)
+	var cum float64
+	for _, b := range s.bins {
+		if cum+float64(b.count) < rank {
+			cum += float64(b.count)
+			continue
+		}
+		return b.lo + (b.hi-b.lo)*(rank-cum)/float64(b.count)
+	}
+	return s.state.max
+}
+
+// NumBins implements Distribution. Only non-empty buckets are
+// returned as bins, in ascending order of value.
+func (s *ExpHistogramSnapshot) NumBins() int { return len(s.bins) }
+
+// Bin implements Distribution. It returns the midpoint and
+// the count of the bucket at index.
+func (s *ExpHistogramSnapshot) Bin(index int) (value, weight float64) {
+	b := s.bins[index]
+	return (b.lo + b.hi) / 2, float64(b.count)
+}
+
+// BinBounds returns the lower and upper boundary
+// of the bucket at index.
+func (s *ExpHistogramSnapshot) BinBounds(index int) (lo, hi float64) {
+	b := s.bins[index]
+	return b.lo, b.hi
+}
+
+// mergeExpHistogramSnapshots merges dists, which must all be exponential
+// histogram snapshots, at their common scale. It returns nil otherwise.
+func mergeExpHistogramSnapshots(dists []Distribution) *ExpHistogramSnapshot {
+	maxSize := DefaultExpHistogramSize
+	for _, d := range dists {
+		s, ok := d.(*ExpHistogramSnapshot)
+		if !ok {
+			return nil
+		}
+		if n := len(s.state.pos.counts); n > maxSize {
+			maxSize = n
+		}
+		if n := len(s.state.neg.counts); n > maxSize {
+			maxSize = n
+		}
+	}
+
+	state := expHistogramState{scale: maxExpHistogramScale}
+	for _, d := range dists {
+		other := d.(*ExpHistogramSnapshot).state.copy()
+		state.merge(&other, maxSize)
+	}
+	return state.snapshot()
+}
+
+// MarshalBinary implements encoding.BinaryMarshaler.
+func (s *ExpHistogramSnapshot) MarshalBinary() ([]byte, error) {
+	st := &s.state
+	b := make([]byte, 0, 48+2*(len(st.pos.counts)+len(st.neg.counts)))
+	b = appendVarint(b, int64(st.scale))
+	b = appendUvarint(b, st.count)
+	b = appendUvarint(b, st.zero)
+	b = appendFloat64(b, st.sum)
+	b = appendFloat64(b, st.sumsq)
+	b = appendFloat64(b, st.min)
+	b = appendFloat64(b, st.max)
+	b = appendBuckets(b, st.pos.offset, st.pos.counts)
+	b = appendBuckets(b, st.neg.offset, st.neg.counts)
+	return b, nil
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler.
+func (s *ExpHistogramSnapshot) UnmarshalBinary(data []byte) error {
+	r := binaryReader{data: data}
+
+	var st expHistogramState
+	st.scale = int(r.varint())
+	st.count = r.uvarint()
+	st.zero = r.uvarint()
+	st.sum = r.float64()
+	st.sumsq = r.float64()
+	st.min = r.float64()
+	st.max = r.float64()
+	st.pos.offset, st.pos.counts = r.buckets()
+	st.neg.offset, st.neg.counts = r.buckets()
+	if r.err || len(r.data) != 0 || st.scale < minExpHistogramScale || st.scale > maxExpHistogramScale {
+		return errInvalidSnapshot
+	}
+
+	*s = *st.snapshot()
+	return nil
+}
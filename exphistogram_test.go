@@ -0,0 +1,181 @@
+package instruments
+
+import (
+	"math"
+	"math/rand"
+
+	"github.com/bsm/ginkgo/v2"
+	. "github.com/bsm/gomega"
+)
+
+var _ = ginkgo.Describe("ExpHistogram", func() {
+	ginkgo.It("should map values to buckets", func() {
+		Expect(expIndex(1, 0)).To(Equal(-1))
+		Expect(expIndex(2, 0)).To(Equal(0))
+		Expect(expIndex(3, 0)).To(Equal(1))
+		Expect(expIndex(4, 0)).To(Equal(1))
+		Expect(expIndex(2, 1)).To(Equal(1))
+		Expect(expIndex(1024, -2)).To(Equal(2))
+
+		rnd := rand.New(rand.NewSource(1))
+		for scale := -4; scale <= 8; scale++ {
+			for i := 0; i < 1000; i++ {
+				v := math.Exp(rnd.Float64()*40 - 20)
+				lo, hi := expBounds(expIndex(v, scale), scale)
+				Expect(v).To(BeNumerically(">", lo*(1-1e-12)), "v=%v scale=%d", v, scale)
+				Expect(v).To(BeNumerically("<=", hi*(1+1e-12)), "v=%v scale=%d", v, scale)
+			}
+		}
+	})
+
+	ginkgo.It("should reduce scale", func() {
+		h := NewExpHistogram(4)
+		for v := 1.0; v <= 1024; v *= 2 {
+			h.Update(v)
+		}
+
+		s := h.Snapshot().(*ExpHistogramSnapshot)
+		Expect(s.Scale()).To(Equal(-2))
+		offset, counts := s.Positive()
+		Expect(offset).To(Equal(-1))
+		Expect(counts).To(Equal([]uint64{1, 4, 4, 2}))
+		Expect(s.Count()).To(Equal(11))
+		Expect(s.Sum()).To(Equal(2047.0))
+		Expect(s.Min()).To(Equal(1.0))
+		Expect(s.Max()).To(Equal(1024.0))
+	})
+
+	ginkgo.It("should limit scale reduction", func() {
+		h := NewExpHistogram(1)
+		Expect(h.maxSize).To(Equal(2))
+		h.Update(0.5)
+		h.Update(4)
+		Expect(h.Snapshot().(*ExpHistogramSnapshot).Scale()).To(Equal(-1))
+
+		h.Update(math.MaxFloat64)
+		h.Update(math.SmallestNonzeroFloat64)
+		s := h.Snapshot().(*ExpHistogramSnapshot)
+		Expect(s.Scale()).To(Equal(-10))
+		Expect(s.Count()).To(Equal(4))
+		offset, counts := s.Positive()
+		Expect(offset).To(Equal(-2))
+		Expect(counts).To(Equal([]uint64{1, 1, 2}))
+	})
+
+	ginkgo.It("should track negative values and zeros", func() {
+		h := NewExpHistogram(0)
+		for _, v := range []float64{-4, -1, 0, 0, 2, 8} {
+			h.Update(v)
+		}
+
+		s := h.Snapshot().(*ExpHistogramSnapshot)
+		Expect(s.ZeroCount()).To(Equal(uint64(2)))
+		_, neg := s.Negative()
+		_, pos := s.Positive()
+		Expect(sumCounts(neg)).To(Equal(uint64(2)))
+		Expect(sumCounts(pos)).To(Equal(uint64(2)))
+		Expect(s.Count()).To(Equal(6))
+		Expect(s.Mean()).To(BeNumerically("~", 0.83, 0.01))
+
+		Expect(s.NumBins()).To(Equal(5))
+		var values []float64
+		for i := 0; i < s.NumBins(); i++ {
+			v, _ := s.Bin(i)
+			values = append(values, v)
+		}
+		Expect(values).To(HaveLen(5))
+		Expect(values[0]).To(BeNumerically("~", -4, 0.1))
+		Expect(values[1]).To(BeNumerically("~", -1, 0.05))
+		Expect(values[2]).To(Equal(0.0))
+		Expect(values[3]).To(BeNumerically("~", 2, 0.05))
+		Expect(values[4]).To(BeNumerically("~", 8, 0.1))
+
+		for i := 0; i < s.NumBins(); i++ {
+			lo, hi := s.BinBounds(i)
+			Expect(lo).To(BeNumerically("<=", values[i]))
+			Expect(hi).To(BeNumerically(">=", values[i]))
+		}
+	})
+
+	ginkgo.It("should merge", func() {
+		h1, h2 := NewExpHistogram(4), NewExpHistogram(4)
+		for v := 1.0; v <= 32; v *= 2 {
+			h1.Update(v)
+		}
+		for v := 64.0; v <= 1024; v *= 2 {
+			h2.Update(v)
+		}
+		h2.Update(0)
+		h2.Update(-2)
+		h1.Merge(h2)
+		h1.Merge(h1)
+
+		s := h1.Snapshot().(*ExpHistogramSnapshot)
+		Expect(s.Scale()).To(Equal(-2))
+		offset, counts := s.Positive()
+		Expect(offset).To(Equal(-1))
+		Expect(counts).To(Equal([]uint64{1, 4, 4, 2}))
+		Expect(s.ZeroCount()).To(Equal(uint64(1)))
+		_, counts = s.Negative()
+		Expect(counts).To(Equal([]uint64{1}))
+		Expect(s.Count()).To(Equal(13))
+		Expect(s.Sum()).To(Equal(2045.0))
+		Expect(s.Min()).To(Equal(-2.0))
+		Expect(s.Max()).To(Equal(1024.0))
+	})
+
+	ginkgo.It("should calculate quantiles", func() {
+		h := NewExpHistogram(0)
+		for i := 1; i <= 10000; i++ {
+			h.Update(float64(i))
+		}
+
+		s := h.Snapshot()
+		Expect(s.Quantile(0)).To(Equal(1.0))
+		Expect(s.Quantile(0.5)).To(BeNumerically("~", 5000, 50))
+		Expect(s.Quantile(0.99)).To(BeNumerically("~", 9900, 99))
+		Expect(s.Quantile(1)).To(Equal(10000.0))
+	})
+
+	ginkgo.It("should marshal/unmarshal snapshots", func() {
+		h := NewExpHistogram(4)
+		for _, v := range []float64{-3, 0, 1, 2, 3, 500} {
+			h.Update(v)
+		}
+		snap := h.Snapshot().(*ExpHistogramSnapshot)
+
+		data, err := snap.MarshalBinary()
+		Expect(err).NotTo(HaveOccurred())
+
+		s := new(ExpHistogramSnapshot)
+		Expect(s.UnmarshalBinary(data)).To(Succeed())
+		Expect(s).To(Equal(snap))
+
+		Expect(s.UnmarshalBinary(data[:len(data)-1])).To(MatchError(errInvalidSnapshot))
+		Expect(s.UnmarshalBinary(nil)).To(MatchError(errInvalidSnapshot))
+	})
+
+	ginkgo.It("should reset", func() {
+		h := NewExpHistogram(0)
+		h.Update(3)
+		h.Update(4)
+		Expect(h.Reset().Mean()).To(Equal(3.5))
+		Expect(h.Snapshot().Count()).To(Equal(0))
+
+		h.Update(10)
+		Expect(h.Reset().Max()).To(Equal(10.0))
+	})
+
+	ginkgo.It("should fetch from registry", func() {
+		r := NewUnstarted("")
+		h := r.ExpHistogram("h", nil, 0)
+		Expect(r.ExpHistogram("h", nil, 10)).To(BeIdenticalTo(h))
+	})
+})
+
+func sumCounts(counts []uint64) (sum uint64) {
+	for _, c := range counts {
+		sum += c
+	}
+	return
+}
@@ -0,0 +1,95 @@
+package graphite
+
+import (
+	"sort"
+	"strings"
+)
+
+// PathFunc builds a metric path from a name and tags.
+type PathFunc func(name string, tags []string) string
+
+// DottedPath appends tags as dotted path segments, sorted by tag key.
+// The values of "key:value" tags are used as segments, tags without a
+// value are used as they are, i.e.:
+//
+//	DottedPath("myapp.requests", []string{"status:200", "host:web1"}) // => "myapp.requests.web1.200"
+func DottedPath(name string, tags []string) string {
+	pairs := parseTags(tags)
+	if len(pairs) == 0 {
+		return sanitizePath(name)
+	}
+
+	var sb strings.Builder
+	sb.WriteString(sanitizePath(name))
+	for _, p := range pairs {
+		seg := p[1]
+		if seg == "" {
+			seg = p[0]
+		}
+		sb.WriteByte('.')
+		sb.WriteString(sanitizeSegment(seg))
+	}
+	return sb.String()
+}
+
+// TaggedPath uses the Graphite 1.1 tagged series syntax. Tags without
+// a value are converted to key=true, i.e.:
+//
+//	TaggedPath("myapp.requests", []string{"status:200", "canary"}) // => "myapp.requests;canary=true;status=200"
+func TaggedPath(name string, tags []string) string {
+	pairs := parseTags(tags)
+	if len(pairs) == 0 {
+		return sanitizePath(name)
+	}
+
+	var sb strings.Builder
+	sb.WriteString(sanitizePath(name))
+	for _, p := range pairs {
+		val := p[1]
+		if val == "" {
+			val = "true"
+		}
+		sb.WriteByte(';')
+		sb.WriteString(tagKeyReplacer.Replace(p[0]))
+		sb.WriteByte('=')
+		sb.WriteString(tagValueReplacer.Replace(val))
+	}
+	return sb.String()
+}
+
+// --------------------------------------------------------------------
+
+var (
+	pathReplacer     = strings.NewReplacer(" ", "_", ";", "_", "\n", "_", "\t", "_")
+	segmentReplacer  = strings.NewReplacer(".", "_", " ", "_", ";", "_", "\n", "_", "\t", "_")
+	tagKeyReplacer   = strings.NewReplacer(" ", "_", ";", "_", "!", "_", "^", "_", "=", "_", "\n", "_", "\t", "_")
+	tagValueReplacer = strings.NewReplacer(" ", "_", ";", "_", "~", "_", "\n", "_", "\t", "_")
+)
+
+func sanitizePath(s string) string    { return pathReplacer.Replace(s) }
+func sanitizeSegment(s string) string { return segmentReplacer.Replace(s) }
+
+// parseTags converts "key:value" tags into key/value pairs, sorted by key.
+// Tags without a value are returned with a blank value.
+func parseTags(tags []string) [][2]string {
+	if len(tags) == 0 {
+		return nil
+	}
+
+	pairs := make([][2]string, 0, len(tags))
+	for _, tag := range tags {
+		key, val := tag, ""
+		if pos := strings.IndexByte(tag, ':'); pos > -1 {
+			key, val = tag[:pos], tag[pos+1:]
+			if val == "" {
+				continue
+			}
+		}
+		if key == "" {
+			continue
+		}
+		pairs = append(pairs, [2]string{key, val})
+	}
+	sort.SliceStable(pairs, func(i, j int) bool { return pairs[i][0] < pairs[j][0] })
+	return pairs
+}
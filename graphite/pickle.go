@@ -0,0 +1,56 @@
+package graphite
+
+import (
+	"encoding/binary"
+	"math"
+)
+
+// maxPicklePoints is the maximum number of points per pickle message.
+const maxPicklePoints = 500
+
+// appendPickle encodes points as a series of length-prefixed pickle
+// (protocol 2) messages, each holding a list of (path, (timestamp, value))
+// tuples, as expected by carbon's pickle receiver.
+func appendPickle(dst []byte, points []point) []byte {
+	for len(points) != 0 {
+		n := len(points)
+		if n > maxPicklePoints {
+			n = maxPicklePoints
+		}
+
+		offset := len(dst)
+		dst = append(dst, 0, 0, 0, 0) // length header placeholder
+		dst = append(dst, 0x80, 0x02) // PROTO 2
+		dst = append(dst, ']', '(')   // EMPTY_LIST, MARK
+
+		for _, p := range points[:n] {
+			dst = append(dst, 'X') // BINUNICODE
+			dst = appendUint32LE(dst, uint32(len(p.Path)))
+			dst = append(dst, p.Path...)
+
+			dst = append(dst, 'J') // BININT
+			dst = appendUint32LE(dst, uint32(int32(p.Timestamp)))
+
+			dst = append(dst, 'G') // BINFLOAT
+			dst = appendUint64BE(dst, math.Float64bits(p.Value))
+
+			dst = append(dst, 0x86, 0x86) // TUPLE2, TUPLE2
+		}
+
+		dst = append(dst, 'e', '.') // APPENDS, STOP
+		binary.BigEndian.PutUint32(dst[offset:], uint32(len(dst)-offset-4))
+		points = points[n:]
+	}
+	return dst
+}
+
+func appendUint32LE(dst []byte, v uint32) []byte {
+	return append(dst, byte(v), byte(v>>8), byte(v>>16), byte(v>>24))
+}
+
+func appendUint64BE(dst []byte, v uint64) []byte {
+	return append(dst,
+		byte(v>>56), byte(v>>48), byte(v>>40), byte(v>>32),
+		byte(v>>24), byte(v>>16), byte(v>>8), byte(v),
+	)
+}
@@ -0,0 +1,191 @@
+// Package graphite implements a reporter which writes metrics to
+// carbon using either the plaintext or the pickle protocol.
+package graphite
+
+import (
+	"math"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/bsm/instruments"
+)
+
+var _ instruments.Reporter = (*Reporter)(nil)
+
+var unixTime = func() int64 { return time.Now().Unix() }
+
+// DefaultTimeout is the default dial/write timeout.
+const DefaultTimeout = 10 * time.Second
+
+// DefaultQuantiles are the quantiles written for each distribution.
+var DefaultQuantiles = []float64{0.95, 0.99}
+
+// Reporter implements instruments.Reporter and writes metrics to carbon.
+type Reporter struct {
+	// Addr is the carbon TCP address.
+	Addr string
+
+	// Pickle enables the pickle protocol. Please note that carbon
+	// listens for pickle data on a separate port, usually 2004.
+	Pickle bool
+
+	// Path builds the metric path from a name and tags.
+	// Default: DottedPath
+	Path PathFunc
+
+	// Quantiles are written as .pXX sub-paths for every distribution.
+	// Default: DefaultQuantiles
+	Quantiles []float64
+
+	// Timeout is the dial/write timeout.
+	// Default: DefaultTimeout
+	Timeout time.Duration
+
+	conn      net.Conn
+	points    []point
+	timestamp int64
+}
+
+// New creates a new reporter, writing plaintext to the carbon
+// listener at addr.
+func New(addr string) *Reporter {
+	return &Reporter{
+		Addr:      addr,
+		Path:      DottedPath,
+		Quantiles: DefaultQuantiles,
+		Timeout:   DefaultTimeout,
+	}
+}
+
+// Prep implements instruments.Reporter
+func (r *Reporter) Prep() error {
+	r.timestamp = unixTime()
+	r.points = r.points[:0]
+	return nil
+}
+
+// Discrete implements instruments.Reporter
+func (r *Reporter) Discrete(name string, tags []string, val float64) error {
+	r.append(name, tags, val)
+	return nil
+}
+
+// Sample implements instruments.Reporter
+func (r *Reporter) Sample(name string, tags []string, dist instruments.Distribution) error {
+	r.append(name+".count", tags, float64(dist.Count()))
+	r.append(name+".min", tags, dist.Min())
+	r.append(name+".max", tags, dist.Max())
+	r.append(name+".mean", tags, dist.Mean())
+	for _, q := range r.Quantiles {
+		r.append(name+"."+instruments.QuantileSuffix(q), tags, dist.Quantile(q))
+	}
+	return nil
+}
+
+// Flush implements instruments.Reporter
+func (r *Reporter) Flush() error {
+	if len(r.points) == 0 {
+		return nil
+	}
+
+	var payload []byte
+	if r.Pickle {
+		payload = appendPickle(nil, r.points)
+	} else {
+		payload = appendPlaintext(nil, r.points)
+	}
+	r.points = r.points[:0]
+
+	// retry once on a fresh connection if the existing one was dropped,
+	// unless the payload was partially written already
+	if n, err := r.write(payload); err != nil {
+		r.disconnect()
+		if n != 0 {
+			return err
+		}
+		if _, err := r.write(payload); err != nil {
+			r.disconnect()
+			return err
+		}
+	}
+	return nil
+}
+
+// Close closes the connection.
+func (r *Reporter) Close() error {
+	if r.conn == nil {
+		return nil
+	}
+	err := r.conn.Close()
+	r.conn = nil
+	return err
+}
+
+func (r *Reporter) append(name string, tags []string, val float64) {
+	if math.IsNaN(val) || math.IsInf(val, 0) {
+		return
+	}
+
+	path := r.path(name, tags)
+	if path == "" {
+		return
+	}
+	r.points = append(r.points, point{Path: path, Value: val, Timestamp: r.timestamp})
+}
+
+func (r *Reporter) path(name string, tags []string) string {
+	if r.Path != nil {
+		return r.Path(name, tags)
+	}
+	return DottedPath(name, tags)
+}
+
+func (r *Reporter) write(payload []byte) (int, error) {
+	if r.conn == nil {
+		conn, err := net.DialTimeout("tcp", r.Addr, r.timeout())
+		if err != nil {
+			return 0, err
+		}
+		r.conn = conn
+	}
+
+	if err := r.conn.SetWriteDeadline(time.Now().Add(r.timeout())); err != nil {
+		return 0, err
+	}
+	return r.conn.Write(payload)
+}
+
+func (r *Reporter) disconnect() {
+	if r.conn != nil {
+		_ = r.conn.Close()
+		r.conn = nil
+	}
+}
+
+func (r *Reporter) timeout() time.Duration {
+	if r.Timeout > 0 {
+		return r.Timeout
+	}
+	return DefaultTimeout
+}
+
+// --------------------------------------------------------------------
+
+type point struct {
+	Path      string
+	Value     float64
+	Timestamp int64
+}
+
+func appendPlaintext(dst []byte, points []point) []byte {
+	for _, p := range points {
+		dst = append(dst, p.Path...)
+		dst = append(dst, ' ')
+		dst = strconv.AppendFloat(dst, p.Value, 'f', -1, 64)
+		dst = append(dst, ' ')
+		dst = strconv.AppendInt(dst, p.Timestamp, 10)
+		dst = append(dst, '\n')
+	}
+	return dst
+}
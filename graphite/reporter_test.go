@@ -0,0 +1,264 @@
+package graphite
+
+import (
+	"errors"
+	"math"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bsm/ginkgo/v2"
+	. "github.com/bsm/gomega"
+	"github.com/bsm/instruments"
+)
+
+var _ = ginkgo.Describe("Reporter", func() {
+	var subject *Reporter
+	var server *mockServer
+
+	ginkgo.BeforeEach(func() {
+		var err error
+		server, err = newMockServer()
+		Expect(err).NotTo(HaveOccurred())
+
+		subject = New(server.Addr())
+	})
+
+	ginkgo.AfterEach(func() {
+		Expect(subject.Close()).To(Succeed())
+		server.Close()
+	})
+
+	ginkgo.It("should support reporter cycle", func() {
+		Expect(subject.Prep()).To(Succeed())
+		Expect(subject.Discrete("cnt", []string{"status:200", "host:web1"}, 3)).To(Succeed())
+		Expect(subject.Discrete("gauge", nil, 0.5)).To(Succeed())
+		Expect(subject.Sample("tmr", nil, mockDistribution{})).To(Succeed())
+		Expect(subject.Flush()).To(Succeed())
+
+		Eventually(server.Received).Should(Equal("" +
+			"cnt.web1.200 3 1414141414\n" +
+			"gauge 0.5 1414141414\n" +
+			"tmr.count 3 1414141414\n" +
+			"tmr.min 0.1 1414141414\n" +
+			"tmr.max 200 1414141414\n" +
+			"tmr.mean 100.1 1414141414\n" +
+			"tmr.p95 100.1 1414141414\n" +
+			"tmr.p99 100.1 1414141414\n",
+		))
+	})
+
+	ginkgo.It("should support tagged series", func() {
+		subject.Path = TaggedPath
+
+		Expect(subject.Prep()).To(Succeed())
+		Expect(subject.Discrete("cnt", []string{"status:200", "canary"}, 3)).To(Succeed())
+		Expect(subject.Sample("tmr", []string{"a:b"}, mockDistribution{})).To(Succeed())
+		Expect(subject.Flush()).To(Succeed())
+
+		Eventually(server.Received).Should(HavePrefix("" +
+			"cnt;canary=true;status=200 3 1414141414\n" +
+			"tmr.count;a=b 3 1414141414\n",
+		))
+	})
+
+	ginkgo.It("should reconnect", func() {
+		Expect(subject.Prep()).To(Succeed())
+		Expect(subject.Discrete("m1", nil, 1)).To(Succeed())
+		Expect(subject.Flush()).To(Succeed())
+		Eventually(server.Received).Should(Equal("m1 1 1414141414\n"))
+
+		server.Drop()
+		time.Sleep(10 * time.Millisecond)
+
+		Eventually(func() string {
+			Expect(subject.Prep()).To(Succeed())
+			Expect(subject.Discrete("m2", nil, 2)).To(Succeed())
+			_ = subject.Flush()
+			return server.Received()
+		}).Should(HaveSuffix("m2 2 1414141414\n"))
+		Expect(server.Accepted()).To(Equal(2))
+	})
+
+	ginkgo.It("should not resend partially written payloads", func() {
+		conn := &partialConn{}
+		subject.conn = conn
+
+		Expect(subject.Prep()).To(Succeed())
+		Expect(subject.Discrete("m1", nil, 1)).To(Succeed())
+		Expect(subject.Flush()).To(MatchError(errPartialWrite))
+		Expect(conn.writes).To(Equal(1))
+		Expect(server.Accepted()).To(Equal(0))
+
+		Expect(subject.Prep()).To(Succeed())
+		Expect(subject.Discrete("m2", nil, 2)).To(Succeed())
+		Expect(subject.Flush()).To(Succeed())
+		Eventually(server.Received).Should(Equal("m2 2 1414141414\n"))
+	})
+
+	ginkgo.It("should skip non-finite values", func() {
+		Expect(subject.Prep()).To(Succeed())
+		Expect(subject.Discrete("nan", nil, math.NaN())).To(Succeed())
+		Expect(subject.Discrete("inf", nil, math.Inf(1))).To(Succeed())
+		Expect(subject.Discrete("m1", nil, 1)).To(Succeed())
+		Expect(subject.Flush()).To(Succeed())
+
+		Eventually(server.Received).Should(Equal("m1 1 1414141414\n"))
+	})
+
+	ginkgo.It("should write pickle", func() {
+		subject.Pickle = true
+
+		Expect(subject.Prep()).To(Succeed())
+		Expect(subject.Discrete("a", nil, 1.5)).To(Succeed())
+		Expect(subject.Flush()).To(Succeed())
+
+		Eventually(server.Received).Should(Equal("" +
+			"\x00\x00\x00\x1c" +
+			"\x80\x02](" +
+			"X\x01\x00\x00\x00a" +
+			"J\xe6\x15\x4a\x54" +
+			"G\x3f\xf8\x00\x00\x00\x00\x00\x00" +
+			"\x86\x86" +
+			"e.",
+		))
+	})
+
+	ginkgo.DescribeTable("should build dotted paths",
+		func(name string, tags []string, exp string) {
+			Expect(DottedPath(name, tags)).To(Equal(exp))
+		},
+
+		ginkgo.Entry("plain", "a.b", nil, "a.b"),
+		ginkgo.Entry("key/value", "a.b", []string{"y:2", "x:1"}, "a.b.1.2"),
+		ginkgo.Entry("bare", "a.b", []string{"flag"}, "a.b.flag"),
+		ginkgo.Entry("sanitize", "a b", []string{"host:web.1"}, "a_b.web_1"),
+	)
+
+	ginkgo.DescribeTable("should build tagged paths",
+		func(name string, tags []string, exp string) {
+			Expect(TaggedPath(name, tags)).To(Equal(exp))
+		},
+
+		ginkgo.Entry("plain", "a.b", nil, "a.b"),
+		ginkgo.Entry("key/value", "a.b", []string{"y:2", "x:1"}, "a.b;x=1;y=2"),
+		ginkgo.Entry("bare", "a.b", []string{"flag"}, "a.b;flag=true"),
+		ginkgo.Entry("sanitize", "a;b", []string{"k=x:a;b"}, "a_b;k_x=a_b"),
+	)
+})
+
+// --------------------------------------------------------------------
+
+func TestSuite(t *testing.T) {
+	RegisterFailHandler(ginkgo.Fail)
+	ginkgo.RunSpecs(t, "instruments/graphite")
+}
+
+func init() {
+	unixTime = func() int64 { return 1414141414 }
+}
+
+type mockDistribution struct {
+	instruments.Distribution
+}
+
+func (mockDistribution) Count() int                 { return 3 }
+func (mockDistribution) Min() float64               { return 0.1 }
+func (mockDistribution) Max() float64               { return 200 }
+func (mockDistribution) Mean() float64              { return 100.1 }
+func (mockDistribution) Quantile(_ float64) float64 { return 100.1 }
+
+var errPartialWrite = errors.New("partial write")
+
+// partialConn writes a part of the first payload and fails.
+type partialConn struct {
+	net.Conn
+	writes int
+}
+
+func (c *partialConn) SetWriteDeadline(_ time.Time) error { return nil }
+func (c *partialConn) Close() error                       { return nil }
+func (c *partialConn) Write(p []byte) (int, error) {
+	c.writes++
+	return len(p) / 2, errPartialWrite
+}
+
+type mockServer struct {
+	ln       net.Listener
+	conns    []net.Conn
+	data     []byte
+	accepted int
+	mu       sync.Mutex
+}
+
+func newMockServer() (*mockServer, error) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+
+	s := &mockServer{ln: ln}
+	go s.serve()
+	return s, nil
+}
+
+func (s *mockServer) Addr() string { return s.ln.Addr().String() }
+
+func (s *mockServer) Received() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return string(s.data)
+}
+
+func (s *mockServer) Accepted() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.accepted
+}
+
+// Drop closes all accepted connections.
+func (s *mockServer) Drop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, c := range s.conns {
+		_ = c.Close()
+	}
+	s.conns = s.conns[:0]
+}
+
+func (s *mockServer) Close() {
+	_ = s.ln.Close()
+	s.Drop()
+}
+
+func (s *mockServer) serve() {
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+
+		s.mu.Lock()
+		s.conns = append(s.conns, conn)
+		s.accepted++
+		s.mu.Unlock()
+
+		go s.handle(conn)
+	}
+}
+
+func (s *mockServer) handle(conn net.Conn) {
+	buf := make([]byte, 4096)
+	for {
+		n, err := conn.Read(buf)
+		if n > 0 {
+			s.mu.Lock()
+			s.data = append(s.data, buf[:n]...)
+			s.mu.Unlock()
+		}
+		if err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,420 @@
+package instruments
+
+import (
+	"errors"
+	"math"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+var errHistogramMismatch = errors.New("instruments: cannot merge histograms with different bounds")
+
+// LinearBuckets returns count bucket boundaries, starting at start,
+// each width apart.
+func LinearBuckets(start, width float64, count int) []float64 {
+	bounds := make([]float64, count)
+	for i := range bounds {
+		bounds[i] = start + float64(i)*width
+	}
+	return bounds
+}
+
+// ExponentialBuckets returns count bucket boundaries, starting at
+// start, each multiplied by factor.
+func ExponentialBuckets(start, factor float64, count int) []float64 {
+	bounds := make([]float64, count)
+	for i := range bounds {
+		bounds[i] = start
+		start *= factor
+	}
+	return bounds
+}
+
+// Histogram tracks the distribution of values across fixed buckets.
+// Unlike Reservoir, bucket boundaries are stable and can therefore
+// be aggregated across instances.
+//
+// Each bucket counts values less than or equal to its upper boundary
+// and greater than the previous one. An additional, implicit bucket
+// counts values above the last boundary.
+type Histogram struct {
+	sum, sumsq uint64
+	min, max   uint64
+	updateFlag
+
+	// updates hold a read lock to record concurrently, snapshots
+	// hold the write lock to see all fields of an update at once
+	m sync.RWMutex
+
+	bounds []float64
+	counts []uint64
+}
+
+// NewHistogram creates a new histogram with the given
+// upper bucket boundaries.
+func NewHistogram(bounds []float64) *Histogram {
+	sorted := make([]float64, 0, len(bounds))
+	for _, b := range bounds {
+		if !math.IsNaN(b) && !math.IsInf(b, 1) {
+			sorted = append(sorted, b)
+		}
+	}
+	sort.Float64s(sorted)
+
+	uniq := sorted[:0]
+	for i, b := range sorted {
+		if i == 0 || b != sorted[i-1] {
+			uniq = append(uniq, b)
+		}
+	}
+
+	h := &Histogram{
+		bounds: uniq,
+		counts: make([]uint64, len(uniq)+1),
+	}
+	h.min, h.max = math.Float64bits(math.Inf(1)), math.Float64bits(math.Inf(-1))
+	return h
+}
+
+// Update adds a value to the histogram.
+func (h *Histogram) Update(v float64) {
+	if math.IsNaN(v) {
+		return
+	}
+
+	h.m.RLock()
+	defer h.m.RUnlock()
+
+	h.mark()
+	atomic.AddUint64(&h.counts[sort.SearchFloat64s(h.bounds, v)], 1)
+	atomicAddFloat64(&h.sum, v)
+	atomicAddFloat64(&h.sumsq, v*v)
+	atomicMinFloat64(&h.min, v)
+	atomicMaxFloat64(&h.max, v)
+}
+
+// Snapshot returns a Distribution
+func (h *Histogram) Snapshot() Distribution {
+	h.m.Lock()
+	defer h.m.Unlock()
+
+	s := &HistogramSnapshot{
+		bounds: h.bounds,
+		counts: make([]uint64, len(h.counts)),
+		sum:    math.Float64frombits(atomic.LoadUint64(&h.sum)),
+		sumsq:  math.Float64frombits(atomic.LoadUint64(&h.sumsq)),
+		min:    math.Float64frombits(atomic.LoadUint64(&h.min)),
+		max:    math.Float64frombits(atomic.LoadUint64(&h.max)),
+	}
+	for i := range h.counts {
+		s.counts[i] = atomic.LoadUint64(&h.counts[i])
+		s.count += s.counts[i]
+	}
+	return s
+}
+
+// Reset returns a Distribution and resets the histogram.
+func (h *Histogram) Reset() Distribution {
+	h.m.Lock()
+	defer h.m.Unlock()
+
+	s := &HistogramSnapshot{
+		bounds: h.bounds,
+		counts: make([]uint64, len(h.counts)),
+		sum:    math.Float64frombits(atomic.SwapUint64(&h.sum, 0)),
+		sumsq:  math.Float64frombits(atomic.SwapUint64(&h.sumsq, 0)),
+		min:    math.Float64frombits(atomic.SwapUint64(&h.min, math.Float64bits(math.Inf(1)))),
+		max:    math.Float64frombits(atomic.SwapUint64(&h.max, math.Float64bits(math.Inf(-1)))),
+	}
+	for i := range h.counts {
+		s.counts[i] = atomic.SwapUint64(&h.counts[i], 0)
+		s.count += s.counts[i]
+	}
+	return s
+}
+
+// Merge merges the observations of x into h. Both histograms must
+// have the same bucket boundaries.
+func (h *Histogram) Merge(x *Histogram) error {
+	if h == x {
+		return nil
+	}
+	if !equalBounds(h.bounds, x.bounds) {
+		return errHistogramMismatch
+	}
+
+	s := x.Snapshot().(*HistogramSnapshot)
+	if s.count == 0 {
+		return nil
+	}
+
+	h.m.RLock()
+	defer h.m.RUnlock()
+
+	h.mark()
+	for i, c := range s.counts {
+		atomic.AddUint64(&h.counts[i], c)
+	}
+	atomicAddFloat64(&h.sum, s.sum)
+	atomicAddFloat64(&h.sumsq, s.sumsq)
+	atomicMinFloat64(&h.min, s.min)
+	atomicMaxFloat64(&h.max, s.max)
+	return nil
+}
+
+// --------------------------------------------------------------------
+
+var _ Distribution = (*HistogramSnapshot)(nil)
+
+// HistogramSnapshot is the Distribution returned by Histogram.
+type HistogramSnapshot struct {
+	bounds     []float64
+	counts     []uint64
+	count      uint64
+	sum, sumsq float64
+	min, max   float64
+}
+
+// Bounds returns the upper bucket boundaries.
+func (s *HistogramSnapshot) Bounds() []float64 { return s.bounds }
+
+// Counts returns the bucket counts. The last element
+// holds the count of values above the last boundary.
+func (s *HistogramSnapshot) Counts() []uint64 { return s.counts }
+
+// Count implements Distribution.
+func (s *HistogramSnapshot) Count() int { return int(s.count) }
+
+// Min implements Distribution.
+func (s *HistogramSnapshot) Min() float64 {
+	if s.count == 0 {
+		return math.NaN()
+	}
+	return s.min
+}
+
+// Max implements Distribution.
+func (s *HistogramSnapshot) Max() float64 {
+	if s.count == 0 {
+		return math.NaN()
+	}
+	return s.max
+}
+
+// Sum implements Distribution.
+func (s *HistogramSnapshot) Sum() float64 {
+	if s.count == 0 {
+		return math.NaN()
+	}
+	return s.sum
+}
+
+// Mean implements Distribution.
+func (s *HistogramSnapshot) Mean() float64 {
+	if s.count == 0 {
+		return math.NaN()
+	}
+	return s.sum / float64(s.count)
+}
+
+// Variance implements Distribution.
+func (s *HistogramSnapshot) Variance() float64 {
+	if s.count <= 1 {
+		return math.NaN()
+	}
+	n := float64(s.count)
+	mean := s.sum / n
+	return math.Max(0, (s.sumsq-n*mean*mean)/(n-1))
+}
+
+// Quantile implements Distribution. It interpolates linearly within the
+// bucket which contains the quantile, bounded by the observed min and max.
+func (s *HistogramSnapshot) Quantile(q float64) float64 {
+	if s.count == 0 || q < 0.0 || q > 1.0 {
+		return math.NaN()
+	} else if q == 0.0 {
+		return s.min
+	} else if q == 1.0 {
+		return s.max
+	}
+
+	rank := q * float64(s.count)
+	var cum float64
+	for i, c := range s.counts {
+		if c == 0 || cum+float64(c) < rank {
+			cum += float64(c)
+			continue
+		}
+
+		lo, hi := s.min, s.max
+		if i > 0 && s.bounds[i-1] > lo {
+			lo = s.bounds[i-1]
+		}
+		if i < len(s.bounds) && s.bounds[i] < hi {
+			hi = s.bounds[i]
+		}
+		return lo + (hi-lo)*(rank-cum)/float64(c)
+	}
+	return s.max
+}
+
+// NumBins implements Distribution.
+func (s *HistogramSnapshot) NumBins() int { return len(s.counts) }
+
+// Bin implements Distribution. It returns a representative value and
+// the count of the bucket at index. The value is the bucket midpoint,
+// bounded by the observed min and max.
+func (s *HistogramSnapshot) Bin(index int) (value, weight float64) {
+	weight = float64(s.counts[index])
+
+	lo, hi := math.NaN(), math.NaN()
+	if index > 0 {
+		lo = s.bounds[index-1]
+	}
+	if index < len(s.bounds) {
+		hi = s.bounds[index]
+	}
+
+	// non-empty buckets are bounded by the observed range,
+	// which also closes the outer buckets
+	if s.counts[index] != 0 {
+		if math.IsNaN(lo) || s.min > lo {
+			lo = s.min
+		}
+		if math.IsNaN(hi) || s.max < hi {
+			hi = s.max
+		}
+	}
+
+	switch {
+	case math.IsNaN(lo) && math.IsNaN(hi):
+		return 0, weight
+	case math.IsNaN(lo):
+		return hi, weight
+	case math.IsNaN(hi):
+		return lo, weight
+	}
+	return lo + (hi-lo)/2, weight
+}
+
+// mergeHistogramSnapshots merges dists, which must all be histogram
+// snapshots with the same bounds. It returns nil otherwise.
+func mergeHistogramSnapshots(dists []Distribution) *HistogramSnapshot {
+	first, ok := dists[0].(*HistogramSnapshot)
+	if !ok {
+		return nil
+	}
+
+	x := &HistogramSnapshot{
+		bounds: first.bounds,
+		counts: make([]uint64, len(first.counts)),
+		min:    math.Inf(1),
+		max:    math.Inf(-1),
+	}
+	for _, d := range dists {
+		s, ok := d.(*HistogramSnapshot)
+		if !ok || !equalBounds(s.bounds, x.bounds) {
+			return nil
+		}
+
+		for i, c := range s.counts {
+			x.counts[i] += c
+		}
+		x.count += s.count
+		x.sum += s.sum
+		x.sumsq += s.sumsq
+		x.min = math.Min(x.min, s.min)
+		x.max = math.Max(x.max, s.max)
+	}
+	return x
+}
+
+// MarshalBinary implements encoding.BinaryMarshaler.
+func (s *HistogramSnapshot) MarshalBinary() ([]byte, error) {
+	b := make([]byte, 0, 40+8*len(s.bounds)+2*len(s.counts))
+	b = appendUvarint(b, uint64(len(s.bounds)))
+	for _, v := range s.bounds {
+		b = appendFloat64(b, v)
+	}
+	for _, c := range s.counts {
+		b = appendUvarint(b, c)
+	}
+	b = appendFloat64(b, s.sum)
+	b = appendFloat64(b, s.sumsq)
+	b = appendFloat64(b, s.min)
+	b = appendFloat64(b, s.max)
+	return b, nil
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler.
+func (s *HistogramSnapshot) UnmarshalBinary(data []byte) error {
+	r := binaryReader{data: data}
+	n := r.uvarint()
+	if n > uint64(len(data)/8) {
+		return errInvalidSnapshot
+	}
+
+	x := HistogramSnapshot{
+		bounds: make([]float64, int(n)),
+		counts: make([]uint64, int(n)+1),
+	}
+	for i := range x.bounds {
+		x.bounds[i] = r.float64()
+	}
+	for i := range x.counts {
+		x.counts[i] = r.uvarint()
+		x.count += x.counts[i]
+	}
+	x.sum = r.float64()
+	x.sumsq = r.float64()
+	x.min = r.float64()
+	x.max = r.float64()
+	if r.err || len(r.data) != 0 {
+		return errInvalidSnapshot
+	}
+
+	*s = x
+	return nil
+}
+
+// --------------------------------------------------------------------
+
+func atomicAddFloat64(addr *uint64, v float64) {
+	for {
+		old := atomic.LoadUint64(addr)
+		if atomic.CompareAndSwapUint64(addr, old, math.Float64bits(math.Float64frombits(old)+v)) {
+			return
+		}
+	}
+}
+
+func atomicMinFloat64(addr *uint64, v float64) {
+	for {
+		old := atomic.LoadUint64(addr)
+		if v >= math.Float64frombits(old) || atomic.CompareAndSwapUint64(addr, old, math.Float64bits(v)) {
+			return
+		}
+	}
+}
+
+func atomicMaxFloat64(addr *uint64, v float64) {
+	for {
+		old := atomic.LoadUint64(addr)
+		if v <= math.Float64frombits(old) || atomic.CompareAndSwapUint64(addr, old, math.Float64bits(v)) {
+			return
+		}
+	}
+}
+
+func equalBounds(a, b []float64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,179 @@
+package instruments
+
+import (
+	"math"
+	"sync"
+
+	"github.com/bsm/ginkgo/v2"
+	. "github.com/bsm/gomega"
+)
+
+var _ = ginkgo.Describe("Histogram", func() {
+	ginkgo.It("should generate boundaries", func() {
+		Expect(LinearBuckets(1, 2, 4)).To(Equal([]float64{1, 3, 5, 7}))
+		Expect(ExponentialBuckets(1, 10, 4)).To(Equal([]float64{1, 10, 100, 1000}))
+	})
+
+	ginkgo.It("should normalize boundaries", func() {
+		h := NewHistogram([]float64{10, 1, math.Inf(1), 5, 1, math.NaN()})
+		Expect(h.Snapshot().(*HistogramSnapshot).Bounds()).To(Equal([]float64{1, 5, 10}))
+	})
+
+	ginkgo.It("should count values in buckets", func() {
+		h := NewHistogram([]float64{1, 5, 10})
+		Expect(h.Snapshot().Count()).To(Equal(0))
+		Expect(math.IsNaN(h.Snapshot().Min())).To(BeTrue())
+
+		for _, v := range []float64{0.5, 1, 2, 3, 5, 7, 12, 20} {
+			h.Update(v)
+		}
+
+		s := h.Snapshot()
+		Expect(s.(*HistogramSnapshot).Counts()).To(Equal([]uint64{2, 3, 1, 2}))
+		Expect(s.Count()).To(Equal(8))
+		Expect(s.Min()).To(Equal(0.5))
+		Expect(s.Max()).To(Equal(20.0))
+		Expect(s.Sum()).To(Equal(50.5))
+		Expect(s.Mean()).To(BeNumerically("~", 6.31, 0.01))
+		Expect(s.Variance()).To(BeNumerically("~", 44.78, 0.01))
+
+		Expect(s.NumBins()).To(Equal(4))
+		bins := make([]Bin, s.NumBins())
+		for i := range bins {
+			bins[i].Value, bins[i].Weight = s.Bin(i)
+		}
+		Expect(bins).To(Equal([]Bin{{0.75, 2}, {3, 3}, {7.5, 1}, {15, 2}}))
+
+		// empty buckets use their boundaries
+		s = NewHistogram([]float64{1, 5}).Snapshot()
+		for i := range bins[:3] {
+			bins[i].Value, bins[i].Weight = s.Bin(i)
+		}
+		Expect(bins[:3]).To(Equal([]Bin{{1, 0}, {3, 0}, {5, 0}}))
+	})
+
+	ginkgo.It("should calculate quantiles", func() {
+		h := NewHistogram(LinearBuckets(10, 10, 10))
+		for i := 1; i <= 100; i++ {
+			h.Update(float64(i))
+		}
+
+		s := h.Snapshot()
+		Expect(s.Quantile(0)).To(Equal(1.0))
+		Expect(s.Quantile(0.5)).To(BeNumerically("~", 50, 1))
+		Expect(s.Quantile(0.95)).To(BeNumerically("~", 95, 1))
+		Expect(s.Quantile(1)).To(Equal(100.0))
+		Expect(math.IsNaN(s.Quantile(1.1))).To(BeTrue())
+	})
+
+	ginkgo.It("should reset", func() {
+		h := NewHistogram([]float64{1, 5})
+		h.Update(3)
+		h.Update(4)
+		Expect(h.Reset().Mean()).To(Equal(3.5))
+		Expect(h.Snapshot().Count()).To(Equal(0))
+
+		h.Update(10)
+		s := h.Reset()
+		Expect(s.Min()).To(Equal(10.0))
+		Expect(s.Max()).To(Equal(10.0))
+	})
+
+	ginkgo.It("should merge", func() {
+		h1 := NewHistogram([]float64{1, 5})
+		h1.Update(3)
+		h2 := NewHistogram([]float64{5, 1})
+		h2.Update(0.5)
+		h2.Update(7)
+		Expect(h1.Merge(h2)).To(Succeed())
+		Expect(h1.Merge(h1)).To(Succeed())
+
+		s := h1.Snapshot().(*HistogramSnapshot)
+		Expect(s.Counts()).To(Equal([]uint64{1, 1, 1}))
+		Expect(s.Sum()).To(Equal(10.5))
+		Expect(s.Min()).To(Equal(0.5))
+		Expect(s.Max()).To(Equal(7.0))
+
+		Expect(h1.Merge(NewHistogram([]float64{2}))).To(MatchError("instruments: cannot merge histograms with different bounds"))
+	})
+
+	ginkgo.It("should marshal/unmarshal snapshots", func() {
+		h := NewHistogram([]float64{1, 5, 10})
+		for _, v := range []float64{0.5, 2, 3, 12} {
+			h.Update(v)
+		}
+
+		data, err := h.Snapshot().(*HistogramSnapshot).MarshalBinary()
+		Expect(err).NotTo(HaveOccurred())
+
+		s := new(HistogramSnapshot)
+		Expect(s.UnmarshalBinary(data)).To(Succeed())
+		Expect(s).To(Equal(h.Snapshot()))
+
+		Expect(s.UnmarshalBinary(data[:len(data)-1])).To(MatchError(errInvalidSnapshot))
+		Expect(s.UnmarshalBinary(nil)).To(MatchError(errInvalidSnapshot))
+	})
+
+	ginkgo.It("should update atomically", func() {
+		h := NewHistogram([]float64{0.5, 1.5})
+
+		var wg sync.WaitGroup
+		for i := 0; i < 4; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for j := 0; j < 1000; j++ {
+					h.Update(1)
+				}
+			}()
+		}
+		wg.Wait()
+
+		s := h.Snapshot()
+		Expect(s.Count()).To(Equal(4000))
+		Expect(s.Sum()).To(Equal(4000.0))
+	})
+
+	ginkgo.It("should reset consistently", func() {
+		h := NewHistogram([]float64{0.5, 1.5})
+
+		var wg sync.WaitGroup
+		for i := 0; i < 4; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for j := 0; j < 10000; j++ {
+					h.Update(1)
+				}
+			}()
+		}
+
+		done := make(chan struct{})
+		go func() {
+			wg.Wait()
+			close(done)
+		}()
+
+		var count int
+		for {
+			s := h.Reset()
+			if s.Count() != 0 {
+				Expect(s.Sum()).To(Equal(float64(s.Count())))
+			}
+			count += s.Count()
+
+			select {
+			case <-done:
+				Expect(count + h.Reset().Count()).To(Equal(40000))
+				return
+			default:
+			}
+		}
+	})
+
+	ginkgo.It("should fetch from registry", func() {
+		r := NewUnstarted("")
+		h := r.Histogram("h", nil, []float64{1})
+		Expect(r.Histogram("h", nil, []float64{2})).To(BeIdenticalTo(h))
+	})
+})
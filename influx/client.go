@@ -0,0 +1,204 @@
+package influx
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// Writer writes batches of line-protocol encoded points.
+type Writer interface {
+	Write(batch []byte) error
+}
+
+// --------------------------------------------------------------------
+
+// Client writes points to an InfluxDB HTTP write endpoint.
+type Client struct {
+	client *http.Client
+
+	// URL is the full write URL, including the query.
+	URL string
+
+	// Token is sent as "Authorization: Token <token>" header
+	// to v2 write endpoints.
+	Token string
+
+	// Username and Password are used for basic authentication
+	// against v1 write endpoints.
+	Username, Password string
+
+	// Disables gzip payload compression when
+	// POSTing data to the API.
+	DisableCompression bool
+}
+
+// NewV1Client creates a client for the v1 /write endpoint, i.e.
+//
+//	NewV1Client("http://localhost:8086", "mydb")
+func NewV1Client(baseURL, database string) *Client {
+	query := url.Values{"db": {database}, "precision": {"ns"}}
+	return newClient(baseURL + "/write?" + query.Encode())
+}
+
+// NewV2Client creates a client for the v2 /api/v2/write endpoint, i.e.
+//
+//	NewV2Client("http://localhost:8086", "myorg", "mybucket", "TOKEN")
+func NewV2Client(baseURL, org, bucket, token string) *Client {
+	query := url.Values{"org": {org}, "bucket": {bucket}, "precision": {"ns"}}
+	c := newClient(baseURL + "/api/v2/write?" + query.Encode())
+	c.Token = token
+	return c
+}
+
+func newClient(url string) *Client {
+	return &Client{
+		client: &http.Client{
+			Transport: &http.Transport{
+				Proxy: http.ProxyFromEnvironment,
+				DialContext: (&net.Dialer{
+					Timeout:   30 * time.Second,
+					KeepAlive: 30 * time.Second,
+				}).DialContext,
+				TLSHandshakeTimeout:   10 * time.Second,
+				ExpectContinueTimeout: 1 * time.Second,
+			},
+			Timeout: time.Minute,
+		},
+		URL: url,
+	}
+}
+
+// Write implements Writer.
+func (c *Client) Write(batch []byte) error {
+	var body io.Reader = bytes.NewReader(batch)
+	if !c.DisableCompression {
+		buf := fetchBuffer()
+		defer bufferPool.Put(buf)
+
+		gzw := fetchGzipWriter(buf)
+		defer gzipWriterPool.Put(gzw)
+
+		if _, err := gzw.Write(batch); err != nil {
+			return err
+		}
+		if err := gzw.Close(); err != nil {
+			return err
+		}
+		body = buf
+	}
+
+	req, err := http.NewRequest("POST", c.URL, body)
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if !c.DisableCompression {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Token "+c.Token)
+	}
+	if c.Username != "" || c.Password != "" {
+		req.SetBasicAuth(c.Username, c.Password)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+	return fmt.Errorf("influx: bad API response: %s", resp.Status)
+}
+
+// --------------------------------------------------------------------
+
+// DefaultPayloadSize is the default maximum UDP payload size.
+const DefaultPayloadSize = 1432
+
+// UDPClient writes points to an InfluxDB UDP listener.
+type UDPClient struct {
+	conn net.Conn
+
+	// PayloadSize is the maximum datagram size. Batches are split
+	// into multiple datagrams at line boundaries.
+	// Default: DefaultPayloadSize
+	PayloadSize int
+}
+
+// NewUDPClient creates a new UDP client.
+func NewUDPClient(addr string) (*UDPClient, error) {
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	return &UDPClient{conn: conn, PayloadSize: DefaultPayloadSize}, nil
+}
+
+// Write implements Writer.
+func (c *UDPClient) Write(batch []byte) error {
+	size := c.PayloadSize
+	if size < 1 {
+		size = DefaultPayloadSize
+	}
+
+	for len(batch) != 0 {
+		n := len(batch)
+		if n > size {
+			// split after the last complete line within size, or after
+			// the first line if that one alone exceeds size
+			if pos := bytes.LastIndexByte(batch[:size], '\n'); pos > -1 {
+				n = pos + 1
+			} else if pos := bytes.IndexByte(batch, '\n'); pos > -1 {
+				n = pos + 1
+			}
+		}
+
+		if _, err := c.conn.Write(batch[:n]); err != nil {
+			return err
+		}
+		batch = batch[n:]
+	}
+	return nil
+}
+
+// Close closes the underlying connection.
+func (c *UDPClient) Close() error {
+	return c.conn.Close()
+}
+
+// --------------------------------------------------------------------
+
+var (
+	bufferPool     sync.Pool
+	gzipWriterPool sync.Pool
+)
+
+func fetchBuffer() *bytes.Buffer {
+	if v := bufferPool.Get(); v != nil {
+		b := v.(*bytes.Buffer)
+		b.Reset()
+		return b
+	}
+	return new(bytes.Buffer)
+}
+
+func fetchGzipWriter(w io.Writer) *gzip.Writer {
+	if v := gzipWriterPool.Get(); v != nil {
+		z := v.(*gzip.Writer)
+		z.Reset(w)
+		return z
+	}
+	return gzip.NewWriter(w)
+}
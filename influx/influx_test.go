@@ -0,0 +1,150 @@
+package influx
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/bsm/ginkgo/v2"
+	. "github.com/bsm/gomega"
+)
+
+var _ = ginkgo.Describe("Client", func() {
+	var server *httptest.Server
+	var last *mockServerRequest
+
+	ginkgo.BeforeEach(func() {
+		last = new(mockServerRequest)
+		server = newMockServer(last)
+	})
+
+	ginkgo.AfterEach(func() {
+		server.Close()
+	})
+
+	ginkgo.It("should write to v1 endpoints", func() {
+		subject := NewV1Client(server.URL, "my db")
+		subject.Username = "user"
+		subject.Password = "pass"
+
+		Expect(subject.Write([]byte("m1 value=1 1414141414000000000\n"))).To(Succeed())
+		Expect(last.Method).To(Equal("POST"))
+		Expect(last.URL.Path).To(Equal("/write"))
+		Expect(last.URL.Query()).To(Equal(url.Values{"db": {"my db"}, "precision": {"ns"}}))
+		Expect(last.Header.Get("Authorization")).To(Equal("Basic dXNlcjpwYXNz"))
+		Expect(last.Header.Get("Content-Encoding")).To(Equal("gzip"))
+		Expect(last.Body.String()).To(Equal("m1 value=1 1414141414000000000\n"))
+	})
+
+	ginkgo.It("should write to v2 endpoints", func() {
+		subject := NewV2Client(server.URL, "org", "bucket", "TOKEN")
+
+		Expect(subject.Write([]byte("m1 value=1 1414141414000000000\n"))).To(Succeed())
+		Expect(last.URL.Path).To(Equal("/api/v2/write"))
+		Expect(last.URL.Query()).To(Equal(url.Values{"org": {"org"}, "bucket": {"bucket"}, "precision": {"ns"}}))
+		Expect(last.Header.Get("Authorization")).To(Equal("Token TOKEN"))
+		Expect(last.Body.String()).To(Equal("m1 value=1 1414141414000000000\n"))
+	})
+
+	ginkgo.It("should write uncompressed", func() {
+		subject := NewV2Client(server.URL, "org", "bucket", "TOKEN")
+		subject.DisableCompression = true
+
+		Expect(subject.Write([]byte("m1 value=1 1414141414000000000\n"))).To(Succeed())
+		Expect(last.Header.Get("Content-Encoding")).To(BeEmpty())
+		Expect(last.Body.String()).To(Equal("m1 value=1 1414141414000000000\n"))
+	})
+
+	ginkgo.It("should fail on bad responses", func() {
+		subject := NewV1Client(server.URL+"/bad", "db")
+		Expect(subject.Write([]byte("m1 value=1\n"))).To(MatchError("influx: bad API response: 404 Not Found"))
+	})
+
+	ginkgo.It("should write to UDP listeners", func() {
+		conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+		Expect(err).NotTo(HaveOccurred())
+		defer conn.Close()
+
+		subject, err := NewUDPClient(conn.LocalAddr().String())
+		Expect(err).NotTo(HaveOccurred())
+		defer subject.Close()
+
+		subject.PayloadSize = 30
+		Expect(subject.Write([]byte("m1 value=1 1\nm2 value=2 1\nm3 value=3 1\nmeasurement value=4 1\n"))).To(Succeed())
+
+		var packets []string
+		buf := make([]byte, 1024)
+		for {
+			_ = conn.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+			n, _, err := conn.ReadFrom(buf)
+			if err != nil {
+				break
+			}
+			packets = append(packets, string(buf[:n]))
+		}
+		Expect(packets).To(Equal([]string{
+			"m1 value=1 1\nm2 value=2 1\n",
+			"m3 value=3 1\n",
+			"measurement value=4 1\n",
+		}))
+	})
+})
+
+// --------------------------------------------------------------------
+
+func TestSuite(t *testing.T) {
+	RegisterFailHandler(ginkgo.Fail)
+	ginkgo.RunSpecs(t, "instruments/influx")
+}
+
+func init() {
+	timeNow = func() time.Time { return time.Unix(1414141414, 0) }
+}
+
+type mockServerRequest struct {
+	Method string
+	URL    *url.URL
+	Header http.Header
+	Body   bytes.Buffer
+	Count  int
+}
+
+func newMockServer(last *mockServerRequest) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+
+		if r.URL.Path == "/bad/write" {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+
+		last.Method = r.Method
+		last.URL = r.URL
+		last.Header = r.Header
+		last.Body.Reset()
+		last.Count++
+
+		var body io.Reader = r.Body
+		if r.Header.Get("Content-Encoding") == "gzip" {
+			z, err := gzip.NewReader(r.Body)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			defer z.Close()
+			body = z
+		}
+
+		if _, err := io.Copy(&last.Body, body); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+}
@@ -0,0 +1,189 @@
+// Package influx implements a reporter which writes metrics to InfluxDB
+// using the line protocol.
+package influx
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bsm/instruments"
+)
+
+var _ instruments.Reporter = (*Reporter)(nil)
+
+var timeNow = time.Now
+
+// DefaultBatchSize is the default maximum number of points per write.
+const DefaultBatchSize = 5000
+
+// DefaultQuantiles are the quantiles written for each distribution.
+var DefaultQuantiles = []float64{0.5, 0.95, 0.99}
+
+// Reporter implements instruments.Reporter and writes points
+// in line protocol format.
+type Reporter struct {
+	// Writer receives the batches of points.
+	Writer Writer
+
+	// BatchSize is the maximum number of points per write.
+	// Default: DefaultBatchSize
+	BatchSize int
+
+	// Quantiles are written as pXX fields for every distribution.
+	// Default: DefaultQuantiles
+	Quantiles []float64
+
+	buf       []byte
+	offsets   []int
+	timestamp int64
+}
+
+// New creates a new reporter.
+func New(w Writer) *Reporter {
+	return &Reporter{
+		Writer:    w,
+		BatchSize: DefaultBatchSize,
+		Quantiles: DefaultQuantiles,
+	}
+}
+
+// Prep implements instruments.Reporter
+func (r *Reporter) Prep() error {
+	r.timestamp = timeNow().UnixNano()
+	r.buf = r.buf[:0]
+	r.offsets = r.offsets[:0]
+	return nil
+}
+
+// Discrete implements instruments.Reporter
+func (r *Reporter) Discrete(name string, tags []string, val float64) error {
+	r.appendPoint(name, tags, field{"value", val})
+	return nil
+}
+
+// Sample implements instruments.Reporter
+func (r *Reporter) Sample(name string, tags []string, dist instruments.Distribution) error {
+	fields := make([]field, 0, 5+len(r.Quantiles))
+	fields = append(fields,
+		field{"count", float64(dist.Count())},
+		field{"min", dist.Min()},
+		field{"max", dist.Max()},
+		field{"mean", dist.Mean()},
+		field{"sum", dist.Sum()},
+	)
+	for _, q := range r.Quantiles {
+		fields = append(fields, field{instruments.QuantileSuffix(q), dist.Quantile(q)})
+	}
+	r.appendPoint(name, tags, fields...)
+	return nil
+}
+
+// Flush implements instruments.Reporter
+func (r *Reporter) Flush() error {
+	size := r.BatchSize
+	if size < 1 {
+		size = DefaultBatchSize
+	}
+
+	for start := 0; start < len(r.offsets); start += size {
+		end := start + size
+		if end > len(r.offsets) {
+			end = len(r.offsets)
+		}
+
+		bpos, epos := r.offsets[start], len(r.buf)
+		if end < len(r.offsets) {
+			epos = r.offsets[end]
+		}
+		if err := r.Writer.Write(r.buf[bpos:epos]); err != nil {
+			return err
+		}
+	}
+
+	r.buf = r.buf[:0]
+	r.offsets = r.offsets[:0]
+	return nil
+}
+
+func (r *Reporter) appendPoint(name string, tags []string, fields ...field) {
+	offset := len(r.buf)
+	buf := append(r.buf, measurementEscaper.Replace(name)...)
+
+	for _, t := range parseTags(tags) {
+		buf = append(buf, ',')
+		buf = append(buf, keyEscaper.Replace(t[0])...)
+		buf = append(buf, '=')
+		buf = append(buf, keyEscaper.Replace(t[1])...)
+	}
+
+	n := 0
+	for _, f := range fields {
+		if math.IsNaN(f.Value) || math.IsInf(f.Value, 0) {
+			continue
+		}
+
+		if n == 0 {
+			buf = append(buf, ' ')
+		} else {
+			buf = append(buf, ',')
+		}
+		buf = append(buf, keyEscaper.Replace(f.Key)...)
+		buf = append(buf, '=')
+		if f.Key == "count" {
+			buf = strconv.AppendInt(buf, int64(f.Value), 10)
+			buf = append(buf, 'i')
+		} else {
+			buf = strconv.AppendFloat(buf, f.Value, 'g', -1, 64)
+		}
+		n++
+	}
+
+	// points without fields are invalid
+	if n == 0 {
+		return
+	}
+
+	buf = append(buf, ' ')
+	buf = strconv.AppendInt(buf, r.timestamp, 10)
+	buf = append(buf, '\n')
+
+	r.buf = buf
+	r.offsets = append(r.offsets, offset)
+}
+
+// --------------------------------------------------------------------
+
+type field struct {
+	Key   string
+	Value float64
+}
+
+var (
+	measurementEscaper = strings.NewReplacer(",", `\,`, " ", `\ `, "\n", `\n`)
+	keyEscaper         = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `, "\n", `\n`)
+)
+
+// parseTags converts "key:value" tags into sorted key/value pairs.
+// Tags without a value are converted to key=true.
+func parseTags(tags []string) [][2]string {
+	if len(tags) == 0 {
+		return nil
+	}
+
+	pairs := make([][2]string, 0, len(tags))
+	for _, tag := range tags {
+		key, val := tag, "true"
+		if pos := strings.IndexByte(tag, ':'); pos > -1 {
+			key, val = tag[:pos], tag[pos+1:]
+		}
+		if key == "" || val == "" {
+			continue
+		}
+		pairs = append(pairs, [2]string{key, val})
+	}
+	sort.SliceStable(pairs, func(i, j int) bool { return pairs[i][0] < pairs[j][0] })
+	return pairs
+}
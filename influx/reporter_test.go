@@ -0,0 +1,71 @@
+package influx
+
+import (
+	"net/http/httptest"
+
+	"github.com/bsm/ginkgo/v2"
+	. "github.com/bsm/gomega"
+	"github.com/bsm/instruments"
+)
+
+var _ = ginkgo.Describe("Reporter", func() {
+	var subject *Reporter
+
+	var server *httptest.Server
+	var last *mockServerRequest
+
+	ginkgo.BeforeEach(func() {
+		last = new(mockServerRequest)
+		server = newMockServer(last)
+
+		subject = New(NewV2Client(server.URL, "org", "bucket", "TOKEN"))
+	})
+
+	ginkgo.AfterEach(func() {
+		server.Close()
+	})
+
+	ginkgo.It("should support reporter cycle", func() {
+		Expect(subject.Prep()).To(Succeed())
+		Expect(subject.Discrete("cnt", []string{"b:2", "a:1"}, 3)).To(Succeed())
+		Expect(subject.Discrete("my cnt,x", []string{"flag", "k=x:a b"}, 0.5)).To(Succeed())
+		Expect(subject.Sample("tmr", []string{"a:1"}, mockDistribution{})).To(Succeed())
+		Expect(subject.Flush()).To(Succeed())
+
+		Expect(last.Count).To(Equal(1))
+		Expect(last.Body.String()).To(Equal(`cnt,a=1,b=2 value=3 1414141414000000000
+my\ cnt\,x,flag=true,k\=x=a\ b value=0.5 1414141414000000000
+tmr,a=1 count=3i,min=0.1,max=200,mean=100.1,sum=300.3,p50=100.1,p95=100.1,p99=100.1 1414141414000000000
+`))
+	})
+
+	ginkgo.It("should batch points", func() {
+		subject.BatchSize = 2
+
+		Expect(subject.Prep()).To(Succeed())
+		Expect(subject.Discrete("m1", nil, 1)).To(Succeed())
+		Expect(subject.Discrete("m2", nil, 2)).To(Succeed())
+		Expect(subject.Discrete("m3", nil, 3)).To(Succeed())
+		Expect(subject.Flush()).To(Succeed())
+
+		Expect(last.Count).To(Equal(2))
+		Expect(last.Body.String()).To(Equal("m3 value=3 1414141414000000000\n"))
+	})
+
+	ginkgo.It("should skip empty cycles", func() {
+		Expect(subject.Prep()).To(Succeed())
+		Expect(subject.Flush()).To(Succeed())
+		Expect(last.Count).To(Equal(0))
+	})
+})
+
+type mockDistribution struct {
+	instruments.Distribution
+}
+
+func (mockDistribution) Count() int                 { return 3 }
+func (mockDistribution) Min() float64               { return 0.1 }
+func (mockDistribution) Max() float64               { return 200 }
+func (mockDistribution) Mean() float64              { return 100.1 }
+func (mockDistribution) Sum() float64               { return 300.3 }
+func (mockDistribution) Quantile(_ float64) float64 { return 100.1 }
@@ -6,18 +6,28 @@ rather than including observations from prior windows, contrary to EWMA based me
 
 Instruments support two types of instruments:
 Discrete instruments return a single value, and Sample instruments a value distribution.
+Compound instruments report several discrete values under one name.
 
 Theses base instruments are available:
 
 - Counter: holds a counter that can be incremented or decremented.
+- StripedCounter: a Counter which spreads updates across shards, for hot paths.
+- CumulativeCounter: holds a monotonic counter which is not reset between flushes.
 - Rate: tracks the rate of values per seconds.
 - Reservoir: randomly samples values.
+- ShardedReservoir: a Reservoir which buffers updates in shards, for hot paths.
 - Derive: tracks the rate of values based on the delta with previous value.
 - Gauge: tracks last value.
+- GaugeFunc: observes a value at flush time.
 - Timer: tracks durations.
+- ShardedTimer: a Timer backed by a ShardedReservoir.
+- Meter: tracks the count, mean and moving average rates of values per second.
+- Histogram: counts values in fixed buckets.
+- ExpHistogram: counts values in base-2 exponential buckets.
+- Sketch: tracks quantiles with a relative accuracy guarantee (DDSketch).
 
 You can create custom instruments or compose new instruments form the built-in
-instruments as long as they implements the Sample or Discrete interfaces.
+instruments as long as they implements the Sample, Discrete or Compound interfaces.
 */
 package instruments
 
@@ -40,11 +50,35 @@ type Sample interface {
 	Snapshot() Distribution
 }
 
+// Compound represents an instrument which reports several discrete
+// values under one name, e.g. Meter.
+type Compound interface {
+	Snapshot() []Value
+}
+
+// Value is a discrete value reported by a Compound instrument.
+type Value struct {
+	// Suffix is appended to the instrument name.
+	Suffix string
+	// Value is the current value.
+	Value float64
+	// Meta describes the value.
+	Meta Metadata
+}
+
+// Resetter is an optional interface for Sample instruments. Registries
+// with persistent instruments call Reset instead of Snapshot to start
+// each interval with a blank sample.
+type Resetter interface {
+	Reset() Distribution
+}
+
 // --------------------------------------------------------------------
 
 // Counter holds a counter that can be incremented or decremented.
 type Counter struct {
 	value uint64
+	updateFlag
 }
 
 // NewCounter creates a new counter instrument.
@@ -54,6 +88,7 @@ func NewCounter() *Counter {
 
 // Update adds v to the counter.
 func (c *Counter) Update(v float64) {
+	c.mark()
 	for {
 		old := c.current()
 		new := old + v
@@ -74,6 +109,11 @@ func (c *Counter) Snapshot() float64 {
 	}
 }
 
+// Metadata implements Describer.
+func (c *Counter) Metadata() Metadata {
+	return Metadata{Kind: KindCounter}
+}
+
 func (c *Counter) current() float64 {
 	return math.Float64frombits(atomic.LoadUint64(&c.value))
 }
@@ -84,6 +124,55 @@ func (c *Counter) cas(old, new float64) bool {
 
 // --------------------------------------------------------------------
 
+// CumulativeCounter holds a monotonic counter which, unlike Counter,
+// is not reset by snapshots. It is retained by the registry across
+// flushes, even if the registry is not persistent.
+type CumulativeCounter struct {
+	count Counter
+	total uint64
+	delta uint64
+	start time.Time
+}
+
+// NewCumulativeCounter creates a new cumulative counter instrument.
+func NewCumulativeCounter() *CumulativeCounter {
+	return &CumulativeCounter{start: time.Now()}
+}
+
+// Update adds v to the counter. Negative values are ignored.
+func (c *CumulativeCounter) Update(v float64) {
+	if v > 0 {
+		c.count.Update(v)
+	}
+}
+
+// Snapshot returns the total accumulated since the start time.
+func (c *CumulativeCounter) Snapshot() float64 {
+	delta := c.count.Snapshot()
+	atomicAddFloat64(&c.total, delta)
+	atomic.StoreUint64(&c.delta, math.Float64bits(delta))
+	return math.Float64frombits(atomic.LoadUint64(&c.total))
+}
+
+// StartTime returns the time the counter was created.
+func (c *CumulativeCounter) StartTime() time.Time {
+	return c.start
+}
+
+// Metadata implements Describer. The Delta is the change of
+// the total between the last two snapshots.
+func (c *CumulativeCounter) Metadata() Metadata {
+	return Metadata{
+		Kind:      KindCumulative,
+		StartTime: c.start,
+		Delta:     math.Float64frombits(atomic.LoadUint64(&c.delta)),
+	}
+}
+
+func (c *CumulativeCounter) retain() {}
+
+// --------------------------------------------------------------------
+
 // Rate tracks the rate of values per second.
 type Rate struct {
 	time  int64
@@ -117,6 +206,13 @@ func (r *Rate) Snapshot() float64 {
 	return r.count.Snapshot() / dur.Seconds() * r.unit
 }
 
+// Metadata implements Describer.
+func (r *Rate) Metadata() Metadata {
+	return Metadata{Kind: KindRate}
+}
+
+func (r *Rate) updated() bool { return r.count.updated() }
+
 // --------------------------------------------------------------------
 
 // Derive tracks the rate of deltas per seconds.
@@ -153,24 +249,50 @@ func (d *Derive) Snapshot() float64 {
 	return d.rate.Snapshot()
 }
 
+// Metadata implements Describer.
+func (d *Derive) Metadata() Metadata {
+	return Metadata{Kind: KindRate}
+}
+
+func (d *Derive) updated() bool { return d.rate.updated() }
+
+// --------------------------------------------------------------------
+
 // Reservoir tracks a sample of values.
 type Reservoir struct {
+	updateFlag
+
 	hist *histogram.Histogram
+	size int
 	m    sync.Mutex
 }
 
-// --------------------------------------------------------------------
-
-// NewReservoir creates a new reservoir
+// NewReservoir creates a new reservoir with DefaultReservoirSize bins.
 func NewReservoir() *Reservoir {
-	return &Reservoir{
-		hist: newHistogram(defaultHistogramSize),
+	return NewReservoirSize(DefaultReservoirSize)
+}
+
+// NewReservoirSize creates a new reservoir with up to size bins. Larger
+// sizes yield more accurate quantiles at the cost of memory and CPU.
+// A size < 1 uses DefaultReservoirSize.
+func NewReservoirSize(size int) *Reservoir {
+	r := new(Reservoir)
+	r.init(size)
+	return r
+}
+
+func (r *Reservoir) init(size int) {
+	if size < 1 {
+		size = DefaultReservoirSize
 	}
+	r.size = size
+	r.hist = newHistogram(size)
 }
 
 // Update fills the sample randomly with given value,
 // for reference, see: http://en.wikipedia.org/wiki/Reservoir_sampling
 func (r *Reservoir) Update(v float64) {
+	r.mark()
 	r.m.Lock()
 	r.hist.Add(v)
 	r.m.Unlock()
@@ -178,18 +300,48 @@ func (r *Reservoir) Update(v float64) {
 
 // Snapshot returns a Distribution
 func (r *Reservoir) Snapshot() Distribution {
-	h := newHistogram(defaultHistogramSize)
+	h := newHistogram(r.size)
 	r.m.Lock()
 	h = r.hist.Copy(h)
 	r.m.Unlock()
 	return h
 }
 
+// Reset returns a Distribution and resets the sample.
+func (r *Reservoir) Reset() Distribution {
+	h := newHistogram(r.size)
+	r.m.Lock()
+	h, r.hist = r.hist, h
+	r.m.Unlock()
+	return h
+}
+
+// Merge merges the observations of x into r.
+func (r *Reservoir) Merge(x *Reservoir) {
+	r.merge(x, 1)
+}
+
+// merge merges the observations of x, multiplied by factor, into r.
+func (r *Reservoir) merge(x *Reservoir, factor float64) {
+	if r == x {
+		return
+	}
+
+	d := x.Snapshot()
+	defer releaseDistribution(d)
+
+	r.mark()
+	r.m.Lock()
+	addDistribution(r.hist, scaleDistribution(d, factor))
+	r.m.Unlock()
+}
+
 // --------------------------------------------------------------------
 
 // Gauge tracks a value.
 type Gauge struct {
 	value uint64
+	updateFlag
 }
 
 // NewGauge creates a new Gauge
@@ -199,6 +351,7 @@ func NewGauge() *Gauge {
 
 // Update updates the current stored value.
 func (g *Gauge) Update(v float64) {
+	g.mark()
 	atomic.StoreUint64(&g.value, math.Float64bits(v))
 }
 
@@ -210,21 +363,53 @@ func (g *Gauge) Snapshot() float64 {
 
 // --------------------------------------------------------------------
 
+// GaugeFunc is a gauge which observes its value at flush time, by calling
+// the function. It is retained by the registry across flushes, even if the
+// registry is not persistent.
+type GaugeFunc func() float64
+
+// Snapshot calls f and returns the observed value.
+func (f GaugeFunc) Snapshot() float64 {
+	return f()
+}
+
+func (GaugeFunc) retain() {}
+
+// --------------------------------------------------------------------
+
 // Timer tracks durations.
 type Timer struct {
-	r Reservoir
+	r    Reservoir
+	unit time.Duration
 }
 
 // NewTimer creates a new Timer with millisecond resolution
 func NewTimer() *Timer {
-	return &Timer{
-		r: Reservoir{hist: newHistogram(defaultHistogramSize)},
+	return NewTimerUnit(DefaultReservoirSize, time.Millisecond)
+}
+
+// NewTimerSize creates a new Timer with millisecond resolution and
+// up to size bins. A size < 1 uses DefaultReservoirSize.
+func NewTimerSize(size int) *Timer {
+	return NewTimerUnit(size, time.Millisecond)
+}
+
+// NewTimerUnit creates a new Timer with up to size bins which records
+// durations as multiples of unit, e.g. time.Microsecond. A unit <= 0
+// uses milliseconds.
+func NewTimerUnit(size int, unit time.Duration) *Timer {
+	if unit <= 0 {
+		unit = time.Millisecond
 	}
+
+	t := &Timer{unit: unit}
+	t.r.init(size)
+	return t
 }
 
-// Update adds duration to the sample in ms.
+// Update adds duration to the sample, in the timer's unit.
 func (t *Timer) Update(d time.Duration) {
-	t.r.Update(d.Seconds() * 1000)
+	t.r.Update(float64(d) / float64(t.unit))
 }
 
 // Snapshot returns durations distribution
@@ -232,6 +417,24 @@ func (t *Timer) Snapshot() Distribution {
 	return t.r.Snapshot()
 }
 
+// Reset returns durations distribution and resets the sample.
+func (t *Timer) Reset() Distribution {
+	return t.r.Reset()
+}
+
+// Merge merges the durations of x into t, converting
+// them to the unit of t.
+func (t *Timer) Merge(x *Timer) {
+	t.r.merge(&x.r, float64(x.unit)/float64(t.unit))
+}
+
+func (t *Timer) updated() bool { return t.r.updated() }
+
+// Metadata implements Describer.
+func (t *Timer) Metadata() Metadata {
+	return Metadata{Kind: KindDistribution, Unit: durationUnit(t.unit)}
+}
+
 // Since records duration since the given start time.
 func (t *Timer) Since(start time.Time) {
 	t.Update(time.Since(start))
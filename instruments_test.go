@@ -48,6 +48,22 @@ var _ = ginkgo.Describe("Instruments", func() {
 		Expect(c.Snapshot()).To(Equal(2000.0))
 	})
 
+	ginkgo.It("should update cumulative counters", func() {
+		c := NewCumulativeCounter()
+		c.Update(12)
+		c.Update(-3)
+		c.Update(5)
+		Expect(c.Snapshot()).To(Equal(17.0))
+		Expect(c.Metadata().Delta).To(Equal(17.0))
+
+		c.Update(3)
+		Expect(c.Snapshot()).To(Equal(20.0))
+		Expect(c.Metadata().Delta).To(Equal(3.0))
+		Expect(c.Snapshot()).To(Equal(20.0))
+		Expect(c.Metadata()).To(Equal(Metadata{Kind: KindCumulative, StartTime: c.StartTime()}))
+		Expect(c.StartTime()).To(BeTemporally("~", time.Now(), time.Second))
+	})
+
 	ginkgo.It("should update gauges", func() {
 		g := NewGauge()
 		g.Update(7)
@@ -106,12 +122,73 @@ var _ = ginkgo.Describe("Instruments", func() {
 		Expect(r.Snapshot().Mean()).To(BeNumerically("~", 4.67, 0.01))
 	})
 
+	ginkgo.It("should reset reservoirs", func() {
+		r := NewReservoir()
+		r.Update(1)
+		r.Update(3)
+		Expect(r.Reset().Mean()).To(Equal(2.0))
+		Expect(r.Snapshot().Count()).To(Equal(0))
+
+		r.Update(5)
+		Expect(r.Reset().Mean()).To(Equal(5.0))
+	})
+
 	ginkgo.It("should update reservoirs atomically", func() {
 		r := NewReservoir()
 		updateInParallel(r)
 		Expect(r.Snapshot().Mean()).To(BeNumerically("==", 1.0))
 	})
 
+	ginkgo.It("should configure reservoir sizes", func() {
+		large, small := NewReservoirSize(200), NewReservoirSize(8)
+		for i := 0; i < 1000; i++ {
+			large.Update(float64(i))
+			small.Update(float64(i))
+		}
+
+		// cycle pooled histograms between sizes
+		for i := 0; i < 3; i++ {
+			releaseDistribution(large.Snapshot())
+			Expect(small.Snapshot().NumBins()).To(Equal(8))
+			releaseDistribution(small.Snapshot())
+			Expect(large.Snapshot().NumBins()).To(Equal(200))
+		}
+
+		Expect(large.Reset().NumBins()).To(Equal(200))
+		Expect(small.Reset().NumBins()).To(Equal(8))
+		for i := 0; i < 1000; i++ {
+			large.Update(float64(i))
+			small.Update(float64(i))
+		}
+		Expect(large.Snapshot().NumBins()).To(Equal(200))
+		Expect(small.Snapshot().NumBins()).To(Equal(8))
+
+		Expect(NewReservoirSize(0).size).To(Equal(DefaultReservoirSize))
+		Expect(NewTimerSize(64).r.size).To(Equal(64))
+
+		reg := NewUnstarted("")
+		Expect(reg.ReservoirSize("r", nil, 50).size).To(Equal(50))
+		Expect(reg.TimerSize("t", nil, 50).r.size).To(Equal(50))
+	})
+
+	ginkgo.It("should merge reservoirs", func() {
+		r1, r2 := NewReservoir(), NewReservoir()
+		for i := 0; i < 50; i++ {
+			r1.Update(float64(i))
+			r2.Update(float64(i + 50))
+		}
+		r1.Merge(r2)
+		r1.Merge(r1)
+
+		s := r1.Snapshot()
+		Expect(s.Count()).To(Equal(100))
+		Expect(s.Min()).To(Equal(0.0))
+		Expect(s.Max()).To(Equal(99.0))
+		Expect(s.Mean()).To(BeNumerically("~", 49.5, 0.5))
+		Expect(s.Quantile(0.5)).To(BeNumerically("~", 49.5, 2))
+		Expect(r2.Snapshot().Count()).To(Equal(50))
+	})
+
 	ginkgo.It("should update timers", func() {
 		t := NewTimer()
 		for i := 0; i < 100; i++ {
@@ -121,6 +198,46 @@ var _ = ginkgo.Describe("Instruments", func() {
 		Expect(s.Mean()).To(BeNumerically("~", 49.5, 0.01))
 		Expect(s.Quantile(0.75)).To(BeNumerically("~", 74.5, 0.01))
 	})
+
+	ginkgo.It("should record timer units", func() {
+		t := NewTimerUnit(0, time.Microsecond)
+		t.Update(1500 * time.Nanosecond)
+		t.Update(2500 * time.Nanosecond)
+		Expect(t.Snapshot().Mean()).To(Equal(2.0))
+		Expect(t.Metadata()).To(Equal(Metadata{Kind: KindDistribution, Unit: "us"}))
+
+		Expect(NewTimer().Metadata().Unit).To(Equal("ms"))
+		Expect(NewTimerUnit(0, 0).Metadata().Unit).To(Equal("ms"))
+		Expect(NewTimerUnit(0, time.Second).Metadata().Unit).To(Equal("s"))
+		Expect(NewTimerUnit(0, time.Nanosecond).Metadata().Unit).To(Equal("ns"))
+		Expect(NewTimerUnit(0, 10*time.Millisecond).Metadata().Unit).To(Equal(""))
+
+		reg := NewUnstarted("")
+		Expect(reg.TimerUnit("t", nil, 0, time.Second).Metadata().Unit).To(Equal("s"))
+	})
+
+	ginkgo.It("should merge timers", func() {
+		t1, t2 := NewTimer(), NewTimer()
+		t1.Update(time.Millisecond)
+		t2.Update(3 * time.Millisecond)
+		t1.Merge(t2)
+
+		s := t1.Snapshot()
+		Expect(s.Count()).To(Equal(2))
+		Expect(s.Mean()).To(Equal(2.0))
+
+		// convert units
+		t3 := NewTimerUnit(0, time.Microsecond)
+		t3.Update(5 * time.Millisecond)
+		t3.Update(7 * time.Millisecond)
+		t1.Merge(t3)
+
+		s = t1.Snapshot()
+		Expect(s.Count()).To(Equal(4))
+		Expect(s.Min()).To(Equal(1.0))
+		Expect(s.Max()).To(Equal(7.0))
+		Expect(s.Mean()).To(Equal(4.0))
+	})
 })
 
 // --------------------------------------------------------------------
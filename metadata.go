@@ -0,0 +1,130 @@
+package instruments
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Kind describes the semantics of the values reported by an instrument.
+type Kind uint8
+
+const (
+	// KindGauge values represent the last observed value.
+	KindGauge Kind = iota
+	// KindCounter values represent the delta accumulated over the last interval.
+	KindCounter
+	// KindRate values represent the rate of change over the last interval.
+	KindRate
+	// KindDistribution values represent a sampled distribution.
+	KindDistribution
+	// KindCumulative values represent a monotonic total, accumulated
+	// since Metadata.StartTime.
+	KindCumulative
+)
+
+// String returns the kind name.
+func (k Kind) String() string {
+	switch k {
+	case KindGauge:
+		return "gauge"
+	case KindCounter:
+		return "counter"
+	case KindRate:
+		return "rate"
+	case KindDistribution:
+		return "distribution"
+	case KindCumulative:
+		return "cumulative"
+	}
+	return "unknown"
+}
+
+// Metadata describes an instrument.
+type Metadata struct {
+	// Kind is the instrument kind.
+	Kind Kind
+	// Unit is the unit of the reported values, using UCUM symbols,
+	// e.g. "ms" or "By". Empty if the values are unitless.
+	Unit string
+	// StartTime is the time since which KindCumulative values
+	// have been accumulated.
+	StartTime time.Time
+	// Delta is the change of a KindCumulative value since
+	// the previous snapshot.
+	Delta float64
+}
+
+// Describer is an optional interface which instruments can implement
+// to provide metadata to reporters. Discrete instruments which do not
+// implement it are described as gauges, Sample instruments as distributions.
+type Describer interface {
+	Metadata() Metadata
+}
+
+// MetadataReporter is an optional interface for reporters which accept
+// instrument metadata. When implemented, the registry calls
+// DiscreteWithMetadata and SampleWithMetadata instead of Discrete and Sample.
+type MetadataReporter interface {
+	Reporter
+	// DiscreteWithMetadata accepts a numeric value with name, (sorted) tags and metadata
+	DiscreteWithMetadata(name string, tags []string, meta Metadata, value float64) error
+	// SampleWithMetadata accepts a sampled distribution with name, (sorted) tags and metadata
+	SampleWithMetadata(name string, tags []string, meta Metadata, dist Distribution) error
+}
+
+// retainer is implemented by instruments which remain registered
+// across flushes, even if the registry is not persistent.
+type retainer interface {
+	retain()
+}
+
+// tracker is implemented by instruments which track updates. Persistent
+// registries evict such instruments once they have not been updated for
+// the configured TTL.
+type tracker interface {
+	updated() bool
+}
+
+// updateFlag records updates of an instrument.
+type updateFlag uint64
+
+// mark records an update.
+func (f *updateFlag) mark() {
+	if atomic.LoadUint64((*uint64)(f)) == 0 {
+		atomic.StoreUint64((*uint64)(f), 1)
+	}
+}
+
+// updated reports whether an update was recorded since the last call.
+func (f *updateFlag) updated() bool {
+	return atomic.SwapUint64((*uint64)(f), 0) != 0
+}
+
+// durationUnit returns the UCUM symbol of a duration unit.
+func durationUnit(d time.Duration) string {
+	switch d {
+	case time.Nanosecond:
+		return "ns"
+	case time.Microsecond:
+		return "us"
+	case time.Millisecond:
+		return "ms"
+	case time.Second:
+		return "s"
+	case time.Minute:
+		return "min"
+	case time.Hour:
+		return "h"
+	}
+	return ""
+}
+
+func metadataOf(inst interface{}) Metadata {
+	if d, ok := inst.(Describer); ok {
+		return d.Metadata()
+	}
+	if _, ok := inst.(Sample); ok {
+		return Metadata{Kind: KindDistribution}
+	}
+	return Metadata{Kind: KindGauge}
+}
@@ -0,0 +1,138 @@
+package instruments
+
+import (
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// meterTickInterval is the interval at which moving averages are updated.
+const meterTickInterval = 5 * time.Second
+
+// Meter tracks the count, the mean rate and the 1, 5 and 15-minute
+// exponentially weighted moving average rates of values per second,
+// similar to the load average of Unix systems.
+//
+// Moving averages are updated every 5s. Ticks are driven by Update and
+// Snapshot calls, no background goroutine is required. Meters report
+// several values under one name and are retained by the registry across
+// flushes, even if the registry is not persistent.
+type Meter struct {
+	uncounted Counter
+	lastTick  int64
+
+	start       time.Time
+	count       float64
+	reported    float64
+	m1, m5, m15 ewma
+	m           sync.Mutex
+}
+
+// NewMeter creates a new meter instrument.
+func NewMeter() *Meter {
+	now := time.Now()
+	return &Meter{
+		start:    now,
+		lastTick: now.UnixNano(),
+		m1:       newEWMA(time.Minute),
+		m5:       newEWMA(5 * time.Minute),
+		m15:      newEWMA(15 * time.Minute),
+	}
+}
+
+// Update adds v to the meter. Negative values are ignored.
+func (m *Meter) Update(v float64) {
+	m.update(v, time.Now().UnixNano())
+}
+
+func (m *Meter) update(v float64, now int64) {
+	if v > 0 {
+		m.tick(now)
+		m.uncounted.Update(v)
+	}
+}
+
+// Snapshot implements Compound. It returns the total count as a
+// cumulative value, followed by the mean, the 1, 5 and 15-minute rates.
+func (m *Meter) Snapshot() []Value {
+	return m.snapshot(time.Now().UnixNano())
+}
+
+func (m *Meter) snapshot(now int64) []Value {
+	m.tick(now)
+
+	m.m.Lock()
+	defer m.m.Unlock()
+
+	count := m.count + m.uncounted.current()
+	delta := count - m.reported
+	m.reported = count
+
+	mean := 0.0
+	if secs := time.Duration(now - m.start.UnixNano()).Seconds(); secs > 0 {
+		mean = count / secs
+	}
+
+	return []Value{
+		{Suffix: ".count", Value: count, Meta: Metadata{Kind: KindCumulative, StartTime: m.start, Delta: delta}},
+		{Suffix: ".mean_rate", Value: mean},
+		{Suffix: ".m1_rate", Value: m.m1.rate},
+		{Suffix: ".m5_rate", Value: m.m5.rate},
+		{Suffix: ".m15_rate", Value: m.m15.rate},
+	}
+}
+
+// tick updates the moving averages if one or more tick
+// intervals have elapsed since the last tick.
+func (m *Meter) tick(now int64) {
+	if now-atomic.LoadInt64(&m.lastTick) < int64(meterTickInterval) {
+		return
+	}
+
+	m.m.Lock()
+	defer m.m.Unlock()
+
+	last := atomic.LoadInt64(&m.lastTick)
+	ticks := (now - last) / int64(meterTickInterval)
+	if ticks < 1 {
+		return
+	}
+	atomic.StoreInt64(&m.lastTick, last+ticks*int64(meterTickInterval))
+
+	// values are attributed to the first elapsed tick,
+	// the remaining ones were idle
+	n := m.uncounted.Snapshot()
+	m.count += n
+
+	rate := n / meterTickInterval.Seconds()
+	m.m1.tick(rate, ticks)
+	m.m5.tick(rate, ticks)
+	m.m15.tick(rate, ticks)
+}
+
+func (m *Meter) retain() {}
+
+// --------------------------------------------------------------------
+
+type ewma struct {
+	alpha float64
+	rate  float64
+	init  bool
+}
+
+func newEWMA(window time.Duration) ewma {
+	return ewma{alpha: 1 - math.Exp(-meterTickInterval.Seconds()/window.Seconds())}
+}
+
+// tick applies rate, followed by n-1 idle ticks.
+func (e *ewma) tick(rate float64, n int64) {
+	if e.init {
+		e.rate += e.alpha * (rate - e.rate)
+	} else {
+		e.rate, e.init = rate, true
+	}
+	if n > 1 {
+		e.rate *= math.Pow(1-e.alpha, float64(n-1))
+	}
+}
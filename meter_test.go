@@ -0,0 +1,81 @@
+package instruments
+
+import (
+	"math"
+	"time"
+
+	"github.com/bsm/ginkgo/v2"
+	. "github.com/bsm/gomega"
+)
+
+var _ = ginkgo.Describe("Meter", func() {
+	var subject *Meter
+	var start int64
+
+	at := func(d time.Duration) int64 { return start + int64(d) }
+	rates := func(vals []Value) []float64 {
+		res := make([]float64, 0, len(vals))
+		for _, v := range vals {
+			res = append(res, v.Value)
+		}
+		return res
+	}
+
+	ginkgo.BeforeEach(func() {
+		subject = NewMeter()
+		start = subject.start.UnixNano()
+	})
+
+	ginkgo.It("should report count and rates", func() {
+		subject.update(10, at(time.Second))
+		subject.update(-1, at(2*time.Second))
+		subject.update(20, at(4*time.Second))
+
+		vals := subject.snapshot(at(5 * time.Second))
+		Expect(vals).To(HaveLen(5))
+		Expect(vals[0]).To(Equal(Value{
+			Suffix: ".count",
+			Value:  30,
+			Meta:   Metadata{Kind: KindCumulative, StartTime: subject.start, Delta: 30},
+		}))
+		Expect(vals[1].Suffix).To(Equal(".mean_rate"))
+		Expect(vals[2].Suffix).To(Equal(".m1_rate"))
+		Expect(vals[3].Suffix).To(Equal(".m5_rate"))
+		Expect(vals[4].Suffix).To(Equal(".m15_rate"))
+		Expect(rates(vals)).To(Equal([]float64{30, 6, 6, 6, 6}))
+
+		subject.update(5, at(6*time.Second))
+		vals = subject.snapshot(at(10 * time.Second))
+		Expect(vals[0].Value).To(Equal(35.0))
+		Expect(vals[0].Meta.Delta).To(Equal(5.0))
+		Expect(vals[1].Value).To(Equal(3.5))
+		Expect(vals[2].Value).To(BeNumerically("~", 5.600, 0.001))
+		Expect(vals[3].Value).To(BeNumerically("~", 5.917, 0.001))
+		Expect(vals[4].Value).To(BeNumerically("~", 5.972, 0.001))
+	})
+
+	ginkgo.It("should decay idle rates", func() {
+		subject.update(60, at(time.Second))
+		Expect(rates(subject.snapshot(at(5 * time.Second)))).To(Equal([]float64{60, 12, 12, 12, 12}))
+
+		vals := subject.snapshot(at(5*time.Second + time.Minute))
+		Expect(vals[2].Value).To(BeNumerically("~", 12*math.Exp(-1), 0.001))
+		Expect(vals[3].Value).To(BeNumerically("~", 12*math.Exp(-0.2), 0.001))
+		Expect(vals[4].Value).To(BeNumerically("~", 12*math.Exp(-1.0/15), 0.001))
+		Expect(vals[0].Meta.Delta).To(Equal(0.0))
+	})
+
+	ginkgo.It("should be retained by the registry", func() {
+		reporter := new(mockReporter)
+		r := NewUnstarted("")
+		r.Subscribe(reporter)
+
+		m := r.Meter("m", []string{"a"})
+		m.Update(3)
+		Expect(r.Flush()).To(Succeed())
+		Expect(reporter.Flushed).To(HaveKeyWithValue("m.count|a", 3.0))
+		Expect(reporter.Flushed).To(HaveKey("m.mean_rate|a"))
+		Expect(reporter.Flushed).To(HaveKey("m.m15_rate|a"))
+		Expect(r.Meter("m", []string{"a"})).To(BeIdenticalTo(m))
+	})
+})
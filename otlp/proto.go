@@ -0,0 +1,333 @@
+package otlp
+
+import (
+	"math"
+	"strconv"
+)
+
+// This file contains a minimal subset of the OTLP metrics data model,
+// see https://github.com/open-telemetry/opentelemetry-proto, along with
+// hand-written protobuf encoders, to avoid heavy dependencies.
+
+const (
+	temporalityDelta      = 1
+	temporalityCumulative = 2
+)
+
+type exportRequest struct {
+	ResourceMetrics []resourceMetrics `json:"resourceMetrics"`
+}
+
+func (m *exportRequest) appendProto(b []byte) []byte {
+	for i := range m.ResourceMetrics {
+		b = appendMessage(b, 1, m.ResourceMetrics[i].appendProto)
+	}
+	return b
+}
+
+type resourceMetrics struct {
+	Resource     resource       `json:"resource"`
+	ScopeMetrics []scopeMetrics `json:"scopeMetrics"`
+}
+
+func (m *resourceMetrics) appendProto(b []byte) []byte {
+	b = appendMessage(b, 1, m.Resource.appendProto)
+	for i := range m.ScopeMetrics {
+		b = appendMessage(b, 2, m.ScopeMetrics[i].appendProto)
+	}
+	return b
+}
+
+type resource struct {
+	Attributes []keyValue `json:"attributes,omitempty"`
+}
+
+func (m *resource) appendProto(b []byte) []byte {
+	return appendAttributes(b, 1, m.Attributes)
+}
+
+type scopeMetrics struct {
+	Scope   scope    `json:"scope"`
+	Metrics []metric `json:"metrics"`
+}
+
+func (m *scopeMetrics) appendProto(b []byte) []byte {
+	b = appendMessage(b, 1, m.Scope.appendProto)
+	for i := range m.Metrics {
+		b = appendMessage(b, 2, m.Metrics[i].appendProto)
+	}
+	return b
+}
+
+type scope struct {
+	Name string `json:"name"`
+}
+
+func (m *scope) appendProto(b []byte) []byte {
+	return appendString(b, 1, m.Name)
+}
+
+type metric struct {
+	Name      string     `json:"name"`
+	Unit      string     `json:"unit,omitempty"`
+	Gauge     *gauge     `json:"gauge,omitempty"`
+	Sum       *sum       `json:"sum,omitempty"`
+	Histogram *histogram `json:"histogram,omitempty"`
+	Summary   *summary   `json:"summary,omitempty"`
+}
+
+func (m *metric) appendProto(b []byte) []byte {
+	b = appendString(b, 1, m.Name)
+	b = appendString(b, 3, m.Unit)
+	switch {
+	case m.Gauge != nil:
+		b = appendMessage(b, 5, m.Gauge.appendProto)
+	case m.Sum != nil:
+		b = appendMessage(b, 7, m.Sum.appendProto)
+	case m.Histogram != nil:
+		b = appendMessage(b, 9, m.Histogram.appendProto)
+	case m.Summary != nil:
+		b = appendMessage(b, 11, m.Summary.appendProto)
+	}
+	return b
+}
+
+type gauge struct {
+	DataPoints []numberDataPoint `json:"dataPoints"`
+}
+
+func (m *gauge) appendProto(b []byte) []byte {
+	for i := range m.DataPoints {
+		b = appendMessage(b, 1, m.DataPoints[i].appendProto)
+	}
+	return b
+}
+
+type sum struct {
+	DataPoints             []numberDataPoint `json:"dataPoints"`
+	AggregationTemporality int               `json:"aggregationTemporality"`
+	IsMonotonic            bool              `json:"isMonotonic,omitempty"`
+}
+
+func (m *sum) appendProto(b []byte) []byte {
+	for i := range m.DataPoints {
+		b = appendMessage(b, 1, m.DataPoints[i].appendProto)
+	}
+	b = appendVarintField(b, 2, uint64(m.AggregationTemporality))
+	if m.IsMonotonic {
+		b = appendVarintField(b, 3, 1)
+	}
+	return b
+}
+
+type histogram struct {
+	DataPoints             []histogramDataPoint `json:"dataPoints"`
+	AggregationTemporality int                  `json:"aggregationTemporality"`
+}
+
+func (m *histogram) appendProto(b []byte) []byte {
+	for i := range m.DataPoints {
+		b = appendMessage(b, 1, m.DataPoints[i].appendProto)
+	}
+	return appendVarintField(b, 2, uint64(m.AggregationTemporality))
+}
+
+type summary struct {
+	DataPoints []summaryDataPoint `json:"dataPoints"`
+}
+
+func (m *summary) appendProto(b []byte) []byte {
+	for i := range m.DataPoints {
+		b = appendMessage(b, 1, m.DataPoints[i].appendProto)
+	}
+	return b
+}
+
+type numberDataPoint struct {
+	Attributes        []keyValue `json:"attributes,omitempty"`
+	StartTimeUnixNano uint64     `json:"startTimeUnixNano,string"`
+	TimeUnixNano      uint64     `json:"timeUnixNano,string"`
+	AsDouble          float64    `json:"asDouble"`
+}
+
+func (m *numberDataPoint) appendProto(b []byte) []byte {
+	b = appendFixed64Field(b, 2, m.StartTimeUnixNano)
+	b = appendFixed64Field(b, 3, m.TimeUnixNano)
+	b = appendDoubleField(b, 4, m.AsDouble)
+	return appendAttributes(b, 7, m.Attributes)
+}
+
+type histogramDataPoint struct {
+	Attributes        []keyValue `json:"attributes,omitempty"`
+	StartTimeUnixNano uint64     `json:"startTimeUnixNano,string"`
+	TimeUnixNano      uint64     `json:"timeUnixNano,string"`
+	Count             uint64     `json:"count,string"`
+	Sum               float64    `json:"sum"`
+	BucketCounts      uint64s    `json:"bucketCounts"`
+	ExplicitBounds    []float64  `json:"explicitBounds"`
+	Min               float64    `json:"min"`
+	Max               float64    `json:"max"`
+}
+
+func (m *histogramDataPoint) appendProto(b []byte) []byte {
+	b = appendFixed64Field(b, 2, m.StartTimeUnixNano)
+	b = appendFixed64Field(b, 3, m.TimeUnixNano)
+	b = appendFixed64Field(b, 4, m.Count)
+	b = appendDoubleField(b, 5, m.Sum)
+	if len(m.BucketCounts) != 0 {
+		b = appendTag(b, 6, wireBytes)
+		b = appendVarint(b, uint64(8*len(m.BucketCounts)))
+		for _, v := range m.BucketCounts {
+			b = appendFixed64(b, v)
+		}
+	}
+	if len(m.ExplicitBounds) != 0 {
+		b = appendTag(b, 7, wireBytes)
+		b = appendVarint(b, uint64(8*len(m.ExplicitBounds)))
+		for _, v := range m.ExplicitBounds {
+			b = appendFixed64(b, math.Float64bits(v))
+		}
+	}
+	b = appendAttributes(b, 9, m.Attributes)
+	b = appendDoubleField(b, 11, m.Min)
+	b = appendDoubleField(b, 12, m.Max)
+	return b
+}
+
+type summaryDataPoint struct {
+	Attributes        []keyValue        `json:"attributes,omitempty"`
+	StartTimeUnixNano uint64            `json:"startTimeUnixNano,string"`
+	TimeUnixNano      uint64            `json:"timeUnixNano,string"`
+	Count             uint64            `json:"count,string"`
+	Sum               float64           `json:"sum"`
+	QuantileValues    []valueAtQuantile `json:"quantileValues"`
+}
+
+func (m *summaryDataPoint) appendProto(b []byte) []byte {
+	b = appendFixed64Field(b, 2, m.StartTimeUnixNano)
+	b = appendFixed64Field(b, 3, m.TimeUnixNano)
+	b = appendFixed64Field(b, 4, m.Count)
+	b = appendFixed64Field(b, 5, math.Float64bits(m.Sum))
+	for i := range m.QuantileValues {
+		b = appendMessage(b, 6, m.QuantileValues[i].appendProto)
+	}
+	return appendAttributes(b, 7, m.Attributes)
+}
+
+type valueAtQuantile struct {
+	Quantile float64 `json:"quantile"`
+	Value    float64 `json:"value"`
+}
+
+func (m *valueAtQuantile) appendProto(b []byte) []byte {
+	b = appendFixed64Field(b, 1, math.Float64bits(m.Quantile))
+	b = appendFixed64Field(b, 2, math.Float64bits(m.Value))
+	return b
+}
+
+type keyValue struct {
+	Key   string   `json:"key"`
+	Value anyValue `json:"value"`
+}
+
+func (m *keyValue) appendProto(b []byte) []byte {
+	b = appendString(b, 1, m.Key)
+	b = appendMessage(b, 2, m.Value.appendProto)
+	return b
+}
+
+type anyValue struct {
+	StringValue string `json:"stringValue"`
+}
+
+func (m *anyValue) appendProto(b []byte) []byte {
+	return appendString(b, 1, m.StringValue)
+}
+
+// uint64s encodes as a list of strings in JSON, as required by OTLP/JSON.
+type uint64s []uint64
+
+func (s uint64s) MarshalJSON() ([]byte, error) {
+	b := []byte{'['}
+	for i, v := range s {
+		if i != 0 {
+			b = append(b, ',')
+		}
+		b = append(b, '"')
+		b = strconv.AppendUint(b, v, 10)
+		b = append(b, '"')
+	}
+	return append(b, ']'), nil
+}
+
+// --------------------------------------------------------------------
+
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+)
+
+func appendTag(b []byte, field, wire int) []byte {
+	return appendVarint(b, uint64(field<<3|wire))
+}
+
+func appendVarint(b []byte, v uint64) []byte {
+	for v >= 0x80 {
+		b = append(b, byte(v)|0x80)
+		v >>= 7
+	}
+	return append(b, byte(v))
+}
+
+func appendVarintField(b []byte, field int, v uint64) []byte {
+	if v == 0 {
+		return b
+	}
+	b = appendTag(b, field, wireVarint)
+	return appendVarint(b, v)
+}
+
+func appendFixed64Field(b []byte, field int, v uint64) []byte {
+	if v == 0 {
+		return b
+	}
+	b = appendTag(b, field, wireFixed64)
+	return appendFixed64(b, v)
+}
+
+// appendDoubleField appends v even if zero, for fields with explicit presence.
+func appendDoubleField(b []byte, field int, v float64) []byte {
+	b = appendTag(b, field, wireFixed64)
+	return appendFixed64(b, math.Float64bits(v))
+}
+
+func appendFixed64(b []byte, v uint64) []byte {
+	return append(b,
+		byte(v), byte(v>>8), byte(v>>16), byte(v>>24),
+		byte(v>>32), byte(v>>40), byte(v>>48), byte(v>>56),
+	)
+}
+
+func appendString(b []byte, field int, s string) []byte {
+	if s == "" {
+		return b
+	}
+	b = appendTag(b, field, wireBytes)
+	b = appendVarint(b, uint64(len(s)))
+	return append(b, s...)
+}
+
+func appendMessage(b []byte, field int, fn func([]byte) []byte) []byte {
+	msg := fn(nil)
+	b = appendTag(b, field, wireBytes)
+	b = appendVarint(b, uint64(len(msg)))
+	return append(b, msg...)
+}
+
+func appendAttributes(b []byte, field int, attrs []keyValue) []byte {
+	for i := range attrs {
+		b = appendMessage(b, field, attrs[i].appendProto)
+	}
+	return b
+}
@@ -0,0 +1,431 @@
+// Package otlp implements a reporter which exports metrics to an
+// OpenTelemetry collector via OTLP/HTTP.
+package otlp
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bsm/instruments"
+)
+
+var (
+	_ instruments.MetadataReporter   = (*Reporter)(nil)
+	_ instruments.GlobalTagsReporter = (*Reporter)(nil)
+)
+
+var timeNow = time.Now
+
+// DefaultURL is the default OTLP/HTTP metrics URL.
+const DefaultURL = "http://localhost:4318/v1/metrics"
+
+// ScopeName is the instrumentation scope name.
+const ScopeName = "github.com/bsm/instruments"
+
+// DefaultQuantiles are the quantiles exported for each summary.
+var DefaultQuantiles = []float64{0, 0.5, 0.9, 0.95, 0.99, 1}
+
+// Encoding is the payload encoding.
+type Encoding uint8
+
+const (
+	// Protobuf encodes payloads as binary protobuf.
+	Protobuf Encoding = iota
+	// JSON encodes payloads as OTLP/JSON.
+	JSON
+)
+
+// Reporter implements instruments.Reporter and exports metrics via OTLP/HTTP.
+//
+// Counters are exported as delta sums, all other discrete values as gauges.
+// Distributions are exported as summaries or, optionally, as histograms.
+// Metric names must be unique across kinds, values which are reported under
+// the name of a metric of a different kind are skipped and returned as an
+// error by Flush.
+type Reporter struct {
+	client *http.Client
+
+	// URL is the metrics URL to push data to.
+	// Default: DefaultURL
+	URL string
+
+	// Headers are added to each request, i.e. for authentication.
+	Headers http.Header
+
+	// Encoding is the payload encoding.
+	// Default: Protobuf
+	Encoding Encoding
+
+	// Disables gzip payload compression when
+	// POSTing data to the collector.
+	DisableCompression bool
+
+	// Resource holds "key:value" tags which are exported as resource
+	// attributes instead of data point attributes. The registry's
+	// global tags are added automatically.
+	Resource []string
+
+	// Histograms enables export of distributions as histograms,
+	// built from the distribution bins, instead of summaries.
+	Histograms bool
+
+	// Quantiles are exported for every summary.
+	// Default: DefaultQuantiles
+	Quantiles []float64
+
+	metrics   []metric
+	index     map[string]metricRef
+	conflicts []string
+	global    []string
+	startTime uint64
+	timestamp uint64
+}
+
+// New creates a new reporter.
+func New(url string) *Reporter {
+	return &Reporter{
+		client: &http.Client{
+			Transport: &http.Transport{
+				Proxy: http.ProxyFromEnvironment,
+				DialContext: (&net.Dialer{
+					Timeout:   30 * time.Second,
+					KeepAlive: 30 * time.Second,
+				}).DialContext,
+				TLSHandshakeTimeout:   10 * time.Second,
+				ExpectContinueTimeout: 1 * time.Second,
+			},
+			Timeout: time.Minute,
+		},
+		URL:       url,
+		Quantiles: DefaultQuantiles,
+		index:     make(map[string]metricRef),
+		timestamp: uint64(timeNow().UnixNano()),
+	}
+}
+
+// SetGlobalTags implements instruments.GlobalTagsReporter.
+func (r *Reporter) SetGlobalTags(tags []string) {
+	r.global = append(r.global[:0], tags...)
+}
+
+// Prep implements instruments.Reporter
+func (r *Reporter) Prep() error {
+	r.startTime, r.timestamp = r.timestamp, uint64(timeNow().UnixNano())
+	r.metrics = r.metrics[:0]
+	r.conflicts = r.conflicts[:0]
+	for k := range r.index {
+		delete(r.index, k)
+	}
+	return nil
+}
+
+// Discrete implements instruments.Reporter
+func (r *Reporter) Discrete(name string, tags []string, val float64) error {
+	return r.DiscreteWithMetadata(name, tags, instruments.Metadata{Kind: instruments.KindGauge}, val)
+}
+
+// DiscreteWithMetadata implements instruments.MetadataReporter
+func (r *Reporter) DiscreteWithMetadata(name string, tags []string, meta instruments.Metadata, val float64) error {
+	point := numberDataPoint{
+		Attributes:        r.attributes(tags),
+		StartTimeUnixNano: r.startTime,
+		TimeUnixNano:      r.timestamp,
+		AsDouble:          val,
+	}
+
+	if meta.Kind == instruments.KindCounter {
+		m := r.fetch(name, meta.Kind, meta.Unit)
+		if m == nil {
+			return nil
+		}
+		if m.Sum == nil {
+			m.Sum = &sum{AggregationTemporality: temporalityDelta}
+		}
+		m.Sum.DataPoints = append(m.Sum.DataPoints, point)
+		return nil
+	}
+
+	if meta.Kind == instruments.KindCumulative {
+		m := r.fetch(name, meta.Kind, meta.Unit)
+		if m == nil {
+			return nil
+		}
+		if m.Sum == nil {
+			m.Sum = &sum{AggregationTemporality: temporalityCumulative, IsMonotonic: true}
+		}
+		if !meta.StartTime.IsZero() {
+			point.StartTimeUnixNano = uint64(meta.StartTime.UnixNano())
+		}
+		m.Sum.DataPoints = append(m.Sum.DataPoints, point)
+		return nil
+	}
+
+	m := r.fetch(name, instruments.KindGauge, meta.Unit)
+	if m == nil {
+		return nil
+	}
+	if m.Gauge == nil {
+		m.Gauge = new(gauge)
+	}
+	m.Gauge.DataPoints = append(m.Gauge.DataPoints, point)
+	return nil
+}
+
+// Sample implements instruments.Reporter
+func (r *Reporter) Sample(name string, tags []string, dist instruments.Distribution) error {
+	return r.SampleWithMetadata(name, tags, instruments.Metadata{Kind: instruments.KindDistribution}, dist)
+}
+
+// SampleWithMetadata implements instruments.MetadataReporter
+func (r *Reporter) SampleWithMetadata(name string, tags []string, meta instruments.Metadata, dist instruments.Distribution) error {
+	m := r.fetch(name, instruments.KindDistribution, meta.Unit)
+	if m == nil {
+		return nil
+	}
+	attrs := r.attributes(tags)
+
+	if r.Histograms {
+		if m.Histogram == nil {
+			m.Histogram = &histogram{AggregationTemporality: temporalityDelta}
+		}
+		point := histogramDataPoint{
+			Attributes:        attrs,
+			StartTimeUnixNano: r.startTime,
+			TimeUnixNano:      r.timestamp,
+			Count:             uint64(dist.Count()),
+			Sum:               dist.Sum(),
+			Min:               dist.Min(),
+			Max:               dist.Max(),
+		}
+		point.ExplicitBounds, point.BucketCounts = histogramBuckets(dist, point.Count)
+		m.Histogram.DataPoints = append(m.Histogram.DataPoints, point)
+		return nil
+	}
+
+	if m.Summary == nil {
+		m.Summary = new(summary)
+	}
+	point := summaryDataPoint{
+		Attributes:        attrs,
+		StartTimeUnixNano: r.startTime,
+		TimeUnixNano:      r.timestamp,
+		Count:             uint64(dist.Count()),
+		Sum:               dist.Sum(),
+		QuantileValues:    make([]valueAtQuantile, 0, len(r.Quantiles)),
+	}
+	for _, q := range r.Quantiles {
+		point.QuantileValues = append(point.QuantileValues, valueAtQuantile{Quantile: q, Value: dist.Quantile(q)})
+	}
+	m.Summary.DataPoints = append(m.Summary.DataPoints, point)
+	return nil
+}
+
+// Flush implements instruments.Reporter
+func (r *Reporter) Flush() error {
+	if len(r.metrics) != 0 {
+		req := exportRequest{
+			ResourceMetrics: []resourceMetrics{{
+				Resource: resource{Attributes: r.resourceAttributes()},
+				ScopeMetrics: []scopeMetrics{{
+					Scope:   scope{Name: ScopeName},
+					Metrics: r.metrics,
+				}},
+			}},
+		}
+		if err := r.post(&req); err != nil {
+			return err
+		}
+	}
+
+	if len(r.conflicts) != 0 {
+		return fmt.Errorf("otlp: skipped values of metrics with conflicting kinds: %s", strings.Join(r.conflicts, ", "))
+	}
+	return nil
+}
+
+func (r *Reporter) post(req *exportRequest) error {
+	var payload []byte
+	var contentType string
+	if r.Encoding == JSON {
+		data, err := json.Marshal(req)
+		if err != nil {
+			return err
+		}
+		payload, contentType = data, "application/json"
+	} else {
+		payload, contentType = req.appendProto(nil), "application/x-protobuf"
+	}
+
+	var body io.Reader = bytes.NewReader(payload)
+	if !r.DisableCompression {
+		buf := new(bytes.Buffer)
+		gzw := gzip.NewWriter(buf)
+		if _, err := gzw.Write(payload); err != nil {
+			return err
+		}
+		if err := gzw.Close(); err != nil {
+			return err
+		}
+		body = buf
+	}
+
+	httpReq, err := http.NewRequest("POST", r.URL, body)
+	if err != nil {
+		return err
+	}
+	for key, vv := range r.Headers {
+		httpReq.Header[key] = vv
+	}
+	httpReq.Header.Set("Content-Type", contentType)
+	if !r.DisableCompression {
+		httpReq.Header.Set("Content-Encoding", "gzip")
+	}
+
+	resp, err := r.client.Do(httpReq)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+	return fmt.Errorf("otlp: bad collector response: %s", resp.Status)
+}
+
+// fetch returns the metric with the given name or creates a new one. It
+// returns nil if the name is already used by a metric of a different kind.
+func (r *Reporter) fetch(name string, kind instruments.Kind, unit string) *metric {
+	if ref, ok := r.index[name]; ok {
+		if ref.Kind != kind {
+			if !containsString(r.conflicts, name) {
+				r.conflicts = append(r.conflicts, name)
+			}
+			return nil
+		}
+		return &r.metrics[ref.Pos]
+	}
+
+	r.index[name] = metricRef{Pos: len(r.metrics), Kind: kind}
+	r.metrics = append(r.metrics, metric{Name: name, Unit: unit})
+	return &r.metrics[len(r.metrics)-1]
+}
+
+// resourceAttributes returns the attributes of the resource tags and
+// the registry's global tags.
+func (r *Reporter) resourceAttributes() []keyValue {
+	tags := append([]string(nil), r.Resource...)
+	for _, tag := range r.global {
+		if !containsString(tags, tag) {
+			tags = append(tags, tag)
+		}
+	}
+	return parseAttributes(tags)
+}
+
+// attributes converts tags into attributes, skipping resource tags.
+func (r *Reporter) attributes(tags []string) []keyValue {
+	if len(r.Resource) == 0 && len(r.global) == 0 {
+		return parseAttributes(tags)
+	}
+
+	filtered := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		if !containsString(r.Resource, tag) && !containsString(r.global, tag) {
+			filtered = append(filtered, tag)
+		}
+	}
+	return parseAttributes(filtered)
+}
+
+// --------------------------------------------------------------------
+
+type metricRef struct {
+	Pos  int
+	Kind instruments.Kind
+}
+
+// parseAttributes converts "key:value" tags into attributes, sorted by key.
+// Tags without a value are converted to key=true.
+func parseAttributes(tags []string) []keyValue {
+	if len(tags) == 0 {
+		return nil
+	}
+
+	attrs := make([]keyValue, 0, len(tags))
+	for _, tag := range tags {
+		key, val := tag, "true"
+		if pos := strings.IndexByte(tag, ':'); pos > -1 {
+			key, val = tag[:pos], tag[pos+1:]
+		}
+		if key == "" {
+			continue
+		}
+		attrs = append(attrs, keyValue{Key: key, Value: anyValue{StringValue: val}})
+	}
+	sort.SliceStable(attrs, func(i, j int) bool { return attrs[i].Key < attrs[j].Key })
+	return attrs
+}
+
+// histogramBuckets converts distribution bins into explicit bucket
+// boundaries and counts. Fixed histogram buckets are exported as they are,
+// for other distributions boundaries are placed at the midpoints between
+// adjacent bin values. Bin weights are scaled and rounded cumulatively,
+// so that bucket counts add up to count.
+func histogramBuckets(dist instruments.Distribution, count uint64) ([]float64, uint64s) {
+	if s, ok := dist.(*instruments.HistogramSnapshot); ok {
+		return s.Bounds(), s.Counts()
+	}
+
+	n := dist.NumBins()
+	if n == 0 {
+		if count == 0 {
+			return nil, nil
+		}
+		return nil, uint64s{count}
+	}
+
+	var total float64
+	for i := 0; i < n; i++ {
+		_, weight := dist.Bin(i)
+		total += math.Abs(weight)
+	}
+
+	bounds := make([]float64, 0, n-1)
+	counts := make(uint64s, 0, n)
+	prev := math.NaN()
+	var cum float64
+	var done uint64
+	for i := 0; i < n; i++ {
+		value, weight := dist.Bin(i)
+		if i != 0 {
+			bounds = append(bounds, (prev+value)/2)
+		}
+
+		next := count
+		if cum += math.Abs(weight); total > 0 && i < n-1 {
+			next = uint64(math.Round(cum / total * float64(count)))
+		}
+		counts = append(counts, next-done)
+		done, prev = next, value
+	}
+	return bounds, counts
+}
+
+func containsString(slice []string, s string) bool {
+	for _, x := range slice {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,351 @@
+package otlp
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/bsm/ginkgo/v2"
+	. "github.com/bsm/gomega"
+	"github.com/bsm/instruments"
+)
+
+var _ = ginkgo.Describe("Reporter", func() {
+	var subject *Reporter
+
+	var server *httptest.Server
+	var last *mockServerRequest
+
+	counter := instruments.Metadata{Kind: instruments.KindCounter}
+	rate := instruments.Metadata{Kind: instruments.KindRate}
+
+	ginkgo.BeforeEach(func() {
+		last = new(mockServerRequest)
+		server = newMockServer(last)
+
+		subject = New(server.URL + "/v1/metrics")
+		subject.Encoding = JSON
+		subject.Quantiles = []float64{0.5, 0.99}
+		subject.Resource = []string{"host:test.host"}
+	})
+
+	ginkgo.AfterEach(func() {
+		server.Close()
+	})
+
+	ginkgo.It("should support reporter cycle", func() {
+		Expect(subject.Prep()).To(Succeed())
+		Expect(subject.DiscreteWithMetadata("cnt", []string{"b:2", "host:test.host"}, counter, 3)).To(Succeed())
+		Expect(subject.DiscreteWithMetadata("cnt", []string{"b:3", "host:test.host"}, counter, 4)).To(Succeed())
+		Expect(subject.DiscreteWithMetadata("rate", []string{"host:test.host"}, rate, 0)).To(Succeed())
+		Expect(subject.Discrete("gauge", []string{"flag"}, 1.5)).To(Succeed())
+		Expect(subject.Sample("tmr", []string{"a:1"}, mockDistribution{})).To(Succeed())
+		Expect(subject.Flush()).To(Succeed())
+
+		Expect(last.Path).To(Equal("/v1/metrics"))
+		Expect(last.ContentType).To(Equal("application/json"))
+		Expect(last.Body.Bytes()).To(MatchJSON(`{
+			"resourceMetrics": [{
+				"resource": {"attributes": [{"key": "host", "value": {"stringValue": "test.host"}}]},
+				"scopeMetrics": [{
+					"scope": {"name": "github.com/bsm/instruments"},
+					"metrics": [
+						{"name": "cnt", "sum": {"aggregationTemporality": 1, "dataPoints": [
+							{"attributes": [{"key": "b", "value": {"stringValue": "2"}}], "startTimeUnixNano": "1414141414000000000", "timeUnixNano": "1414141474000000000", "asDouble": 3},
+							{"attributes": [{"key": "b", "value": {"stringValue": "3"}}], "startTimeUnixNano": "1414141414000000000", "timeUnixNano": "1414141474000000000", "asDouble": 4}
+						]}},
+						{"name": "rate", "gauge": {"dataPoints": [
+							{"startTimeUnixNano": "1414141414000000000", "timeUnixNano": "1414141474000000000", "asDouble": 0}
+						]}},
+						{"name": "gauge", "gauge": {"dataPoints": [
+							{"attributes": [{"key": "flag", "value": {"stringValue": "true"}}], "startTimeUnixNano": "1414141414000000000", "timeUnixNano": "1414141474000000000", "asDouble": 1.5}
+						]}},
+						{"name": "tmr", "summary": {"dataPoints": [
+							{"attributes": [{"key": "a", "value": {"stringValue": "1"}}], "startTimeUnixNano": "1414141414000000000", "timeUnixNano": "1414141474000000000", "count": "3", "sum": 300.3, "quantileValues": [
+								{"quantile": 0.5, "value": 100.1},
+								{"quantile": 0.99, "value": 100.1}
+							]}
+						]}}
+					]
+				}]
+			}]
+		}`))
+	})
+
+	ginkgo.It("should export histograms", func() {
+		subject.Histograms = true
+
+		Expect(subject.Prep()).To(Succeed())
+		Expect(subject.Sample("tmr", nil, mockDistribution{})).To(Succeed())
+		Expect(subject.Flush()).To(Succeed())
+
+		Expect(last.Body.Bytes()).To(MatchJSON(`{
+			"resourceMetrics": [{
+				"resource": {"attributes": [{"key": "host", "value": {"stringValue": "test.host"}}]},
+				"scopeMetrics": [{
+					"scope": {"name": "github.com/bsm/instruments"},
+					"metrics": [
+						{"name": "tmr", "histogram": {"aggregationTemporality": 1, "dataPoints": [
+							{"startTimeUnixNano": "1414141414000000000", "timeUnixNano": "1414141474000000000", "count": "3", "sum": 300.3, "min": 0.1, "max": 200, "bucketCounts": ["1", "2"], "explicitBounds": [50]}
+						]}}
+					]
+				}]
+			}]
+		}`))
+	})
+
+	ginkgo.It("should export fixed histogram buckets", func() {
+		subject.Histograms = true
+
+		h := instruments.NewHistogram([]float64{1, 5, 10})
+		for _, v := range []float64{0.5, 2, 3, 12} {
+			h.Update(v)
+		}
+
+		Expect(subject.Prep()).To(Succeed())
+		Expect(subject.Sample("tmr", nil, h.Snapshot())).To(Succeed())
+		Expect(subject.Flush()).To(Succeed())
+
+		Expect(last.Body.Bytes()).To(MatchJSON(`{
+			"resourceMetrics": [{
+				"resource": {"attributes": [{"key": "host", "value": {"stringValue": "test.host"}}]},
+				"scopeMetrics": [{
+					"scope": {"name": "github.com/bsm/instruments"},
+					"metrics": [
+						{"name": "tmr", "histogram": {"aggregationTemporality": 1, "dataPoints": [
+							{"startTimeUnixNano": "1414141414000000000", "timeUnixNano": "1414141474000000000", "count": "4", "sum": 17.5, "min": 0.5, "max": 12, "bucketCounts": ["1", "2", "0", "1"], "explicitBounds": [1, 5, 10]}
+						]}}
+					]
+				}]
+			}]
+		}`))
+	})
+
+	ginkgo.It("should export cumulative sums", func() {
+		total := instruments.Metadata{Kind: instruments.KindCumulative, StartTime: time.Unix(1414141000, 0), Delta: 4}
+
+		Expect(subject.Prep()).To(Succeed())
+		Expect(subject.DiscreteWithMetadata("total", nil, total, 25)).To(Succeed())
+		Expect(subject.Flush()).To(Succeed())
+
+		Expect(last.Body.Bytes()).To(MatchJSON(`{
+			"resourceMetrics": [{
+				"resource": {"attributes": [{"key": "host", "value": {"stringValue": "test.host"}}]},
+				"scopeMetrics": [{
+					"scope": {"name": "github.com/bsm/instruments"},
+					"metrics": [
+						{"name": "total", "sum": {"aggregationTemporality": 2, "isMonotonic": true, "dataPoints": [
+							{"startTimeUnixNano": "1414141000000000000", "timeUnixNano": "1414141474000000000", "asDouble": 25}
+						]}}
+					]
+				}]
+			}]
+		}`))
+	})
+
+	ginkgo.It("should export units", func() {
+		subject.Histograms = true
+		timer := instruments.Metadata{Kind: instruments.KindDistribution, Unit: "s"}
+
+		Expect(subject.Prep()).To(Succeed())
+		Expect(subject.SampleWithMetadata("tmr", nil, timer, mockDistribution{})).To(Succeed())
+		Expect(subject.DiscreteWithMetadata("mem", nil, instruments.Metadata{Unit: "By"}, 5)).To(Succeed())
+		Expect(subject.Flush()).To(Succeed())
+
+		Expect(last.Body.Bytes()).To(MatchJSON(`{
+			"resourceMetrics": [{
+				"resource": {"attributes": [{"key": "host", "value": {"stringValue": "test.host"}}]},
+				"scopeMetrics": [{
+					"scope": {"name": "github.com/bsm/instruments"},
+					"metrics": [
+						{"name": "tmr", "unit": "s", "histogram": {"aggregationTemporality": 1, "dataPoints": [
+							{"startTimeUnixNano": "1414141414000000000", "timeUnixNano": "1414141474000000000", "count": "3", "sum": 300.3, "min": 0.1, "max": 200, "bucketCounts": ["1", "2"], "explicitBounds": [50]}
+						]}},
+						{"name": "mem", "unit": "By", "gauge": {"dataPoints": [
+							{"startTimeUnixNano": "1414141414000000000", "timeUnixNano": "1414141474000000000", "asDouble": 5}
+						]}}
+					]
+				}]
+			}]
+		}`))
+	})
+
+	ginkgo.It("should export registry tags as resource attributes", func() {
+		subject.Resource = nil
+
+		reg := instruments.NewUnstarted("", "host:web1", "env:prod")
+		reg.Subscribe(subject)
+		reg.Counter("cnt", []string{"b:2"}).Update(3)
+		Expect(reg.Flush()).To(Succeed())
+
+		Expect(last.Body.Bytes()).To(MatchJSON(`{
+			"resourceMetrics": [{
+				"resource": {"attributes": [
+					{"key": "env", "value": {"stringValue": "prod"}},
+					{"key": "host", "value": {"stringValue": "web1"}}
+				]},
+				"scopeMetrics": [{
+					"scope": {"name": "github.com/bsm/instruments"},
+					"metrics": [
+						{"name": "cnt", "sum": {"aggregationTemporality": 1, "dataPoints": [
+							{"attributes": [{"key": "b", "value": {"stringValue": "2"}}], "startTimeUnixNano": "1414141414000000000", "timeUnixNano": "1414141474000000000", "asDouble": 3}
+						]}}
+					]
+				}]
+			}]
+		}`))
+	})
+
+	ginkgo.It("should skip values of conflicting kinds", func() {
+		Expect(subject.Prep()).To(Succeed())
+		Expect(subject.DiscreteWithMetadata("x", nil, counter, 3)).To(Succeed())
+		Expect(subject.Discrete("x", nil, 1.5)).To(Succeed())
+		Expect(subject.Sample("x", nil, mockDistribution{})).To(Succeed())
+		Expect(subject.Flush()).To(MatchError("otlp: skipped values of metrics with conflicting kinds: x"))
+
+		Expect(last.Body.Bytes()).To(MatchJSON(`{
+			"resourceMetrics": [{
+				"resource": {"attributes": [{"key": "host", "value": {"stringValue": "test.host"}}]},
+				"scopeMetrics": [{
+					"scope": {"name": "github.com/bsm/instruments"},
+					"metrics": [
+						{"name": "x", "sum": {"aggregationTemporality": 1, "dataPoints": [
+							{"startTimeUnixNano": "1414141414000000000", "timeUnixNano": "1414141474000000000", "asDouble": 3}
+						]}}
+					]
+				}]
+			}]
+		}`))
+
+		Expect(subject.Prep()).To(Succeed())
+		Expect(subject.Discrete("x", nil, 1.5)).To(Succeed())
+		Expect(subject.Flush()).To(Succeed())
+	})
+
+	ginkgo.It("should match bucket counts to distribution counts", func() {
+		bounds, counts := histogramBuckets(mockDistribution{}, 3)
+		Expect(bounds).To(Equal([]float64{50}))
+		Expect(counts).To(Equal(uint64s{1, 2}))
+
+		_, counts = histogramBuckets(mockDistribution{}, 7)
+		Expect(counts).To(Equal(uint64s{2, 5}))
+
+		bounds, counts = histogramBuckets(emptyDistribution{}, 4)
+		Expect(bounds).To(BeEmpty())
+		Expect(counts).To(Equal(uint64s{4}))
+
+		_, counts = histogramBuckets(emptyDistribution{}, 0)
+		Expect(counts).To(BeEmpty())
+	})
+
+	ginkgo.It("should export protobuf", func() {
+		subject.Encoding = Protobuf
+		subject.Resource = nil
+
+		Expect(subject.Prep()).To(Succeed())
+		Expect(subject.Discrete("g", nil, 1)).To(Succeed())
+		Expect(subject.Flush()).To(Succeed())
+
+		Expect(last.ContentType).To(Equal("application/x-protobuf"))
+		Expect(last.Body.Len()).To(BeNumerically(">", 0))
+		Expect(last.Body.Bytes()).To(ContainSubstring("github.com/bsm/instruments"))
+	})
+
+	ginkgo.It("should skip empty cycles", func() {
+		Expect(subject.Prep()).To(Succeed())
+		Expect(subject.Flush()).To(Succeed())
+		Expect(last.Path).To(BeEmpty())
+	})
+
+	ginkgo.It("should encode protobuf", func() {
+		point := numberDataPoint{
+			Attributes:        []keyValue{{Key: "a", Value: anyValue{StringValue: "b"}}},
+			StartTimeUnixNano: 1,
+			TimeUnixNano:      2,
+			AsDouble:          1.5,
+		}
+		Expect(point.appendProto(nil)).To(Equal([]byte{
+			0x11, 1, 0, 0, 0, 0, 0, 0, 0,
+			0x19, 2, 0, 0, 0, 0, 0, 0, 0,
+			0x21, 0, 0, 0, 0, 0, 0, 0xf8, 0x3f,
+			0x3a, 8, 0x0a, 1, 'a', 0x12, 3, 0x0a, 1, 'b',
+		}))
+
+		point = numberDataPoint{}
+		Expect(point.appendProto(nil)).To(Equal([]byte{
+			0x21, 0, 0, 0, 0, 0, 0, 0, 0,
+		}))
+	})
+})
+
+// --------------------------------------------------------------------
+
+func TestSuite(t *testing.T) {
+	RegisterFailHandler(ginkgo.Fail)
+	ginkgo.RunSpecs(t, "instruments/otlp")
+}
+
+func init() {
+	var calls int64
+	timeNow = func() time.Time {
+		ts := time.Unix(1414141414+60*calls, 0)
+		calls = (calls + 1) % 2
+		return ts
+	}
+}
+
+type mockDistribution struct {
+	instruments.Distribution
+}
+
+func (mockDistribution) Count() int                 { return 3 }
+func (mockDistribution) Min() float64               { return 0.1 }
+func (mockDistribution) Max() float64               { return 200 }
+func (mockDistribution) Sum() float64               { return 300.3 }
+func (mockDistribution) Quantile(_ float64) float64 { return 100.1 }
+func (mockDistribution) NumBins() int               { return 2 }
+func (mockDistribution) Bin(i int) (float64, float64) {
+	if i == 0 {
+		return 0.1, 1
+	}
+	return 99.9, -2
+}
+
+type emptyDistribution struct {
+	instruments.Distribution
+}
+
+func (emptyDistribution) NumBins() int { return 0 }
+
+type mockServerRequest struct {
+	Path        string
+	ContentType string
+	Body        bytes.Buffer
+}
+
+func newMockServer(last *mockServerRequest) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+
+		last.Path = r.URL.Path
+		last.ContentType = r.Header.Get("Content-Type")
+		last.Body.Reset()
+
+		z, err := gzip.NewReader(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		defer z.Close()
+
+		if _, err := io.Copy(&last.Body, z); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+}
@@ -0,0 +1,391 @@
+// Package prometheus implements a pull-based reporter which exposes the
+// last flushed snapshot in the Prometheus text exposition format.
+package prometheus
+
+import (
+	"bytes"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/bsm/instruments"
+)
+
+var (
+	_ instruments.MetadataReporter = (*Reporter)(nil)
+	_ http.Handler                 = (*Reporter)(nil)
+)
+
+// ContentType is the content type of the text exposition format.
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// DefaultQuantiles are the quantiles exported for each distribution.
+var DefaultQuantiles = []float64{0.5, 0.9, 0.95, 0.99}
+
+// Reporter implements instruments.Reporter and http.Handler.
+// It keeps the last flushed snapshot and serves it to Prometheus scrapers.
+type Reporter struct {
+	// Quantiles are exported as summary quantiles for every distribution.
+	// Histograms and exponential histograms are exported with their
+	// cumulative buckets instead.
+	// Default: DefaultQuantiles
+	Quantiles []float64
+
+	// BaseUnits converts values into base units, as recommended by
+	// the Prometheus naming conventions, i.e. durations into seconds.
+	// The base unit is appended to the metric name, e.g. "_seconds".
+	// Default: false
+	BaseUnits bool
+
+	metrics []metric
+
+	snapshot []byte
+	mutex    sync.RWMutex
+}
+
+// New creates a new reporter.
+func New() *Reporter {
+	return &Reporter{Quantiles: DefaultQuantiles}
+}
+
+// Prep implements instruments.Reporter
+func (r *Reporter) Prep() error {
+	r.metrics = r.metrics[:0]
+	return nil
+}
+
+// Discrete implements instruments.Reporter
+func (r *Reporter) Discrete(name string, tags []string, val float64) error {
+	return r.discrete(name, tags, false, val)
+}
+
+// DiscreteWithMetadata implements instruments.MetadataReporter.
+// Cumulative values are exported as counters.
+func (r *Reporter) DiscreteWithMetadata(name string, tags []string, meta instruments.Metadata, val float64) error {
+	suffix, scale := r.baseUnit(name, meta.Unit)
+	return r.discrete(name+suffix, tags, meta.Kind == instruments.KindCumulative, val*scale)
+}
+
+func (r *Reporter) discrete(name string, tags []string, counter bool, val float64) error {
+	r.metrics = append(r.metrics, metric{
+		Name:    sanitizeName(name),
+		Labels:  formatLabels(tags),
+		Value:   val,
+		Counter: counter,
+	})
+	return nil
+}
+
+// Sample implements instruments.Reporter
+func (r *Reporter) Sample(name string, tags []string, dist instruments.Distribution) error {
+	return r.sample(name, tags, 1, dist)
+}
+
+// SampleWithMetadata implements instruments.MetadataReporter
+func (r *Reporter) SampleWithMetadata(name string, tags []string, meta instruments.Metadata, dist instruments.Distribution) error {
+	suffix, scale := r.baseUnit(name, meta.Unit)
+	return r.sample(name+suffix, tags, scale, dist)
+}
+
+func (r *Reporter) sample(name string, tags []string, scale float64, dist instruments.Distribution) error {
+	// distributions are released after the cycle, so materialise them now
+	if bounds, buckets := histogramBuckets(dist, scale); bounds != nil {
+		r.metrics = append(r.metrics, metric{
+			Name:      sanitizeName(name),
+			Labels:    formatLabels(tags),
+			Histogram: true,
+			Bounds:    bounds,
+			Buckets:   buckets,
+			Sum:       dist.Sum() * scale,
+			Count:     dist.Count(),
+		})
+		return nil
+	}
+
+	quantiles := make([]float64, len(r.Quantiles))
+	for i, q := range r.Quantiles {
+		quantiles[i] = dist.Quantile(q) * scale
+	}
+
+	r.metrics = append(r.metrics, metric{
+		Name:      sanitizeName(name),
+		Labels:    formatLabels(tags),
+		Summary:   true,
+		Quantiles: quantiles,
+		Sum:       dist.Sum() * scale,
+		Count:     dist.Count(),
+	})
+	return nil
+}
+
+// baseUnit returns the name suffix and the scale factor
+// to convert values of unit into base units.
+func (r *Reporter) baseUnit(name, unit string) (string, float64) {
+	if !r.BaseUnits {
+		return "", 1
+	}
+
+	suffix, scale := "", 1.0
+	switch unit {
+	case "ns":
+		suffix, scale = "_seconds", 1e-9
+	case "us":
+		suffix, scale = "_seconds", 1e-6
+	case "ms":
+		suffix, scale = "_seconds", 1e-3
+	case "s":
+		suffix = "_seconds"
+	case "min":
+		suffix, scale = "_seconds", 60
+	case "h":
+		suffix, scale = "_seconds", 3600
+	case "By":
+		suffix = "_bytes"
+	}
+	if strings.HasSuffix(name, suffix) {
+		suffix = ""
+	}
+	return suffix, scale
+}
+
+// Flush implements instruments.Reporter
+func (r *Reporter) Flush() error {
+	sort.SliceStable(r.metrics, func(i, j int) bool {
+		if r.metrics[i].Name != r.metrics[j].Name {
+			return r.metrics[i].Name < r.metrics[j].Name
+		}
+		return r.metrics[i].Labels < r.metrics[j].Labels
+	})
+
+	buf := new(bytes.Buffer)
+	r.writeTo(buf)
+
+	r.mutex.Lock()
+	r.snapshot = buf.Bytes()
+	r.mutex.Unlock()
+	return nil
+}
+
+// ServeHTTP implements http.Handler.
+func (r *Reporter) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	r.mutex.RLock()
+	snapshot := r.snapshot
+	r.mutex.RUnlock()
+
+	w.Header().Set("Content-Type", ContentType)
+	_, _ = w.Write(snapshot)
+}
+
+func (r *Reporter) writeTo(buf *bytes.Buffer) {
+	var family, typ string
+
+	for _, m := range r.metrics {
+		if m.Name == "" {
+			continue
+		}
+
+		if m.Name != family {
+			family, typ = m.Name, m.typ()
+
+			buf.WriteString("# TYPE ")
+			buf.WriteString(m.Name)
+			buf.WriteByte(' ')
+			buf.WriteString(typ)
+			buf.WriteByte('\n')
+		} else if m.typ() != typ {
+			// skip metrics which conflict with the type of their family
+			continue
+		}
+
+		if m.Histogram {
+			for i, b := range m.Bounds {
+				extra := `le="` + formatFloat(b) + `"`
+				writeSample(buf, m.Name+"_bucket", m.Labels, extra, float64(m.Buckets[i]))
+			}
+			writeSample(buf, m.Name+"_bucket", m.Labels, `le="+Inf"`, float64(m.Count))
+			writeSample(buf, m.Name+"_sum", m.Labels, "", m.Sum)
+			writeSample(buf, m.Name+"_count", m.Labels, "", float64(m.Count))
+			continue
+		}
+
+		if !m.Summary {
+			writeSample(buf, m.Name, m.Labels, "", m.Value)
+			continue
+		}
+
+		for i, q := range r.Quantiles {
+			if i < len(m.Quantiles) {
+				extra := `quantile="` + formatFloat(q) + `"`
+				writeSample(buf, m.Name, m.Labels, extra, m.Quantiles[i])
+			}
+		}
+		writeSample(buf, m.Name+"_sum", m.Labels, "", m.Sum)
+		writeSample(buf, m.Name+"_count", m.Labels, "", float64(m.Count))
+	}
+}
+
+// --------------------------------------------------------------------
+
+type metric struct {
+	Name    string
+	Labels  string
+	Value   float64
+	Counter bool
+
+	Summary   bool
+	Quantiles []float64
+	Sum       float64
+	Count     int
+
+	Histogram bool
+	Bounds    []float64
+	Buckets   []uint64 // cumulative
+}
+
+func (m *metric) typ() string {
+	if m.Histogram {
+		return "histogram"
+	} else if m.Summary {
+		return "summary"
+	} else if m.Counter {
+		return "counter"
+	}
+	return "gauge"
+}
+
+// histogramBuckets returns the scaled upper bucket boundaries and the
+// cumulative bucket counts of fixed and exponential histograms. It
+// returns nil for other distributions, which are exported as summaries.
+func histogramBuckets(dist instruments.Distribution, scale float64) ([]float64, []uint64) {
+	switch s := dist.(type) {
+	case *instruments.HistogramSnapshot:
+		bounds := make([]float64, 0, len(s.Bounds()))
+		buckets := make([]uint64, 0, len(s.Bounds()))
+		var cum uint64
+		for i, b := range s.Bounds() {
+			cum += s.Counts()[i]
+			bounds = append(bounds, b*scale)
+			buckets = append(buckets, cum)
+		}
+		return bounds, buckets
+	case *instruments.ExpHistogramSnapshot:
+		bounds := make([]float64, 0, s.NumBins())
+		buckets := make([]uint64, 0, s.NumBins())
+		var cum uint64
+		for i := 0; i < s.NumBins(); i++ {
+			_, hi := s.BinBounds(i)
+			_, weight := s.Bin(i)
+			cum += uint64(weight)
+			bounds = append(bounds, hi*scale)
+			buckets = append(buckets, cum)
+		}
+		return bounds, buckets
+	}
+	return nil, nil
+}
+
+func writeSample(buf *bytes.Buffer, name, labels, extra string, val float64) {
+	buf.WriteString(name)
+	if labels != "" || extra != "" {
+		buf.WriteByte('{')
+		buf.WriteString(labels)
+		if labels != "" && extra != "" {
+			buf.WriteByte(',')
+		}
+		buf.WriteString(extra)
+		buf.WriteByte('}')
+	}
+	buf.WriteByte(' ')
+	buf.WriteString(formatFloat(val))
+	buf.WriteByte('\n')
+}
+
+// formatLabels converts "key:value" tags into a sorted label string.
+// Tags without a value are exported with a value of "true".
+func formatLabels(tags []string) string {
+	if len(tags) == 0 {
+		return ""
+	}
+
+	pairs := make([][2]string, 0, len(tags))
+	seen := make(map[string]struct{}, len(tags))
+	for _, tag := range tags {
+		if tag == "" {
+			continue
+		}
+
+		key, val := tag, "true"
+		if pos := strings.IndexByte(tag, ':'); pos > -1 {
+			key, val = tag[:pos], tag[pos+1:]
+		}
+		if key = sanitizeLabel(key); key == "" {
+			continue
+		}
+		if _, ok := seen[key]; ok {
+			continue
+		}
+		seen[key] = struct{}{}
+		pairs = append(pairs, [2]string{key, val})
+	}
+	sort.Slice(pairs, func(i, j int) bool { return pairs[i][0] < pairs[j][0] })
+
+	var sb strings.Builder
+	for i, p := range pairs {
+		if i != 0 {
+			sb.WriteByte(',')
+		}
+		sb.WriteString(p[0])
+		sb.WriteString(`="`)
+		sb.WriteString(labelValueEscaper.Replace(p[1]))
+		sb.WriteByte('"')
+	}
+	return sb.String()
+}
+
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+
+// sanitizeName converts name into a valid metric name, [a-zA-Z_:][a-zA-Z0-9_:]*
+func sanitizeName(name string) string {
+	return sanitize(name, true)
+}
+
+// sanitizeLabel converts name into a valid label name, [a-zA-Z_][a-zA-Z0-9_]*
+func sanitizeLabel(name string) string {
+	return sanitize(name, false)
+}
+
+func sanitize(s string, colon bool) string {
+	if s == "" {
+		return ""
+	}
+
+	b := []byte(s)
+	for i, c := range b {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c == '_':
+		case c >= '0' && c <= '9' && i != 0:
+		case c == ':' && colon:
+		default:
+			b[i] = '_'
+		}
+	}
+	if s[0] >= '0' && s[0] <= '9' {
+		return "_" + s[:1] + string(b[1:])
+	}
+	return string(b)
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsNaN(v):
+		return "NaN"
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
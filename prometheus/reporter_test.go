@@ -0,0 +1,208 @@
+package prometheus
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bsm/ginkgo/v2"
+	. "github.com/bsm/gomega"
+	"github.com/bsm/instruments"
+)
+
+var _ = ginkgo.Describe("Reporter", func() {
+	var subject *Reporter
+
+	scrape := func() (string, string) {
+		w := httptest.NewRecorder()
+		subject.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+		Expect(w.Code).To(Equal(http.StatusOK))
+
+		body, err := io.ReadAll(w.Body)
+		Expect(err).NotTo(HaveOccurred())
+		return w.Header().Get("Content-Type"), string(body)
+	}
+
+	ginkgo.BeforeEach(func() {
+		subject = New()
+		subject.Quantiles = []float64{0.5, 0.99}
+	})
+
+	ginkgo.It("should serve blank before the first flush", func() {
+		ctype, body := scrape()
+		Expect(ctype).To(Equal("text/plain; version=0.0.4; charset=utf-8"))
+		Expect(body).To(BeEmpty())
+	})
+
+	ginkgo.It("should support reporter cycle", func() {
+		Expect(subject.Prep()).To(Succeed())
+		Expect(subject.Discrete("cnt.x", []string{"b:2", "a:1"}, 3)).To(Succeed())
+		Expect(subject.Discrete("cnt.x", []string{"a:0"}, 1.5)).To(Succeed())
+		Expect(subject.Sample("tmr", []string{"flag"}, mockDistribution{})).To(Succeed())
+		Expect(subject.Flush()).To(Succeed())
+
+		_, body := scrape()
+		Expect(body).To(Equal(`# TYPE cnt_x gauge
+cnt_x{a="0"} 1.5
+cnt_x{a="1",b="2"} 3
+# TYPE tmr summary
+tmr{flag="true",quantile="0.5"} 100.1
+tmr{flag="true",quantile="0.99"} 100.1
+tmr_sum{flag="true"} 300.3
+tmr_count{flag="true"} 3
+`))
+	})
+
+	ginkgo.It("should keep the last snapshot only", func() {
+		Expect(subject.Prep()).To(Succeed())
+		Expect(subject.Discrete("cnt", nil, 3)).To(Succeed())
+		Expect(subject.Flush()).To(Succeed())
+
+		Expect(subject.Prep()).To(Succeed())
+		Expect(subject.Discrete("gauge", nil, 8)).To(Succeed())
+		_, body := scrape()
+		Expect(body).To(Equal("# TYPE cnt gauge\ncnt 3\n"))
+
+		Expect(subject.Flush()).To(Succeed())
+		_, body = scrape()
+		Expect(body).To(Equal("# TYPE gauge gauge\ngauge 8\n"))
+	})
+
+	ginkgo.It("should convert base units", func() {
+		timer := instruments.Metadata{Kind: instruments.KindDistribution, Unit: "ms"}
+		mem := instruments.Metadata{Unit: "By"}
+
+		Expect(subject.Prep()).To(Succeed())
+		Expect(subject.SampleWithMetadata("tmr", nil, timer, mockDistribution{})).To(Succeed())
+		Expect(subject.DiscreteWithMetadata("mem", nil, mem, 5)).To(Succeed())
+		Expect(subject.Flush()).To(Succeed())
+
+		_, body := scrape()
+		Expect(body).To(Equal(`# TYPE mem gauge
+mem 5
+# TYPE tmr summary
+tmr{quantile="0.5"} 100.1
+tmr{quantile="0.99"} 100.1
+tmr_sum 300.3
+tmr_count 3
+`))
+
+		subject.BaseUnits = true
+		Expect(subject.Prep()).To(Succeed())
+		Expect(subject.SampleWithMetadata("tmr", nil, timer, mockDistribution{})).To(Succeed())
+		Expect(subject.SampleWithMetadata("rpc_seconds", nil, timer, mockDistribution{})).To(Succeed())
+		Expect(subject.DiscreteWithMetadata("mem", nil, mem, 5)).To(Succeed())
+		Expect(subject.Flush()).To(Succeed())
+
+		_, body = scrape()
+		Expect(body).To(Equal(`# TYPE mem_bytes gauge
+mem_bytes 5
+# TYPE rpc_seconds summary
+rpc_seconds{quantile="0.5"} 0.1001
+rpc_seconds{quantile="0.99"} 0.1001
+rpc_seconds_sum 0.3003
+rpc_seconds_count 3
+# TYPE tmr_seconds summary
+tmr_seconds{quantile="0.5"} 0.1001
+tmr_seconds{quantile="0.99"} 0.1001
+tmr_seconds_sum 0.3003
+tmr_seconds_count 3
+`))
+	})
+
+	ginkgo.It("should export cumulative counters", func() {
+		total := instruments.Metadata{Kind: instruments.KindCumulative, Delta: 2}
+
+		Expect(subject.Prep()).To(Succeed())
+		Expect(subject.DiscreteWithMetadata("requests_total", []string{"a:1"}, total, 25)).To(Succeed())
+		Expect(subject.DiscreteWithMetadata("requests_total", []string{"a:2"}, total, 7)).To(Succeed())
+		Expect(subject.Flush()).To(Succeed())
+
+		_, body := scrape()
+		Expect(body).To(Equal(`# TYPE requests_total counter
+requests_total{a="1"} 25
+requests_total{a="2"} 7
+`))
+	})
+
+	ginkgo.It("should export histograms", func() {
+		hist := instruments.NewHistogram([]float64{1, 5})
+		for _, v := range []float64{0.5, 2, 3, 10} {
+			hist.Update(v)
+		}
+		exp := instruments.NewExpHistogram(0)
+		for _, v := range []float64{1, 3} {
+			exp.Update(v)
+		}
+
+		Expect(subject.Prep()).To(Succeed())
+		Expect(subject.Sample("hist", []string{"a:1"}, hist.Snapshot())).To(Succeed())
+		Expect(subject.Sample("exp", nil, exp.Snapshot())).To(Succeed())
+		Expect(subject.Flush()).To(Succeed())
+
+		_, body := scrape()
+		Expect(body).To(Equal(`# TYPE exp histogram
+exp_bucket{le="1"} 1
+exp_bucket{le="3"} 2
+exp_bucket{le="+Inf"} 2
+exp_sum 4
+exp_count 2
+# TYPE hist histogram
+hist_bucket{a="1",le="1"} 1
+hist_bucket{a="1",le="5"} 3
+hist_bucket{a="1",le="+Inf"} 4
+hist_sum{a="1"} 15.5
+hist_count{a="1"} 4
+`))
+	})
+
+	ginkgo.It("should skip conflicting types", func() {
+		Expect(subject.Prep()).To(Succeed())
+		Expect(subject.Discrete("x", nil, 3)).To(Succeed())
+		Expect(subject.Sample("x", []string{"a:b"}, mockDistribution{})).To(Succeed())
+		Expect(subject.Flush()).To(Succeed())
+
+		_, body := scrape()
+		Expect(body).To(Equal("# TYPE x gauge\nx 3\n"))
+	})
+
+	ginkgo.DescribeTable("should format labels",
+		func(tags []string, exp string) {
+			Expect(formatLabels(tags)).To(Equal(exp))
+		},
+
+		ginkgo.Entry("blank", nil, ``),
+		ginkgo.Entry("key/value", []string{"b:2", "a:1"}, `a="1",b="2"`),
+		ginkgo.Entry("bare", []string{"x"}, `x="true"`),
+		ginkgo.Entry("colons", []string{"url:http://x"}, `url="http://x"`),
+		ginkgo.Entry("escape", []string{`k.x:a"b\c`}, `k_x="a\"b\\c"`),
+		ginkgo.Entry("dupes", []string{"a:1", "a:2", ""}, `a="1"`),
+	)
+
+	ginkgo.DescribeTable("should sanitize names",
+		func(name, exp string) {
+			Expect(sanitizeName(name)).To(Equal(exp))
+		},
+
+		ginkgo.Entry("valid", "http_requests:total", "http_requests:total"),
+		ginkgo.Entry("dots", "myapp.http.requests", "myapp_http_requests"),
+		ginkgo.Entry("dashes", "processing-time", "processing_time"),
+		ginkgo.Entry("leading digit", "5xx", "_5xx"),
+	)
+})
+
+// --------------------------------------------------------------------
+
+func TestSuite(t *testing.T) {
+	RegisterFailHandler(ginkgo.Fail)
+	ginkgo.RunSpecs(t, "instruments/prometheus")
+}
+
+type mockDistribution struct {
+	instruments.Distribution
+}
+
+func (mockDistribution) Quantile(_ float64) float64 { return 100.1 }
+func (mockDistribution) Sum() float64               { return 300.3 }
+func (mockDistribution) Count() int                 { return 3 }
@@ -1,6 +1,7 @@
 package instruments
 
 import (
+	"context"
 	"log"
 	"math"
 	"os"
@@ -20,8 +21,14 @@ type Registry struct {
 	reporters   []Reporter
 	prefix      string
 	tags        []string
+	persistent  bool
+	ttl         time.Duration
+	lastActive  map[string]time.Time
+	batches     []*batch
+	ctx         context.Context
+	cancel      context.CancelFunc
 	closing     chan struct{}
-	closed      chan error
+	closed      chan struct{}
 	mutex       sync.RWMutex
 }
 
@@ -37,13 +44,16 @@ func New(flushInterval time.Duration, prefix string, tags ...string) *Registry {
 		flushInterval = 30 * time.Second
 	}
 
+	ctx, cancel := context.WithCancel(context.Background())
 	r := &Registry{
 		Logger:      log.New(os.Stderr, "instruments: ", log.LstdFlags),
 		instruments: make(map[string]interface{}),
 		prefix:      prefix,
 		tags:        tags,
+		ctx:         ctx,
+		cancel:      cancel,
 		closing:     make(chan struct{}),
-		closed:      make(chan error, 1),
+		closed:      make(chan struct{}),
 	}
 	go r.loop(flushInterval)
 	return r
@@ -65,6 +75,27 @@ func (r *Registry) Subscribe(rep Reporter) {
 	r.mutex.Unlock()
 }
 
+// SetPersistent toggles persistent instruments. By default, all
+// instruments are removed from the registry on every flush. Persistent
+// instruments remain registered instead and are snapshotted in place.
+//
+// Persistent instruments which have been idle, i.e. have neither been
+// updated nor (re-)registered for at least ttl, are evicted. Please note
+// that evicted instruments are no longer reported, fetch them from the
+// registry again after idle periods. Custom instruments, which do not
+// track their updates, are never evicted. A ttl <= 0 disables eviction.
+func (r *Registry) SetPersistent(enable bool, ttl time.Duration) {
+	r.mutex.Lock()
+	r.persistent = enable
+	r.ttl = ttl
+	if enable && r.lastActive == nil {
+		r.lastActive = make(map[string]time.Time)
+	} else if !enable {
+		r.lastActive = nil
+	}
+	r.mutex.Unlock()
+}
+
 // Get returns an instrument from the Registry.
 func (r *Registry) Get(name string, tags []string) interface{} {
 	key := MetricID(name, tags)
@@ -77,10 +108,11 @@ func (r *Registry) Get(name string, tags []string) interface{} {
 // Register registers a new instrument.
 func (r *Registry) Register(name string, tags []string, v interface{}) {
 	switch v.(type) {
-	case Discrete, Sample:
+	case Discrete, Sample, Compound:
 		key := MetricID(name, tags)
 		r.mutex.Lock()
 		r.instruments[key] = v
+		r.touch(key, time.Now())
 		r.mutex.Unlock()
 	}
 }
@@ -90,6 +122,7 @@ func (r *Registry) Unregister(name string, tags []string) {
 	key := MetricID(name, tags)
 	r.mutex.Lock()
 	delete(r.instruments, key)
+	delete(r.lastActive, key)
 	r.mutex.Unlock()
 }
 
@@ -110,13 +143,48 @@ func (r *Registry) Fetch(name string, tags []string, factory func() interface{})
 
 	if v, ok = r.instruments[key]; !ok {
 		switch v = factory(); v.(type) {
-		case Discrete, Sample:
+		case Discrete, Sample, Compound:
 			r.instruments[key] = v
+			r.touch(key, time.Now())
 		}
 	}
 	return v
 }
 
+// Observer records gauge values observed by a BatchFunc.
+type Observer interface {
+	// Observe records a value with name and tags.
+	Observe(name string, tags []string, value float64)
+}
+
+// BatchFunc observes several gauges in one call.
+type BatchFunc func(Observer)
+
+type batch struct{ fn BatchFunc }
+
+// RegisterBatch registers fn, which is called at flush time to observe
+// several gauges at once. Observations are reported just like GaugeFunc
+// instruments. The returned function unregisters fn.
+func (r *Registry) RegisterBatch(fn BatchFunc) (unregister func()) {
+	b := &batch{fn: fn}
+
+	r.mutex.Lock()
+	r.batches = append(r.batches, b)
+	r.mutex.Unlock()
+
+	return func() {
+		r.mutex.Lock()
+		defer r.mutex.Unlock()
+
+		for i, x := range r.batches {
+			if x == b {
+				r.batches = append(r.batches[:i:i], r.batches[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
 // Size returns the numbers of instruments in the registry.
 func (r *Registry) Size() int {
 	r.mutex.RLock()
@@ -128,25 +196,50 @@ func (r *Registry) Size() int {
 // Flush performs a manual flush to all subscribed reporters.
 // This method is usually called by a background thread
 // every flushInterval, specified in New()
+//
+// Each reporter is driven independently, a failing reporter
+// is skipped for the rest of the cycle while the remaining ones
+// continue to receive data. Errors are returned as a FlushError.
+// Instruments are retained if all reporters fail to prepare.
 func (r *Registry) Flush() error {
+	return r.FlushContext(context.Background())
+}
+
+// FlushContext performs a flush, just like Flush. The context is
+// passed to reporters which implement ContextFlusher.
+func (r *Registry) FlushContext(ctx context.Context) error {
 	r.mutex.RLock()
 	reporters := r.reporters
 	rtags := r.tags
+	persistent := r.persistent
+	batches := r.batches
 	r.mutex.RUnlock()
 
-	for _, rep := range reporters {
+	errs := make([]error, len(reporters))
+	prepped := 0
+	for i, rep := range reporters {
+		if gr, ok := rep.(GlobalTagsReporter); ok {
+			gr.SetGlobalTags(rtags)
+		}
 		if err := rep.Prep(); err != nil {
-			return err
+			errs[i] = err
+		} else {
+			prepped++
 		}
 	}
+	if prepped == 0 && len(reporters) != 0 {
+		return newFlushError(reporters, errs)
+	}
 
-	for metricID, val := range r.reset() {
+	var instruments map[string]interface{}
+	if persistent {
+		instruments = r.copy()
+	} else {
+		instruments = r.reset()
+	}
+	for metricID, val := range instruments {
 		name, tags := SplitMetricID(metricID)
-		if len(name) > 0 && name[0] == '|' {
-			name = name[1:]
-		} else {
-			name = r.prefix + name
-		}
+		name = r.metricName(name)
 		tags = append(tags, rtags...)
 
 		switch inst := val.(type) {
@@ -156,33 +249,66 @@ func (r *Registry) Flush() error {
 			if math.IsNaN(val) || math.IsInf(val, 0) {
 				break
 			}
-			for _, rep := range reporters {
-				if err := rep.Discrete(name, tags, val); err != nil {
-					return err
+			meta := metadataOf(inst)
+			for i, rep := range reporters {
+				if errs[i] == nil {
+					errs[i] = reportDiscrete(rep, name, tags, meta, val)
 				}
 			}
 
 		case Sample:
-			val := inst.Snapshot()
+			var val Distribution
+			if rs, ok := inst.(Resetter); ok && persistent {
+				val = rs.Reset()
+			} else {
+				val = inst.Snapshot()
+			}
 			if val.Count() == 0 {
+				releaseDistribution(val)
 				break
 			}
-			for _, rep := range reporters {
-				if err := rep.Sample(name, tags, val); err != nil {
-					return err
+			meta := metadataOf(inst)
+			for i, rep := range reporters {
+				if errs[i] == nil {
+					errs[i] = reportSample(rep, name, tags, meta, val)
 				}
 			}
 			releaseDistribution(val)
 
+		case Compound:
+			for _, v := range inst.Snapshot() {
+				if math.IsNaN(v.Value) || math.IsInf(v.Value, 0) {
+					continue
+				}
+				for i, rep := range reporters {
+					if errs[i] == nil {
+						errs[i] = reportDiscrete(rep, name+v.Suffix, tags, v.Meta, v.Value)
+					}
+				}
+			}
+
 		}
 	}
 
-	for _, rep := range reporters {
-		if err := rep.Flush(); err != nil {
-			return err
+	for _, b := range batches {
+		b.fn(&batchObserver{
+			registry:  r,
+			reporters: reporters,
+			errs:      errs,
+			tags:      rtags,
+		})
+	}
+
+	if persistent {
+		r.expire()
+	}
+
+	for i, rep := range reporters {
+		if errs[i] == nil {
+			errs[i] = flushReporter(ctx, rep)
 		}
 	}
-	return nil
+	return newFlushError(reporters, errs)
 }
 
 // Tags returns global registry tags
@@ -210,21 +336,83 @@ func (r *Registry) AddTags(tags ...string) {
 // Close flushes all pending data to reporters
 // and releases resources.
 func (r *Registry) Close() error {
+	return r.CloseContext(context.Background())
+}
+
+// CloseContext cuts short any in-progress background flush, i.e.
+// retries performed by reporters which implement ContextFlusher.
+// It then flushes all pending data to reporters, using ctx,
+// and releases resources.
+func (r *Registry) CloseContext(ctx context.Context) error {
 	if r.closing == nil {
 		return nil
 	}
+	r.cancel()
 	close(r.closing)
-	return <-r.closed
+	<-r.closed
+	return r.FlushContext(ctx)
 }
 
 func (r *Registry) reset() map[string]interface{} {
 	r.mutex.Lock()
 	instruments := r.instruments
 	r.instruments = make(map[string]interface{})
+	for key, v := range instruments {
+		if _, ok := v.(retainer); ok {
+			r.instruments[key] = v
+		}
+	}
 	r.mutex.Unlock()
 	return instruments
 }
 
+func (r *Registry) copy() map[string]interface{} {
+	r.mutex.RLock()
+	instruments := make(map[string]interface{}, len(r.instruments))
+	for key, v := range r.instruments {
+		instruments[key] = v
+	}
+	r.mutex.RUnlock()
+	return instruments
+}
+
+// expire marks updated instruments as active and evicts idle ones.
+// Retained and untracked instruments are never evicted.
+func (r *Registry) expire() {
+	now := time.Now()
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.lastActive == nil {
+		return
+	}
+	for key, v := range r.instruments {
+		if _, ok := v.(retainer); ok {
+			continue
+		}
+		t, ok := v.(tracker)
+		if !ok {
+			continue
+		}
+
+		last, ok := r.lastActive[key]
+		if t.updated() || !ok {
+			r.touch(key, now)
+		} else if r.ttl > 0 && now.Sub(last) >= r.ttl {
+			delete(r.instruments, key)
+			delete(r.lastActive, key)
+		}
+	}
+}
+
+// touch marks an instrument as active, must be called within a write lock.
+func (r *Registry) touch(key string, now time.Time) {
+	if r.lastActive != nil {
+		r.lastActive[key] = now
+	}
+}
+
 func (r *Registry) loop(flushInterval time.Duration) {
 	flusher := time.NewTicker(flushInterval)
 	defer flusher.Stop()
@@ -232,17 +420,61 @@ func (r *Registry) loop(flushInterval time.Duration) {
 	for {
 		select {
 		case <-r.closing:
-			r.closed <- r.Flush()
 			close(r.closed)
 			return
 		case <-flusher.C:
-			if err := r.Flush(); err != nil {
+			if err := r.FlushContext(r.ctx); err != nil && r.ctx.Err() == nil {
 				r.logf("flush error: %s", err.Error())
 			}
 		}
 	}
 }
 
+// metricName applies the prefix, unless name is marked as custom.
+func (r *Registry) metricName(name string) string {
+	if len(name) > 0 && name[0] == '|' {
+		return name[1:]
+	}
+	return r.prefix + name
+}
+
+type batchObserver struct {
+	registry  *Registry
+	reporters []Reporter
+	errs      []error
+	tags      []string
+}
+
+func (o *batchObserver) Observe(name string, tags []string, value float64) {
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return
+	}
+
+	name, tags = SplitMetricID(MetricID(name, tags))
+	name = o.registry.metricName(name)
+	tags = append(tags, o.tags...)
+
+	meta := Metadata{Kind: KindGauge}
+	for i, rep := range o.reporters {
+		if o.errs[i] == nil {
+			o.errs[i] = reportDiscrete(rep, name, tags, meta, value)
+		}
+	}
+}
+
+func newFlushError(reporters []Reporter, errs []error) error {
+	var ferr FlushError
+	for i, err := range errs {
+		if err != nil {
+			ferr = append(ferr, &ReporterError{Reporter: reporters[i], Err: err})
+		}
+	}
+	if len(ferr) == 0 {
+		return nil
+	}
+	return ferr
+}
+
 func (r *Registry) logf(s string, v ...interface{}) {
 	if r.Logger != nil {
 		r.Logger.Printf(s, v...)
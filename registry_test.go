@@ -1,6 +1,9 @@
 package instruments
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"math"
 	"time"
 
@@ -124,6 +127,162 @@ var _ = ginkgo.Describe("Registry", func() {
 		}))
 	})
 
+	ginkgo.It("should pass metadata to reporters", func() {
+		meta := &mockMetadataReporter{Kinds: make(map[string]Kind)}
+		subject.Subscribe(meta)
+
+		subject.Counter("cnt", nil).Update(1)
+		subject.Rate("rate", nil).Update(1)
+		subject.Gauge("gauge", nil).Update(1)
+		subject.Reservoir("resv", nil).Update(1)
+
+		Expect(subject.Flush()).To(Succeed())
+		Expect(meta.Kinds).To(Equal(map[string]Kind{
+			"myapp.cnt|a,b":   KindCounter,
+			"myapp.rate|a,b":  KindRate,
+			"myapp.gauge|a,b": KindGauge,
+			"myapp.resv|a,b":  KindDistribution,
+		}))
+		Expect(meta.Data).To(BeEmpty())
+		Expect(reporter.Flushed).To(HaveLen(4))
+	})
+
+	ginkgo.It("should retain cumulative counters", func() {
+		meta := &mockMetadataReporter{Kinds: make(map[string]Kind), Meta: make(map[string]Metadata)}
+		subject := NewUnstarted("myapp.")
+		subject.Subscribe(meta)
+
+		cnt := subject.CumulativeCounter("cnt", nil)
+		cnt.Update(3)
+		cnt.Update(2)
+		subject.Counter("tmp", nil).Update(1)
+		Expect(subject.Flush()).To(Succeed())
+		Expect(meta.Flushed).To(Equal(map[string]float64{"myapp.cnt": 5, "myapp.tmp": 1}))
+		Expect(meta.Meta["myapp.cnt"]).To(Equal(Metadata{Kind: KindCumulative, StartTime: cnt.StartTime(), Delta: 5}))
+		Expect(subject.Size()).To(Equal(1))
+
+		Expect(subject.CumulativeCounter("cnt", nil)).To(BeIdenticalTo(cnt))
+		cnt.Update(4)
+		Expect(subject.Flush()).To(Succeed())
+		Expect(meta.Flushed).To(HaveKeyWithValue("myapp.cnt", 9.0))
+		Expect(meta.Data).To(HaveLen(3))
+		Expect(meta.Meta["myapp.cnt"].Delta).To(Equal(4.0))
+	})
+
+	ginkgo.It("should retain gauge funcs", func() {
+		depth := 3.0
+		subject.GaugeFunc("queue", []string{"x"}, func() float64 { return depth })
+		Expect(subject.Flush()).To(Succeed())
+		Expect(reporter.Flushed).To(Equal(map[string]float64{"myapp.queue|a,b,x": 3}))
+
+		depth = 5
+		Expect(subject.Size()).To(Equal(1))
+		Expect(subject.Flush()).To(Succeed())
+		Expect(reporter.Flushed).To(Equal(map[string]float64{"myapp.queue|a,b,x": 5}))
+
+		depth = 0
+		subject.SetPersistent(true, time.Nanosecond)
+		Expect(subject.Flush()).To(Succeed())
+		time.Sleep(time.Millisecond)
+		Expect(subject.Flush()).To(Succeed())
+		Expect(subject.Size()).To(Equal(1))
+
+		subject.Unregister("queue", []string{"x"})
+		Expect(subject.Size()).To(Equal(0))
+	})
+
+	ginkgo.It("should observe batches", func() {
+		meta := &mockMetadataReporter{Kinds: make(map[string]Kind)}
+		subject.Subscribe(meta)
+
+		calls := 0
+		unregister := subject.RegisterBatch(func(o Observer) {
+			calls++
+			o.Observe("pool.size", []string{"pool:b"}, 4)
+			o.Observe("pool.size", []string{"pool:a"}, 2)
+			o.Observe("|custom.entries", []string{"z", "y"}, 7)
+			o.Observe("pool.idle", nil, math.NaN())
+		})
+		Expect(subject.Flush()).To(Succeed())
+		Expect(calls).To(Equal(1))
+		Expect(reporter.Flushed).To(Equal(map[string]float64{
+			"myapp.pool.size|a,b,pool:a": 2,
+			"myapp.pool.size|a,b,pool:b": 4,
+			"custom.entries|a,b,y,z":     7,
+		}))
+		Expect(meta.Kinds).To(HaveKeyWithValue("custom.entries|a,b,y,z", KindGauge))
+		Expect(subject.Size()).To(Equal(0))
+
+		unregister()
+		unregister()
+		Expect(subject.Flush()).To(Succeed())
+		Expect(calls).To(Equal(1))
+	})
+
+	ginkgo.It("should isolate reporter failures", func() {
+		failPrep := &mockFailingReporter{Stage: "prep"}
+		failData := &mockFailingReporter{Stage: "data"}
+		failFlush := &mockFailingReporter{Stage: "flush"}
+
+		subject := NewUnstarted("myapp.", "a", "b")
+		subject.Subscribe(reporter)
+		subject.Subscribe(failPrep)
+		subject.Subscribe(failData)
+		subject.Subscribe(failFlush)
+
+		subject.Counter("cnt", nil).Update(3)
+		subject.Reservoir("resv", nil).Update(2)
+
+		err := subject.Flush()
+		Expect(err).To(BeAssignableToTypeOf(FlushError{}))
+		Expect(err.(FlushError)).To(HaveLen(3))
+		Expect(err.(FlushError)[0].Reporter).To(BeIdenticalTo(failPrep))
+		Expect(err.(FlushError)[1].Reporter).To(BeIdenticalTo(failData))
+		Expect(err.(FlushError)[2].Reporter).To(BeIdenticalTo(failFlush))
+		Expect(err).To(MatchError("*instruments.mockFailingReporter: failed on prep; " +
+			"*instruments.mockFailingReporter: failed on data; " +
+			"*instruments.mockFailingReporter: failed on flush"))
+		Expect(errors.Unwrap(err.(FlushError)[0])).To(MatchError("failed on prep"))
+
+		Expect(reporter.Flushed).To(Equal(map[string]float64{
+			"myapp.cnt|a,b":  3,
+			"myapp.resv|a,b": 2,
+		}))
+		Expect(failData.Calls).To(Equal(1))
+		Expect(failFlush.Calls).To(Equal(2))
+		Expect(subject.Size()).To(Equal(0))
+	})
+
+	ginkgo.It("should retain instruments if all reporters fail to prepare", func() {
+		subject := NewUnstarted("myapp.")
+		subject.Subscribe(&mockFailingReporter{Stage: "prep"})
+
+		subject.Counter("cnt", nil).Update(3)
+		Expect(subject.Flush()).To(MatchError("*instruments.mockFailingReporter: failed on prep"))
+		Expect(subject.Size()).To(Equal(1))
+	})
+
+	ginkgo.It("should pass context to reporters", func() {
+		subject := NewUnstarted("myapp.")
+		reporter := &mockContextReporter{Blocking: 1, Started: make(chan struct{}, 1)}
+		subject.Subscribe(reporter)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		Expect(subject.FlushContext(ctx)).To(MatchError("*instruments.mockContextReporter: context canceled"))
+		Expect(subject.FlushContext(ctx)).To(Succeed())
+	})
+
+	ginkgo.It("should cut in-progress flushes short on close", func() {
+		subject := New(time.Second, "myapp.")
+		reporter := &mockContextReporter{Blocking: 1, Started: make(chan struct{}, 1)}
+		subject.Subscribe(reporter)
+
+		Eventually(reporter.Started, 3*time.Second).Should(Receive())
+		Expect(subject.Close()).To(Succeed())
+		Expect(reporter.Calls).To(Equal(2))
+	})
+
 	ginkgo.It("should not flush empty metrics", func() {
 		sampleEmpty := NewReservoir() // Distribution example
 		subject.Register("|sample.empty", nil, sampleEmpty)
@@ -151,6 +310,68 @@ var _ = ginkgo.Describe("Registry", func() {
 		}))
 	})
 
+	ginkgo.It("should keep persistent instruments", func() {
+		subject.SetPersistent(true, time.Hour)
+
+		cnt := subject.Counter("cnt", nil)
+		gauge := subject.Gauge("gauge", nil)
+		resv := subject.Reservoir("resv", nil)
+
+		cnt.Update(3)
+		gauge.Update(7)
+		resv.Update(2)
+		resv.Update(4)
+		Expect(subject.Flush()).To(Succeed())
+		Expect(subject.Size()).To(Equal(3))
+		Expect(reporter.Flushed).To(Equal(map[string]float64{
+			"myapp.cnt|a,b":   3,
+			"myapp.gauge|a,b": 7,
+			"myapp.resv|a,b":  3,
+		}))
+
+		reporter.Data = reporter.Data[:0]
+		cnt.Update(5)
+		resv.Update(8)
+		Expect(subject.Flush()).To(Succeed())
+		Expect(subject.Size()).To(Equal(3))
+		Expect(subject.Counter("cnt", nil)).To(BeIdenticalTo(cnt))
+		Expect(reporter.Flushed).To(Equal(map[string]float64{
+			"myapp.cnt|a,b":   5,
+			"myapp.gauge|a,b": 7,
+			"myapp.resv|a,b":  8,
+		}))
+	})
+
+	ginkgo.It("should evict idle persistent instruments", func() {
+		subject.SetPersistent(true, 20*time.Millisecond)
+
+		cnt := subject.Counter("cnt", nil)
+		gauge := subject.Gauge("gauge", nil)
+		subject.Reservoir("resv", nil)
+		gauge.Update(7)
+
+		Expect(subject.Flush()).To(Succeed())
+		Expect(subject.Size()).To(Equal(3))
+
+		time.Sleep(30 * time.Millisecond)
+		cnt.Update(1)
+		gauge.Update(0)
+		Expect(subject.Flush()).To(Succeed())
+		Expect(subject.Size()).To(Equal(2))
+		Expect(subject.Get("resv", nil)).To(BeNil())
+
+		time.Sleep(30 * time.Millisecond)
+		gauge.Update(0)
+		Expect(subject.Flush()).To(Succeed())
+		Expect(subject.Size()).To(Equal(1))
+		Expect(subject.Get("gauge", nil)).To(BeIdenticalTo(gauge))
+		Expect(reporter.Flushed).To(HaveKeyWithValue("myapp.gauge|a,b", 0.0))
+
+		subject.SetPersistent(false, 0)
+		Expect(subject.Flush()).To(Succeed())
+		Expect(subject.Size()).To(Equal(0))
+	})
+
 	ginkgo.It("should reset", func() {
 		subject.Register("foo", []string{"a", "b"}, NewRate())
 		Expect(subject.Size()).To(Equal(1))
@@ -206,3 +427,63 @@ func (m *mockReporter) Sample(name string, tags []string, dist Distribution) err
 	})
 	return nil
 }
+
+type mockMetadataReporter struct {
+	mockReporter
+	Kinds map[string]Kind
+	Meta  map[string]Metadata
+}
+
+func (m *mockMetadataReporter) DiscreteWithMetadata(name string, tags []string, meta Metadata, val float64) error {
+	m.Kinds[MetricID(name, tags)] = meta.Kind
+	if m.Meta != nil {
+		m.Meta[MetricID(name, tags)] = meta
+		m.mockReporter.Discrete(name, tags, val)
+	}
+	return nil
+}
+
+func (m *mockMetadataReporter) SampleWithMetadata(name string, tags []string, meta Metadata, _ Distribution) error {
+	m.Kinds[MetricID(name, tags)] = meta.Kind
+	return nil
+}
+
+type mockFailingReporter struct {
+	Stage string
+	Calls int
+}
+
+func (m *mockFailingReporter) fail(stage string) error {
+	if stage == "data" {
+		m.Calls++
+	}
+	if stage == m.Stage {
+		return fmt.Errorf("failed on %s", stage)
+	}
+	return nil
+}
+
+func (m *mockFailingReporter) Prep() error                                    { return m.fail("prep") }
+func (m *mockFailingReporter) Discrete(_ string, _ []string, _ float64) error { return m.fail("data") }
+func (m *mockFailingReporter) Sample(_ string, _ []string, _ Distribution) error {
+	return m.fail("data")
+}
+func (m *mockFailingReporter) Flush() error { return m.fail("flush") }
+
+type mockContextReporter struct {
+	mockReporter
+	Blocking int
+	Calls    int
+	Started  chan struct{}
+}
+
+func (m *mockContextReporter) FlushContext(ctx context.Context) error {
+	m.Calls++
+	if m.Calls > m.Blocking {
+		return m.Flush()
+	}
+
+	m.Started <- struct{}{}
+	<-ctx.Done()
+	return ctx.Err()
+}
@@ -1,5 +1,11 @@
 package instruments
 
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
 // Reporter describes the interface every reporter must follow.
 // See logreporter package as an example.
 type Reporter interface {
@@ -15,3 +21,89 @@ type Reporter interface {
 	// backend as a bulk.
 	Flush() error
 }
+
+// ContextFlusher is an optional interface which may be implemented by
+// reporters which perform blocking or retrying I/O on Flush. The
+// registry passes a context, which is cancelled on Close.
+type ContextFlusher interface {
+	// FlushContext is called instead of Flush.
+	FlushContext(ctx context.Context) error
+}
+
+// GlobalTagsReporter is an optional interface for reporters which treat
+// the registry's global tags separately, e.g. as resource attributes.
+// Global tags are still included in the tags of every value.
+type GlobalTagsReporter interface {
+	Reporter
+	// SetGlobalTags is called with the registry's global
+	// tags at the beginning of each cycle, before Prep.
+	SetGlobalTags(tags []string)
+}
+
+// ReporterError wraps an error returned by a subscribed Reporter.
+type ReporterError struct {
+	// Reporter is the failed reporter.
+	Reporter Reporter
+	// Err is the original error.
+	Err error
+}
+
+// Error implements error.
+func (e *ReporterError) Error() string {
+	return fmt.Sprintf("%T: %s", e.Reporter, e.Err.Error())
+}
+
+// Unwrap returns the original error.
+func (e *ReporterError) Unwrap() error { return e.Err }
+
+// FlushError is returned by Registry.Flush when one or more
+// reporters have failed.
+type FlushError []*ReporterError
+
+// Error implements error.
+func (e FlushError) Error() string {
+	msgs := make([]string, 0, len(e))
+	for _, err := range e {
+		msgs = append(msgs, err.Error())
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// ReportDiscrete passes a numeric value to rep. Unless nil, meta is
+// passed along to reporters which implement MetadataReporter.
+func ReportDiscrete(rep Reporter, name string, tags []string, meta *Metadata, val float64) error {
+	if meta == nil {
+		return rep.Discrete(name, tags, val)
+	}
+	return reportDiscrete(rep, name, tags, *meta, val)
+}
+
+// ReportSample passes a distribution to rep. Unless nil, meta is
+// passed along to reporters which implement MetadataReporter.
+func ReportSample(rep Reporter, name string, tags []string, meta *Metadata, dist Distribution) error {
+	if meta == nil {
+		return rep.Sample(name, tags, dist)
+	}
+	return reportSample(rep, name, tags, *meta, dist)
+}
+
+func reportDiscrete(rep Reporter, name string, tags []string, meta Metadata, val float64) error {
+	if mr, ok := rep.(MetadataReporter); ok {
+		return mr.DiscreteWithMetadata(name, tags, meta, val)
+	}
+	return rep.Discrete(name, tags, val)
+}
+
+func reportSample(rep Reporter, name string, tags []string, meta Metadata, dist Distribution) error {
+	if mr, ok := rep.(MetadataReporter); ok {
+		return mr.SampleWithMetadata(name, tags, meta, dist)
+	}
+	return rep.Sample(name, tags, dist)
+}
+
+func flushReporter(ctx context.Context, rep Reporter) error {
+	if cf, ok := rep.(ContextFlusher); ok {
+		return cf.FlushContext(ctx)
+	}
+	return rep.Flush()
+}
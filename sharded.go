@@ -0,0 +1,212 @@
+package instruments
+
+import (
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/bsm/histogram/v3"
+)
+
+// reservoirShardSize is the number of values buffered
+// per shard before they are merged into the histogram.
+const reservoirShardSize = 64
+
+type reservoirShard struct {
+	m   sync.Mutex
+	buf []float64
+	_   [stripePad - 32]byte
+}
+
+// ShardedReservoir is a Reservoir for hot paths, which buffers values in
+// padded shards to avoid contention on a single lock.
+//
+// Shards are assigned per processor and merged into the histogram once
+// full and on Snapshot/Reset, which therefore include all values observed
+// before the call, just like Reservoir. Uncontended updates are more
+// expensive than Reservoir.Update, several times so with GOMAXPROCS=1,
+// prefer it only for instruments which are updated concurrently from
+// many goroutines.
+type ShardedReservoir struct {
+	updateFlag
+
+	hist *histogram.Histogram
+	size int
+	m    sync.Mutex
+
+	shards []reservoirShard
+	sel    shardSelector
+}
+
+// NewShardedReservoir creates a new sharded reservoir with
+// DefaultReservoirSize bins and one shard per GOMAXPROCS.
+func NewShardedReservoir() *ShardedReservoir {
+	return NewShardedReservoirSize(DefaultReservoirSize)
+}
+
+// NewShardedReservoirSize creates a new sharded reservoir with up to size
+// bins and one shard per GOMAXPROCS. A size < 1 uses DefaultReservoirSize.
+func NewShardedReservoirSize(size int) *ShardedReservoir {
+	r := new(ShardedReservoir)
+	r.init(size, runtime.GOMAXPROCS(0))
+	return r
+}
+
+func (r *ShardedReservoir) init(size, n int) {
+	if size < 1 {
+		size = DefaultReservoirSize
+	}
+	if n < 1 {
+		n = 1
+	}
+	r.size = size
+	r.hist = newHistogram(size)
+	r.shards = make([]reservoirShard, n)
+	r.sel.init(n)
+}
+
+// Update adds v to the sample.
+func (r *ShardedReservoir) Update(v float64) {
+	r.mark()
+	id := r.sel.acquire()
+	s := &r.shards[*id]
+
+	s.m.Lock()
+	if s.buf == nil {
+		s.buf = make([]float64, 0, reservoirShardSize)
+	}
+	s.buf = append(s.buf, v)
+	if len(s.buf) == cap(s.buf) {
+		r.m.Lock()
+		r.drain(s)
+		r.m.Unlock()
+	}
+	s.m.Unlock()
+
+	r.sel.release(id)
+}
+
+// Snapshot returns a Distribution
+func (r *ShardedReservoir) Snapshot() Distribution {
+	h := newHistogram(r.size)
+	r.lock()
+	h = r.hist.Copy(h)
+	r.unlock()
+	return h
+}
+
+// Reset returns a Distribution and resets the sample.
+func (r *ShardedReservoir) Reset() Distribution {
+	h := newHistogram(r.size)
+	r.lock()
+	h, r.hist = r.hist, h
+	r.unlock()
+	return h
+}
+
+// Merge merges the observations of x into r.
+func (r *ShardedReservoir) Merge(x *ShardedReservoir) {
+	r.merge(x, 1)
+}
+
+// merge merges the observations of x, multiplied by factor, into r.
+func (r *ShardedReservoir) merge(x *ShardedReservoir, factor float64) {
+	if r == x {
+		return
+	}
+
+	d := x.Snapshot()
+	defer releaseDistribution(d)
+
+	r.mark()
+	r.m.Lock()
+	addDistribution(r.hist, scaleDistribution(d, factor))
+	r.m.Unlock()
+}
+
+// lock acquires all shards, followed by the histogram, and merges
+// the buffered values. Shards are always locked before the histogram.
+func (r *ShardedReservoir) lock() {
+	for i := range r.shards {
+		r.shards[i].m.Lock()
+	}
+	r.m.Lock()
+	for i := range r.shards {
+		r.drain(&r.shards[i])
+	}
+}
+
+func (r *ShardedReservoir) unlock() {
+	r.m.Unlock()
+	for i := range r.shards {
+		r.shards[i].m.Unlock()
+	}
+}
+
+// drain adds the values buffered in s to the histogram,
+// both s and the histogram must be locked.
+func (r *ShardedReservoir) drain(s *reservoirShard) {
+	for _, v := range s.buf {
+		r.hist.Add(v)
+	}
+	s.buf = s.buf[:0]
+}
+
+// --------------------------------------------------------------------
+
+// ShardedTimer is a Timer backed by a ShardedReservoir, for hot paths.
+type ShardedTimer struct {
+	r    ShardedReservoir
+	unit time.Duration
+}
+
+// NewShardedTimer creates a new ShardedTimer with millisecond resolution.
+func NewShardedTimer() *ShardedTimer {
+	return NewShardedTimerUnit(DefaultReservoirSize, time.Millisecond)
+}
+
+// NewShardedTimerUnit creates a new ShardedTimer with up to size bins
+// which records durations as multiples of unit. A unit <= 0 uses
+// milliseconds.
+func NewShardedTimerUnit(size int, unit time.Duration) *ShardedTimer {
+	if unit <= 0 {
+		unit = time.Millisecond
+	}
+
+	t := &ShardedTimer{unit: unit}
+	t.r.init(size, runtime.GOMAXPROCS(0))
+	return t
+}
+
+// Update adds duration to the sample, in the timer's unit.
+func (t *ShardedTimer) Update(d time.Duration) {
+	t.r.Update(float64(d) / float64(t.unit))
+}
+
+// Snapshot returns durations distribution
+func (t *ShardedTimer) Snapshot() Distribution {
+	return t.r.Snapshot()
+}
+
+// Reset returns durations distribution and resets the sample.
+func (t *ShardedTimer) Reset() Distribution {
+	return t.r.Reset()
+}
+
+// Merge merges the durations of x into t, converting
+// them to the unit of t.
+func (t *ShardedTimer) Merge(x *ShardedTimer) {
+	t.r.merge(&x.r, float64(x.unit)/float64(t.unit))
+}
+
+func (t *ShardedTimer) updated() bool { return t.r.updated() }
+
+// Metadata implements Describer.
+func (t *ShardedTimer) Metadata() Metadata {
+	return Metadata{Kind: KindDistribution, Unit: durationUnit(t.unit)}
+}
+
+// Since records duration since the given start time.
+func (t *ShardedTimer) Since(start time.Time) {
+	t.Update(time.Since(start))
+}
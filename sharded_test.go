@@ -0,0 +1,143 @@
+package instruments
+
+import (
+	"sync"
+	"time"
+
+	"github.com/bsm/ginkgo/v2"
+	. "github.com/bsm/gomega"
+)
+
+var _ = ginkgo.Describe("ShardedReservoir", func() {
+	newSharded := func(size, n int) *ShardedReservoir {
+		r := new(ShardedReservoir)
+		r.init(size, n)
+		return r
+	}
+
+	ginkgo.It("should update", func() {
+		r := newSharded(0, 4)
+		Expect(r.Snapshot().Count()).To(Equal(0))
+
+		r.Update(1)
+		Expect(r.Snapshot().Mean()).To(Equal(1.0))
+
+		r.Update(-10)
+		r.Update(23)
+		Expect(r.Snapshot().Mean()).To(BeNumerically("~", 4.67, 0.01))
+	})
+
+	ginkgo.It("should match reservoirs", func() {
+		r, x := newSharded(0, 1), NewReservoir()
+		for i := 0; i < 1000; i++ {
+			r.Update(float64(i % 97))
+			x.Update(float64(i % 97))
+		}
+		Expect(r.Snapshot()).To(Equal(x.Snapshot()))
+		Expect(r.Reset()).To(Equal(x.Reset()))
+		Expect(r.Snapshot().Count()).To(Equal(0))
+	})
+
+	ginkgo.It("should reset", func() {
+		r := newSharded(0, 4)
+		r.Update(1)
+		r.Update(3)
+		Expect(r.Reset().Mean()).To(Equal(2.0))
+		Expect(r.Snapshot().Count()).To(Equal(0))
+
+		r.Update(5)
+		Expect(r.Reset().Mean()).To(Equal(5.0))
+	})
+
+	ginkgo.It("should update atomically", func() {
+		r := newSharded(0, 4)
+
+		var wg sync.WaitGroup
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for j := 0; j < 1000; j++ {
+					r.Update(1)
+					if j%100 == 0 {
+						releaseDistribution(r.Snapshot())
+					}
+				}
+			}()
+		}
+		wg.Wait()
+
+		s := r.Snapshot()
+		Expect(s.Count()).To(Equal(8000))
+		Expect(s.Mean()).To(BeNumerically("==", 1.0))
+		Expect(r.Reset().Count()).To(Equal(8000))
+		Expect(r.Snapshot().Count()).To(Equal(0))
+	})
+
+	ginkgo.It("should merge", func() {
+		r1, r2 := NewShardedReservoir(), NewShardedReservoir()
+		for i := 0; i < 50; i++ {
+			r1.Update(float64(i))
+			r2.Update(float64(i + 50))
+		}
+		r1.Merge(r2)
+		r1.Merge(r1)
+
+		s := r1.Snapshot()
+		Expect(s.Count()).To(Equal(100))
+		Expect(s.Min()).To(Equal(0.0))
+		Expect(s.Max()).To(Equal(99.0))
+		Expect(s.Mean()).To(BeNumerically("~", 49.5, 0.5))
+		Expect(r2.Snapshot().Count()).To(Equal(50))
+	})
+
+	ginkgo.It("should configure sizes", func() {
+		r := NewShardedReservoirSize(8)
+		for i := 0; i < 1000; i++ {
+			r.Update(float64(i))
+		}
+		Expect(r.Snapshot().NumBins()).To(Equal(8))
+		Expect(NewShardedReservoirSize(0).size).To(Equal(DefaultReservoirSize))
+		Expect(newSharded(0, 0).shards).To(HaveLen(1))
+	})
+
+	ginkgo.It("should track durations", func() {
+		t := NewShardedTimer()
+		for i := 0; i < 100; i++ {
+			t.Update(time.Millisecond * time.Duration(i))
+		}
+		s := t.Snapshot()
+		Expect(s.Count()).To(Equal(100))
+		Expect(s.Mean()).To(BeNumerically("~", 49.5, 0.01))
+		Expect(t.Reset().Count()).To(Equal(100))
+		Expect(t.Snapshot().Count()).To(Equal(0))
+
+		t1, t2 := NewShardedTimerUnit(0, time.Microsecond), NewShardedTimerUnit(0, time.Microsecond)
+		t1.Update(1500 * time.Nanosecond)
+		t2.Update(2500 * time.Nanosecond)
+		t1.Merge(t2)
+		Expect(t1.Snapshot().Mean()).To(Equal(2.0))
+
+		t3 := NewShardedTimerUnit(0, time.Millisecond)
+		t3.Update(4 * time.Millisecond)
+		t1.Merge(t3)
+		Expect(t1.Snapshot().Max()).To(Equal(4000.0))
+		Expect(t1.Snapshot().Mean()).To(Equal(4004.0 / 3))
+		Expect(t1.Metadata()).To(Equal(Metadata{Kind: KindDistribution, Unit: "us"}))
+		Expect(NewShardedTimerUnit(0, 0).Metadata().Unit).To(Equal("ms"))
+	})
+
+	ginkgo.It("should fetch from registry", func() {
+		r := NewUnstarted("")
+		x := r.ShardedReservoir("r", nil)
+		Expect(r.ShardedReservoir("r", nil)).To(BeIdenticalTo(x))
+		t := r.ShardedTimer("t", nil)
+		Expect(r.ShardedTimer("t", nil)).To(BeIdenticalTo(t))
+
+		t.Update(time.Second)
+		rep := &mockReporter{}
+		r.Subscribe(rep)
+		Expect(r.Flush()).To(Succeed())
+		Expect(rep.Flushed).To(HaveKeyWithValue("t", 1000.0))
+	})
+})
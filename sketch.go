@@ -0,0 +1,514 @@
+package instruments
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"sync"
+)
+
+// Defaults for sketches.
+const (
+	DefaultSketchAccuracy = 0.01
+	DefaultSketchSize     = 2048
+)
+
+const sketchVersion = 1
+
+var (
+	errSketchMismatch = errors.New("instruments: cannot merge sketches with different accuracy")
+	errInvalidSketch  = errors.New("instruments: invalid sketch")
+)
+
+// Sketch tracks the distribution of values using a DDSketch, which
+// guarantees that quantiles are within the configured relative accuracy
+// of the true value.
+//
+// Sketches with the same relative accuracy can be merged, and they can
+// be serialised, i.e. to be combined across processes.
+type Sketch struct {
+	updateFlag
+
+	state sketchState
+	m     sync.Mutex
+}
+
+// NewSketch creates a new sketch with the given relative accuracy (0..1).
+// An invalid accuracy uses DefaultSketchAccuracy.
+func NewSketch(relativeAccuracy float64) *Sketch {
+	return NewSketchSize(relativeAccuracy, DefaultSketchSize)
+}
+
+// NewSketchSize creates a new sketch with the given relative accuracy and
+// a maximum number of buckets per range. Once exceeded, the lowest buckets
+// are collapsed, which sacrifices the accuracy of the lowest quantiles.
+func NewSketchSize(relativeAccuracy float64, maxSize int) *Sketch {
+	if !(relativeAccuracy > 0 && relativeAccuracy < 1) {
+		relativeAccuracy = DefaultSketchAccuracy
+	}
+	if maxSize < 1 {
+		maxSize = DefaultSketchSize
+	}
+
+	s := new(Sketch)
+	s.state.init(relativeAccuracy, maxSize)
+	return s
+}
+
+// RelativeAccuracy returns the relative accuracy.
+func (s *Sketch) RelativeAccuracy() float64 { return s.state.accuracy }
+
+// Update adds a value to the sketch.
+func (s *Sketch) Update(v float64) {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return
+	}
+
+	s.mark()
+	s.m.Lock()
+	s.state.add(v, 1)
+	s.m.Unlock()
+}
+
+// Snapshot returns a Distribution
+func (s *Sketch) Snapshot() Distribution {
+	s.m.Lock()
+	state := s.state.copy()
+	s.m.Unlock()
+	return state.snapshot()
+}
+
+// Reset returns a Distribution and resets the sketch.
+func (s *Sketch) Reset() Distribution {
+	s.m.Lock()
+	state := s.state
+	s.state.init(state.accuracy, state.maxSize)
+	s.m.Unlock()
+	return state.snapshot()
+}
+
+// Merge merges the observations of x into s. Both sketches must
+// have the same relative accuracy.
+func (s *Sketch) Merge(x *Sketch) error {
+	if s == x {
+		return nil
+	}
+
+	x.m.Lock()
+	other := x.state.copy()
+	x.m.Unlock()
+
+	s.mark()
+	s.m.Lock()
+	defer s.m.Unlock()
+	return s.state.merge(&other)
+}
+
+// MarshalBinary implements encoding.BinaryMarshaler.
+func (s *Sketch) MarshalBinary() ([]byte, error) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	return s.state.appendBinary(nil), nil
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler.
+func (s *Sketch) UnmarshalBinary(data []byte) error {
+	var state sketchState
+	if err := state.unmarshalBinary(data); err != nil {
+		return err
+	}
+
+	s.m.Lock()
+	s.state = state
+	s.m.Unlock()
+	return nil
+}
+
+// --------------------------------------------------------------------
+
+type sketchStore struct {
+	offset int
+	counts []uint64
+}
+
+func (b *sketchStore) end() int { return b.offset + len(b.counts) - 1 }
+
+// add adds n to the bucket at index, collapsing the lowest
+// buckets if the range exceeds maxSize.
+func (b *sketchStore) add(index int, n uint64, maxSize int) {
+	if len(b.counts) == 0 {
+		b.offset, b.counts = index, append(b.counts[:0], n)
+		return
+	}
+
+	lo, hi := b.offset, b.end()
+	if index < lo {
+		lo = index
+	}
+	if index > hi {
+		hi = index
+	}
+	if hi-lo+1 > maxSize {
+		lo = hi - maxSize + 1
+	}
+	if index < lo {
+		index = lo
+	}
+
+	if lo != b.offset || hi != b.end() {
+		counts := make([]uint64, hi-lo+1)
+		for i, c := range b.counts {
+			pos := b.offset + i - lo
+			if pos < 0 {
+				pos = 0
+			}
+			counts[pos] += c
+		}
+		b.offset, b.counts = lo, counts
+	}
+	b.counts[index-b.offset] += n
+}
+
+func (b *sketchStore) appendBinary(dst []byte) []byte {
+	return appendBuckets(dst, b.offset, b.counts)
+}
+
+func (b *sketchStore) unmarshalBinary(r *binaryReader) {
+	b.offset, b.counts = r.buckets()
+}
+
+type sketchState struct {
+	accuracy float64
+	maxSize  int
+	gamma    float64
+	logGamma float64
+
+	pos, neg   sketchStore
+	zero       uint64
+	count      uint64
+	sum, sumsq float64
+	min, max   float64
+}
+
+func (s *sketchState) init(accuracy float64, maxSize int) {
+	*s = sketchState{
+		accuracy: accuracy,
+		maxSize:  maxSize,
+		gamma:    (1 + accuracy) / (1 - accuracy),
+	}
+	s.logGamma = math.Log(s.gamma)
+}
+
+func (s *sketchState) index(v float64) int {
+	return int(math.Ceil(math.Log(v) / s.logGamma))
+}
+
+// value returns the representative value of the bucket at index.
+func (s *sketchState) value(index int) float64 {
+	return 2 * math.Pow(s.gamma, float64(index)) / (s.gamma + 1)
+}
+
+func (s *sketchState) add(v float64, n uint64) {
+	if s.count == 0 || v < s.min {
+		s.min = v
+	}
+	if s.count == 0 || v > s.max {
+		s.max = v
+	}
+	s.count += n
+	s.sum += v * float64(n)
+	s.sumsq += v * v * float64(n)
+
+	switch {
+	case v > 0:
+		s.pos.add(s.index(v), n, s.maxSize)
+	case v < 0:
+		s.neg.add(s.index(-v), n, s.maxSize)
+	default:
+		s.zero += n
+	}
+}
+
+func (s *sketchState) merge(x *sketchState) error {
+	if x.count == 0 {
+		return nil
+	}
+	if x.accuracy != s.accuracy {
+		return errSketchMismatch
+	}
+
+	if s.count == 0 || x.min < s.min {
+		s.min = x.min
+	}
+	if s.count == 0 || x.max > s.max {
+		s.max = x.max
+	}
+	s.count += x.count
+	s.sum += x.sum
+	s.sumsq += x.sumsq
+	s.zero += x.zero
+
+	for i, c := range x.pos.counts {
+		if c != 0 {
+			s.pos.add(x.pos.offset+i, c, s.maxSize)
+		}
+	}
+	for i, c := range x.neg.counts {
+		if c != 0 {
+			s.neg.add(x.neg.offset+i, c, s.maxSize)
+		}
+	}
+	return nil
+}
+
+func (s *sketchState) copy() sketchState {
+	c := *s
+	c.pos.counts = append([]uint64(nil), s.pos.counts...)
+	c.neg.counts = append([]uint64(nil), s.neg.counts...)
+	return c
+}
+
+func (s *sketchState) snapshot() *SketchSnapshot {
+	x := &SketchSnapshot{state: *s}
+	for i := len(s.neg.counts) - 1; i >= 0; i-- {
+		if c := s.neg.counts[i]; c != 0 {
+			x.bins = append(x.bins, Bin{Value: -s.value(s.neg.offset + i), Weight: float64(c)})
+		}
+	}
+	if s.zero != 0 {
+		x.bins = append(x.bins, Bin{Weight: float64(s.zero)})
+	}
+	for i, c := range s.pos.counts {
+		if c != 0 {
+			x.bins = append(x.bins, Bin{Value: s.value(s.pos.offset + i), Weight: float64(c)})
+		}
+	}
+	for i := range x.bins {
+		b := &x.bins[i]
+		b.Value = math.Min(math.Max(b.Value, s.min), s.max)
+	}
+	return x
+}
+
+func (s *sketchState) appendBinary(dst []byte) []byte {
+	dst = append(dst, sketchVersion)
+	dst = appendFloat64(dst, s.accuracy)
+	dst = appendUvarint(dst, uint64(s.maxSize))
+	dst = appendUvarint(dst, s.count)
+	dst = appendUvarint(dst, s.zero)
+	dst = appendFloat64(dst, s.sum)
+	dst = appendFloat64(dst, s.sumsq)
+	dst = appendFloat64(dst, s.min)
+	dst = appendFloat64(dst, s.max)
+	dst = s.pos.appendBinary(dst)
+	dst = s.neg.appendBinary(dst)
+	return dst
+}
+
+func (s *sketchState) unmarshalBinary(data []byte) error {
+	if len(data) == 0 || data[0] != sketchVersion {
+		return errInvalidSketch
+	}
+
+	r := binaryReader{data: data[1:]}
+	accuracy := r.float64()
+	maxSize := r.uvarint()
+	if r.err || !(accuracy > 0 && accuracy < 1) || maxSize < 1 || maxSize > math.MaxInt32 {
+		return errInvalidSketch
+	}
+
+	s.init(accuracy, int(maxSize))
+	s.count = r.uvarint()
+	s.zero = r.uvarint()
+	s.sum = r.float64()
+	s.sumsq = r.float64()
+	s.min = r.float64()
+	s.max = r.float64()
+	s.pos.unmarshalBinary(&r)
+	s.neg.unmarshalBinary(&r)
+	if r.err || len(r.data) != 0 {
+		return errInvalidSketch
+	}
+	return nil
+}
+
+// --------------------------------------------------------------------
+
+var _ Distribution = (*SketchSnapshot)(nil)
+
+// SketchSnapshot is the Distribution returned by Sketch.
+type SketchSnapshot struct {
+	state sketchState
+	bins  []Bin
+}
+
+// RelativeAccuracy returns the relative accuracy.
+func (s *SketchSnapshot) RelativeAccuracy() float64 { return s.state.accuracy }
+
+// Count implements Distribution.
+func (s *SketchSnapshot) Count() int { return int(s.state.count) }
+
+// Min implements Distribution.
+func (s *SketchSnapshot) Min() float64 {
+	if s.state.count == 0 {
+		return math.NaN()
+	}
+	return s.state.min
+}
+
+// Max implements Distribution.
+func (s *SketchSnapshot) Max() float64 {
+	if s.state.count == 0 {
+		return math.NaN()
+	}
+	return s.state.max
+}
+
+// Sum implements Distribution.
+func (s *SketchSnapshot) Sum() float64 {
+	if s.state.count == 0 {
+		return math.NaN()
+	}
+	return s.state.sum
+}
+
+// Mean implements Distribution.
+func (s *SketchSnapshot) Mean() float64 {
+	if s.state.count == 0 {
+		return math.NaN()
+	}
+	return s.state.sum / float64(s.state.count)
+}
+
+// Variance implements Distribution.
+func (s *SketchSnapshot) Variance() float64 {
+	if s.state.count <= 1 {
+		return math.NaN()
+	}
+	n := float64(s.state.count)
+	mean := s.state.sum / n
+	return math.Max(0, (s.state.sumsq-n*mean*mean)/(n-1))
+}
+
+// Quantile implements Distribution. The result is within the relative
+// accuracy of the true quantile, unless buckets were collapsed.
+func (s *SketchSnapshot) Quantile(q float64) float64 {
+	if s.state.count == 0 || q < 0.0 || q > 1.0 {
+		return math.NaN()
+	} else if q == 0.0 {
+		return s.state.min
+	} else if q == 1.0 {
+		return s.state.max
+	}
+
+	rank := q * float64(s.state.count-1)
+	var cum float64
+	for _, b := range s.bins {
+		if cum += b.Weight; cum > rank {
+			return b.Value
+		}
+	}
+	return s.state.max
+}
+
+// NumBins implements Distribution. Only non-empty buckets are
+// returned as bins, in ascending order of value.
+func (s *SketchSnapshot) NumBins() int { return len(s.bins) }
+
+// Bin implements Distribution.
+func (s *SketchSnapshot) Bin(index int) (value, weight float64) {
+	b := s.bins[index]
+	return b.Value, b.Weight
+}
+
+// mergeSketchSnapshots merges dists, which must all be sketch snapshots
+// with the same relative accuracy. It returns nil otherwise.
+func mergeSketchSnapshots(dists []Distribution) *SketchSnapshot {
+	first, ok := dists[0].(*SketchSnapshot)
+	if !ok {
+		return nil
+	}
+
+	maxSize := first.state.maxSize
+	for _, d := range dists {
+		s, ok := d.(*SketchSnapshot)
+		if !ok || s.state.accuracy != first.state.accuracy {
+			return nil
+		}
+		if s.state.maxSize > maxSize {
+			maxSize = s.state.maxSize
+		}
+	}
+
+	var state sketchState
+	state.init(first.state.accuracy, maxSize)
+	for _, d := range dists {
+		if err := state.merge(&d.(*SketchSnapshot).state); err != nil {
+			return nil
+		}
+	}
+	return state.snapshot()
+}
+
+// MarshalBinary implements encoding.BinaryMarshaler. The result
+// can be unmarshalled into a Sketch.
+func (s *SketchSnapshot) MarshalBinary() ([]byte, error) {
+	return s.state.appendBinary(nil), nil
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler. It accepts
+// the serialised form of a Sketch or a SketchSnapshot.
+func (s *SketchSnapshot) UnmarshalBinary(data []byte) error {
+	var state sketchState
+	if err := state.unmarshalBinary(data); err != nil {
+		return err
+	}
+
+	*s = *state.snapshot()
+	return nil
+}
+
+// --------------------------------------------------------------------
+
+func appendVarint(b []byte, v int64) []byte {
+	var buf [binary.MaxVarintLen64]byte
+	n := binary.PutVarint(buf[:], v)
+	return append(b, buf[:n]...)
+}
+
+// appendBuckets appends a range of bucket counts, starting at offset.
+func appendBuckets(dst []byte, offset int, counts []uint64) []byte {
+	dst = appendVarint(dst, int64(offset))
+	dst = appendUvarint(dst, uint64(len(counts)))
+	for _, c := range counts {
+		dst = appendUvarint(dst, c)
+	}
+	return dst
+}
+
+func (r *binaryReader) buckets() (offset int, counts []uint64) {
+	offset = int(r.varint())
+	n := r.uvarint()
+	if n == 0 {
+		return
+	} else if n > uint64(len(r.data)) {
+		r.err = true
+		return
+	}
+	counts = make([]uint64, int(n))
+	for i := range counts {
+		counts[i] = r.uvarint()
+	}
+	return
+}
+
+func (r *binaryReader) varint() int64 {
+	v, n := binary.Varint(r.data)
+	if n <= 0 {
+		r.err = true
+		r.data = nil
+		return 0
+	}
+	r.data = r.data[n:]
+	return v
+}
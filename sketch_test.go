@@ -0,0 +1,144 @@
+package instruments
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"sync"
+
+	"github.com/bsm/ginkgo/v2"
+	. "github.com/bsm/gomega"
+)
+
+var _ = ginkgo.Describe("Sketch", func() {
+	exactQuantile := func(sorted []float64, q float64) float64 {
+		return sorted[int(q*float64(len(sorted)-1))]
+	}
+
+	ginkgo.It("should guarantee relative accuracy", func() {
+		rnd := rand.New(rand.NewSource(1))
+		s := NewSketch(0.01)
+
+		values := make([]float64, 10000)
+		for i := range values {
+			values[i] = math.Exp(rnd.NormFloat64()*2 + 3)
+			s.Update(values[i])
+		}
+		sort.Float64s(values)
+
+		d := s.Snapshot()
+		Expect(d.Count()).To(Equal(10000))
+		Expect(d.Min()).To(Equal(values[0]))
+		Expect(d.Max()).To(Equal(values[len(values)-1]))
+		for _, q := range []float64{0.01, 0.1, 0.5, 0.9, 0.99, 0.999} {
+			exact := exactQuantile(values, q)
+			Expect(d.Quantile(q)).To(BeNumerically("~", exact, exact*0.01), "q=%v", q)
+		}
+	})
+
+	ginkgo.It("should track negative values and zeros", func() {
+		s := NewSketch(0.01)
+		for _, v := range []float64{-100, -10, 0, 10, 100} {
+			s.Update(v)
+		}
+
+		d := s.Snapshot()
+		Expect(d.NumBins()).To(Equal(5))
+		Expect(d.Quantile(0.25)).To(BeNumerically("~", -10, 0.1))
+		Expect(d.Quantile(0.5)).To(Equal(0.0))
+		Expect(d.Quantile(0.75)).To(BeNumerically("~", 10, 0.1))
+		Expect(d.Mean()).To(Equal(0.0))
+	})
+
+	ginkgo.It("should collapse lowest buckets", func() {
+		s := NewSketchSize(0.01, 10)
+		for i := 1; i <= 1000; i++ {
+			s.Update(float64(i))
+		}
+
+		d := s.Snapshot()
+		Expect(d.NumBins()).To(Equal(10))
+		Expect(d.Count()).To(Equal(1000))
+		Expect(d.Quantile(0.999)).To(BeNumerically("~", 999, 10))
+	})
+
+	ginkgo.It("should merge", func() {
+		a, b := NewSketch(0.01), NewSketch(0.01)
+		for i := 1; i <= 100; i++ {
+			a.Update(float64(i))
+			b.Update(float64(i + 100))
+		}
+		Expect(a.Merge(b)).To(Succeed())
+
+		d := a.Snapshot()
+		Expect(d.Count()).To(Equal(200))
+		Expect(d.Min()).To(Equal(1.0))
+		Expect(d.Max()).To(Equal(200.0))
+		Expect(d.Quantile(0.5)).To(BeNumerically("~", 100, 1))
+
+		Expect(a.Merge(NewSketch(0.05))).To(Succeed()) // empty
+		c := NewSketch(0.05)
+		c.Update(1)
+		Expect(a.Merge(c)).To(MatchError(errSketchMismatch))
+	})
+
+	ginkgo.It("should serialise", func() {
+		s := NewSketch(0.02)
+		for _, v := range []float64{-3, 0, 1, 2, 3, 500} {
+			s.Update(v)
+		}
+
+		data, err := s.MarshalBinary()
+		Expect(err).NotTo(HaveOccurred())
+
+		t := new(Sketch)
+		Expect(t.UnmarshalBinary(data)).To(Succeed())
+		Expect(t.RelativeAccuracy()).To(Equal(0.02))
+		Expect(t.Snapshot()).To(Equal(s.Snapshot()))
+
+		data2, err := s.Snapshot().(*SketchSnapshot).MarshalBinary()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(data2).To(Equal(data))
+
+		u := new(SketchSnapshot)
+		Expect(u.UnmarshalBinary(data)).To(Succeed())
+		Expect(u).To(Equal(s.Snapshot()))
+
+		Expect(t.UnmarshalBinary(data[:len(data)-1])).To(MatchError(errInvalidSketch))
+		Expect(t.UnmarshalBinary(nil)).To(MatchError(errInvalidSketch))
+	})
+
+	ginkgo.It("should reset", func() {
+		s := NewSketch(0.01)
+		s.Update(3)
+		s.Update(4)
+		Expect(s.Reset().Mean()).To(Equal(3.5))
+		Expect(s.Snapshot().Count()).To(Equal(0))
+		Expect(s.RelativeAccuracy()).To(Equal(0.01))
+	})
+
+	ginkgo.It("should update atomically", func() {
+		s := NewSketch(0.01)
+
+		var wg sync.WaitGroup
+		for i := 0; i < 4; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for j := 0; j < 1000; j++ {
+					s.Update(1)
+				}
+			}()
+		}
+		wg.Wait()
+		Expect(s.Snapshot().Count()).To(Equal(4000))
+	})
+
+	ginkgo.It("should fetch from registry", func() {
+		r := NewUnstarted("")
+		s := r.Sketch("s", nil)
+		Expect(r.Sketch("s", nil)).To(BeIdenticalTo(s))
+		Expect(s.RelativeAccuracy()).To(Equal(DefaultSketchAccuracy))
+		Expect(r.SketchAccuracy("t", nil, 0.05).RelativeAccuracy()).To(Equal(0.05))
+	})
+})
@@ -0,0 +1,440 @@
+// Package spool implements a reporter wrapper which buffers flush cycles
+// on disk while the wrapped reporter is failing, and replays them once
+// it succeeds again.
+package spool
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bsm/instruments"
+)
+
+var _ instruments.MetadataReporter = (*Reporter)(nil)
+
+const segmentExt = ".seg"
+
+// Options configure the reporter.
+type Options struct {
+	// SegmentSize is the size at which segments are rotated.
+	// Default: 4MiB
+	SegmentSize int64
+
+	// MaxSize is the maximum total size of all segments. The oldest
+	// segments are discarded when exceeded.
+	// Default: 64MiB
+	MaxSize int64
+
+	// MaxAge is the maximum age of a segment. Older
+	// segments are discarded without being replayed.
+	// Default: 24h
+	MaxAge time.Duration
+
+	// RetryInterval is the interval at which replays are retried.
+	// Default: 10s
+	RetryInterval time.Duration
+
+	// MaxAttempts is the number of attempts to deliver a cycle before it
+	// is skipped. Cycles which fail with a permanent error are skipped
+	// immediately. Errors are permanent if they implement Permanent() bool
+	// and return true, like *datadog.APIError for rejected requests.
+	// Default: 0 (unlimited)
+	MaxAttempts int
+
+	// OnError is called with errors returned by the wrapped reporter.
+	OnError func(error)
+}
+
+func (o *Options) norm() *Options {
+	var oo Options
+	if o != nil {
+		oo = *o
+	}
+	if oo.SegmentSize < 1 {
+		oo.SegmentSize = 4 * 1024 * 1024
+	}
+	if oo.MaxSize < 1 {
+		oo.MaxSize = 64 * 1024 * 1024
+	}
+	if oo.MaxAge < 1 {
+		oo.MaxAge = 24 * time.Hour
+	}
+	if oo.RetryInterval < 1 {
+		oo.RetryInterval = 10 * time.Second
+	}
+	return &oo
+}
+
+// Reporter wraps another reporter. It appends each flush cycle to a
+// segment file in a local directory and replays segments in order to
+// the wrapped reporter in a background goroutine. Segments are removed
+// once delivered.
+//
+// Delivery is at-least-once: cycles of a partially delivered segment
+// may be replayed again after a restart. Please note that the wrapped
+// reporter's Prep is called at the time of replay rather than at the
+// beginning of the original cycle.
+type Reporter struct {
+	dir string
+	rep instruments.Reporter
+	opt *Options
+
+	curr []byte
+
+	file     *os.File
+	active   *segment
+	segments []*segment // closed segments, oldest first
+	seq      uint64
+	mutex    sync.Mutex
+
+	notify  chan struct{}
+	closing chan struct{}
+	done    chan struct{}
+
+	discarded uint64
+	skipped   uint64
+}
+
+// New opens a spool in dir and starts the background replay.
+// Existing segments in dir are replayed first.
+// You must call Close() to release resources.
+func New(dir string, rep instruments.Reporter, opt *Options) (*Reporter, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	r := &Reporter{
+		dir:     dir,
+		rep:     rep,
+		opt:     opt.norm(),
+		notify:  make(chan struct{}, 1),
+		closing: make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	if err := r.scan(); err != nil {
+		return nil, err
+	}
+
+	go r.loop()
+	r.trigger()
+	return r, nil
+}
+
+// Discarded returns the number of discarded segments.
+func (r *Reporter) Discarded() uint64 {
+	return atomic.LoadUint64(&r.discarded)
+}
+
+// Skipped returns the number of skipped cycles.
+func (r *Reporter) Skipped() uint64 {
+	return atomic.LoadUint64(&r.skipped)
+}
+
+// Prep implements instruments.Reporter
+func (r *Reporter) Prep() error {
+	r.curr = r.curr[:0]
+	return nil
+}
+
+// Discrete implements instruments.Reporter
+func (r *Reporter) Discrete(name string, tags []string, val float64) error {
+	return r.append(&entry{Name: name, Tags: tags, Value: val})
+}
+
+// DiscreteWithMetadata implements instruments.MetadataReporter
+func (r *Reporter) DiscreteWithMetadata(name string, tags []string, meta instruments.Metadata, val float64) error {
+	return r.append(&entry{Name: name, Tags: tags, Value: val, Meta: &meta})
+}
+
+// Sample implements instruments.Reporter
+func (r *Reporter) Sample(name string, tags []string, dist instruments.Distribution) error {
+	return r.append(&entry{Name: name, Tags: tags, Dist: dist})
+}
+
+// SampleWithMetadata implements instruments.MetadataReporter
+func (r *Reporter) SampleWithMetadata(name string, tags []string, meta instruments.Metadata, dist instruments.Distribution) error {
+	return r.append(&entry{Name: name, Tags: tags, Dist: dist, Meta: &meta})
+}
+
+// Flush implements instruments.Reporter
+func (r *Reporter) Flush() error {
+	if len(r.curr) == 0 {
+		return nil
+	}
+
+	frame := appendFrame(nil, r.curr)
+	r.curr = r.curr[:0]
+
+	r.mutex.Lock()
+	err := r.write(frame)
+	r.mutex.Unlock()
+
+	r.trigger()
+	return err
+}
+
+// Close stops the background replay and closes the active segment.
+// Undelivered cycles remain on disk and are replayed on next start.
+func (r *Reporter) Close() error {
+	close(r.closing)
+	<-r.done
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	active := r.active
+	if err := r.rotate(); err != nil {
+		return err
+	}
+	if active != nil && active.Offset >= active.Size {
+		r.remove(active)
+	}
+	return nil
+}
+
+func (r *Reporter) append(e *entry) error {
+	data, err := appendEntry(r.curr, e)
+	if err != nil {
+		return err
+	}
+	r.curr = data
+	return nil
+}
+
+// scan registers existing segments.
+func (r *Reporter) scan() error {
+	matches, err := filepath.Glob(filepath.Join(r.dir, "*"+segmentExt))
+	if err != nil {
+		return err
+	}
+	sort.Strings(matches)
+
+	for _, path := range matches {
+		seq, err := strconv.ParseUint(strings.TrimSuffix(filepath.Base(path), segmentExt), 10, 64)
+		if err != nil {
+			continue
+		}
+		if seq > r.seq {
+			r.seq = seq
+		}
+
+		info, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		r.segments = append(r.segments, &segment{Path: path, Size: info.Size(), ModTime: info.ModTime()})
+	}
+	return nil
+}
+
+// write appends a frame to the active segment, must be called within lock.
+func (r *Reporter) write(frame []byte) error {
+	if r.file == nil {
+		r.seq++
+		path := filepath.Join(r.dir, fmt.Sprintf("%020d%s", r.seq, segmentExt))
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return err
+		}
+		r.file = f
+		r.active = &segment{Path: path, ModTime: time.Now()}
+	}
+
+	if err := r.writeFrame(frame); err != nil {
+		// Remove partially written data, so subsequent frames are not
+		// appended after a torn frame. Rotate if that fails.
+		if r.file.Truncate(r.active.Size) != nil {
+			_ = r.rotate()
+		}
+		return err
+	}
+
+	r.active.Size += int64(len(frame))
+	if r.active.Size >= r.opt.SegmentSize {
+		if err := r.rotate(); err != nil {
+			return err
+		}
+	}
+
+	r.truncate()
+	return nil
+}
+
+func (r *Reporter) writeFrame(frame []byte) error {
+	if _, err := r.file.Write(frame); err != nil {
+		return err
+	}
+	return r.file.Sync()
+}
+
+// rotate closes the active segment, must be called within lock.
+func (r *Reporter) rotate() error {
+	if r.file == nil {
+		return nil
+	}
+
+	f, s := r.file, r.active
+	r.file, r.active = nil, nil
+	r.segments = append(r.segments, s)
+	return f.Close()
+}
+
+// truncate discards the oldest segments when MaxSize is exceeded,
+// must be called within lock.
+func (r *Reporter) truncate() {
+	var size int64
+	for _, s := range r.segments {
+		size += s.Size
+	}
+	if r.active != nil {
+		size += r.active.Size
+	}
+
+	for size > r.opt.MaxSize && len(r.segments) != 0 {
+		s := r.segments[0]
+		size -= s.Size
+		r.discard(s)
+	}
+}
+
+// discard removes an undelivered segment, must be called within lock.
+func (r *Reporter) discard(s *segment) {
+	if r.remove(s) {
+		atomic.AddUint64(&r.discarded, 1)
+	}
+}
+
+// remove removes a closed segment, must be called within lock.
+func (r *Reporter) remove(s *segment) bool {
+	for i, x := range r.segments {
+		if x == s {
+			r.segments = append(r.segments[:i], r.segments[i+1:]...)
+			_ = os.Remove(s.Path)
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Reporter) trigger() {
+	select {
+	case r.notify <- struct{}{}:
+	default:
+	}
+}
+
+func (r *Reporter) loop() {
+	defer close(r.done)
+
+	ticker := time.NewTicker(r.opt.RetryInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.closing:
+			return
+		case <-r.notify:
+		case <-ticker.C:
+		}
+
+		if err := r.replay(); err != nil {
+			r.onError(err)
+		}
+	}
+}
+
+// replay delivers closed segments in order, removing them once
+// delivered. Once all closed segments are delivered, the pending
+// frames of the active segment are delivered too.
+func (r *Reporter) replay() error {
+	r.mutex.Lock()
+	segments := append([]*segment(nil), r.segments...)
+	active := r.active
+	r.mutex.Unlock()
+
+	for _, s := range segments {
+		if time.Since(s.ModTime) > r.opt.MaxAge {
+			r.mutex.Lock()
+			r.discard(s)
+			r.mutex.Unlock()
+			continue
+		}
+
+		if err := r.replaySegment(s); err != nil {
+			return err
+		}
+
+		r.mutex.Lock()
+		r.remove(s)
+		r.mutex.Unlock()
+	}
+
+	if active != nil {
+		return r.replaySegment(active)
+	}
+	return nil
+}
+
+// replaySegment delivers all frames of a segment after the delivered
+// offset. Frames which cannot be decoded, fail permanently or exceed
+// MaxAttempts are skipped.
+func (r *Reporter) replaySegment(s *segment) error {
+	err := readFrames(s.Path, s.Offset, func(payload []byte, next int64) error {
+		entries, err := decodeEntries(payload)
+		if err == nil {
+			err = deliver(r.rep, entries)
+			if s.Attempts++; err != nil && !isPermanent(err) && (r.opt.MaxAttempts < 1 || s.Attempts < r.opt.MaxAttempts) {
+				return err
+			}
+		}
+		if err != nil {
+			atomic.AddUint64(&r.skipped, 1)
+			r.onError(err)
+		}
+		s.Offset, s.Attempts = next, 0
+		return nil
+	})
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+func (r *Reporter) onError(err error) {
+	if r.opt.OnError != nil {
+		r.opt.OnError(err)
+	}
+}
+
+// isPermanent reports whether err cannot be resolved by retrying.
+func isPermanent(err error) bool {
+	var p interface{ Permanent() bool }
+	return errors.As(err, &p) && p.Permanent()
+}
+
+func deliver(rep instruments.Reporter, entries []entry) error {
+	if err := rep.Prep(); err != nil {
+		return err
+	}
+
+	for _, e := range entries {
+		var err error
+		if e.Dist != nil {
+			err = instruments.ReportSample(rep, e.Name, e.Tags, e.Meta, e.Dist)
+		} else {
+			err = instruments.ReportDiscrete(rep, e.Name, e.Tags, e.Meta, e.Value)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return rep.Flush()
+}
@@ -0,0 +1,395 @@
+package spool
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bsm/ginkgo/v2"
+	. "github.com/bsm/gomega"
+	"github.com/bsm/instruments"
+)
+
+var _ = ginkgo.Describe("Reporter", func() {
+	var subject *Reporter
+	var target *mockReporter
+	var dir string
+
+	cycle := func(vals ...float64) {
+		Expect(subject.Prep()).To(Succeed())
+		for _, v := range vals {
+			Expect(subject.Discrete("cnt", []string{"a"}, v)).To(Succeed())
+		}
+		Expect(subject.Flush()).To(Succeed())
+	}
+
+	open := func(opt *Options) {
+		var err error
+		subject, err = New(dir, target, opt)
+		Expect(err).NotTo(HaveOccurred())
+	}
+
+	segments := func() []string {
+		matches, err := filepath.Glob(filepath.Join(dir, "*.seg"))
+		Expect(err).NotTo(HaveOccurred())
+		return matches
+	}
+
+	ginkgo.BeforeEach(func() {
+		dir = ginkgo.GinkgoT().TempDir()
+		target = new(mockReporter)
+	})
+
+	ginkgo.It("should deliver cycles", func() {
+		open(&Options{RetryInterval: 10 * time.Millisecond})
+
+		cycle(1, 2)
+		Expect(subject.Prep()).To(Succeed())
+		Expect(subject.DiscreteWithMetadata("cnt", []string{"b"}, instruments.Metadata{Kind: instruments.KindCounter}, 3)).To(Succeed())
+		Expect(subject.DiscreteWithMetadata("mem", nil, instruments.Metadata{Unit: "By"}, 7)).To(Succeed())
+		Expect(subject.DiscreteWithMetadata("total", nil, instruments.Metadata{Kind: instruments.KindCumulative, StartTime: time.Unix(1414141414, 0), Delta: 2}, 9)).To(Succeed())
+		Expect(subject.Sample("tmr", nil, newDistribution(4, 6))).To(Succeed())
+		Expect(subject.Flush()).To(Succeed())
+
+		Eventually(target.Cycles).Should(Equal([][]string{
+			{"cnt|a=1", "cnt|a=2"},
+			{"cnt|b=3(counter)", "mem=7(gauge,By)", "total=9(cumulative,+2@1414141414)", "tmr=5"},
+		}))
+		Expect(subject.Close()).To(Succeed())
+		Expect(segments()).To(BeEmpty())
+	})
+
+	ginkgo.It("should buffer and replay in order", func() {
+		var errs []error
+		var mu sync.Mutex
+		target.Fail(errors.New("doh!"))
+		open(&Options{
+			RetryInterval: 10 * time.Millisecond,
+			OnError: func(err error) {
+				mu.Lock()
+				errs = append(errs, err)
+				mu.Unlock()
+			},
+		})
+
+		cycle(1)
+		cycle(2)
+		cycle(3)
+		Eventually(func() int {
+			mu.Lock()
+			defer mu.Unlock()
+			return len(errs)
+		}).Should(BeNumerically(">", 0))
+		Expect(target.Cycles()).To(BeEmpty())
+
+		target.Fail(nil)
+		Eventually(target.Cycles).Should(Equal([][]string{
+			{"cnt|a=1"},
+			{"cnt|a=2"},
+			{"cnt|a=3"},
+		}))
+		Expect(subject.Close()).To(Succeed())
+	})
+
+	ginkgo.It("should replay existing segments on start", func() {
+		target.Fail(errors.New("doh!"))
+		open(&Options{RetryInterval: time.Hour})
+		cycle(1)
+		cycle(2)
+		Expect(subject.Close()).To(Succeed())
+		Expect(segments()).To(HaveLen(1))
+
+		target.Fail(nil)
+		open(&Options{RetryInterval: time.Hour})
+		Eventually(target.Cycles).Should(Equal([][]string{
+			{"cnt|a=1"},
+			{"cnt|a=2"},
+		}))
+
+		cycle(3)
+		Eventually(target.Cycles).Should(HaveLen(3))
+		Expect(subject.Close()).To(Succeed())
+		Expect(segments()).To(BeEmpty())
+	})
+
+	ginkgo.It("should recover from torn writes", func() {
+		target.Fail(errors.New("doh!"))
+		open(&Options{RetryInterval: time.Hour})
+		cycle(1)
+		cycle(2)
+		Expect(subject.Close()).To(Succeed())
+
+		paths := segments()
+		Expect(paths).To(HaveLen(1))
+		f, err := os.OpenFile(paths[0], os.O_WRONLY|os.O_APPEND, 0o644)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = f.Write(appendFrame(nil, []byte("partial"))[:10])
+		Expect(err).NotTo(HaveOccurred())
+		Expect(f.Close()).To(Succeed())
+
+		target.Fail(nil)
+		open(&Options{RetryInterval: time.Hour})
+		Eventually(target.Cycles).Should(Equal([][]string{
+			{"cnt|a=1"},
+			{"cnt|a=2"},
+		}))
+		Expect(subject.Close()).To(Succeed())
+		Expect(segments()).To(BeEmpty())
+	})
+
+	ginkgo.It("should not append after failed writes", func() {
+		target.Fail(errors.New("doh!"))
+		open(&Options{RetryInterval: time.Hour})
+		cycle(1)
+
+		subject.mutex.Lock()
+		Expect(subject.file.Close()).To(Succeed())
+		subject.mutex.Unlock()
+
+		Expect(subject.Prep()).To(Succeed())
+		Expect(subject.Discrete("cnt", []string{"a"}, 2)).To(Succeed())
+		Expect(subject.Flush()).To(MatchError(os.ErrClosed))
+		cycle(3)
+		Expect(segments()).To(HaveLen(2))
+
+		target.Fail(nil)
+		subject.trigger()
+		Eventually(target.Cycles).Should(Equal([][]string{
+			{"cnt|a=1"},
+			{"cnt|a=3"},
+		}))
+		Expect(subject.Close()).To(Succeed())
+		Expect(segments()).To(BeEmpty())
+	})
+
+	ginkgo.It("should discard oldest segments when full", func() {
+		target.Fail(errors.New("doh!"))
+		open(&Options{RetryInterval: time.Hour, SegmentSize: 1, MaxSize: 100})
+		for i := 1; i <= 6; i++ {
+			cycle(float64(i))
+		}
+		Expect(subject.Discarded()).To(Equal(uint64(2)))
+		Expect(segments()).To(HaveLen(4))
+
+		target.Fail(nil)
+		subject.trigger()
+		Eventually(target.Cycles).Should(Equal([][]string{
+			{"cnt|a=3"},
+			{"cnt|a=4"},
+			{"cnt|a=5"},
+			{"cnt|a=6"},
+		}))
+		Expect(subject.Close()).To(Succeed())
+	})
+
+	ginkgo.It("should skip permanently rejected cycles", func() {
+		var errs []error
+		var mu sync.Mutex
+		target.Reject("cnt|a=2", permanentError{})
+		open(&Options{
+			RetryInterval: 10 * time.Millisecond,
+			OnError: func(err error) {
+				mu.Lock()
+				errs = append(errs, err)
+				mu.Unlock()
+			},
+		})
+
+		cycle(1)
+		cycle(2)
+		cycle(3)
+		Eventually(target.Cycles).Should(Equal([][]string{
+			{"cnt|a=1"},
+			{"cnt|a=3"},
+		}))
+		Expect(subject.Skipped()).To(Equal(uint64(1)))
+		Expect(subject.Close()).To(Succeed())
+
+		mu.Lock()
+		defer mu.Unlock()
+		Expect(errs).To(Equal([]error{permanentError{}}))
+	})
+
+	ginkgo.It("should skip invalid cycles", func() {
+		var errs []error
+		var mu sync.Mutex
+		target.Fail(errors.New("doh!"))
+		open(&Options{RetryInterval: time.Hour})
+		cycle(1)
+		Expect(subject.Close()).To(Succeed())
+
+		paths := segments()
+		Expect(paths).To(HaveLen(1))
+		f, err := os.OpenFile(paths[0], os.O_WRONLY|os.O_APPEND, 0o644)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = f.Write(appendFrame(nil, []byte("invalid")))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(f.Close()).To(Succeed())
+
+		target.Fail(nil)
+		open(&Options{
+			RetryInterval: time.Hour,
+			OnError: func(err error) {
+				mu.Lock()
+				errs = append(errs, err)
+				mu.Unlock()
+			},
+		})
+		cycle(2)
+		Eventually(target.Cycles).Should(Equal([][]string{
+			{"cnt|a=1"},
+			{"cnt|a=2"},
+		}))
+		Expect(subject.Skipped()).To(Equal(uint64(1)))
+		Expect(subject.Close()).To(Succeed())
+
+		mu.Lock()
+		defer mu.Unlock()
+		Expect(errs).To(Equal([]error{errInvalidCycle}))
+	})
+
+	ginkgo.It("should skip cycles after max attempts", func() {
+		target.Reject("cnt|a=2", errors.New("doh!"))
+		open(&Options{RetryInterval: 10 * time.Millisecond, MaxAttempts: 3})
+
+		cycle(1)
+		cycle(2)
+		cycle(3)
+		Eventually(target.Cycles).Should(Equal([][]string{
+			{"cnt|a=1"},
+			{"cnt|a=3"},
+		}))
+		Expect(subject.Skipped()).To(Equal(uint64(1)))
+		Expect(target.Rejected()).To(Equal(3))
+		Expect(subject.Close()).To(Succeed())
+	})
+
+	ginkgo.It("should discard expired segments", func() {
+		target.Fail(errors.New("doh!"))
+		open(&Options{RetryInterval: time.Hour})
+		cycle(1)
+		Expect(subject.Close()).To(Succeed())
+
+		paths := segments()
+		Expect(paths).To(HaveLen(1))
+		old := time.Now().Add(-2 * time.Hour)
+		Expect(os.Chtimes(paths[0], old, old)).To(Succeed())
+
+		target.Fail(nil)
+		open(&Options{RetryInterval: time.Hour, MaxAge: time.Hour})
+		Eventually(subject.Discarded).Should(Equal(uint64(1)))
+		Expect(subject.Close()).To(Succeed())
+		Expect(target.Cycles()).To(BeEmpty())
+		Expect(segments()).To(BeEmpty())
+	})
+})
+
+// --------------------------------------------------------------------
+
+func TestSuite(t *testing.T) {
+	RegisterFailHandler(ginkgo.Fail)
+	ginkgo.RunSpecs(t, "instruments/spool")
+}
+
+func newDistribution(vals ...float64) instruments.Distribution {
+	r := instruments.NewReservoir()
+	for _, v := range vals {
+		r.Update(v)
+	}
+	return r.Snapshot()
+}
+
+type permanentError struct{}
+
+func (permanentError) Error() string   { return "rejected" }
+func (permanentError) Permanent() bool { return true }
+
+type mockReporter struct {
+	fail    error
+	reject  map[string]error
+	rejects int
+	current []string
+	cycles  [][]string
+	mutex   sync.Mutex
+}
+
+func (m *mockReporter) Fail(err error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.fail = err
+}
+
+// Reject fails all cycles which contain the given entry.
+func (m *mockReporter) Reject(entry string, err error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.reject = map[string]error{entry: err}
+}
+
+func (m *mockReporter) Rejected() int {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.rejects
+}
+
+func (m *mockReporter) Cycles() [][]string {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.cycles
+}
+
+func (m *mockReporter) Prep() error {
+	m.current = nil
+	return nil
+}
+
+func (m *mockReporter) Discrete(name string, tags []string, val float64) error {
+	m.current = append(m.current, instruments.MetricID(name, tags)+"="+formatFloat(val))
+	return nil
+}
+
+func (m *mockReporter) DiscreteWithMetadata(name string, tags []string, meta instruments.Metadata, val float64) error {
+	desc := meta.Kind.String()
+	if meta.Unit != "" {
+		desc += "," + meta.Unit
+	}
+	if meta.Kind == instruments.KindCumulative {
+		desc += ",+" + formatFloat(meta.Delta) + "@" + strconv.FormatInt(meta.StartTime.Unix(), 10)
+	}
+	m.current = append(m.current, instruments.MetricID(name, tags)+"="+formatFloat(val)+"("+desc+")")
+	return nil
+}
+
+func (m *mockReporter) Sample(name string, tags []string, dist instruments.Distribution) error {
+	m.current = append(m.current, instruments.MetricID(name, tags)+"="+formatFloat(dist.Mean()))
+	return nil
+}
+
+func (m *mockReporter) SampleWithMetadata(name string, tags []string, _ instruments.Metadata, dist instruments.Distribution) error {
+	return m.Sample(name, tags, dist)
+}
+
+func (m *mockReporter) Flush() error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if m.fail != nil {
+		return m.fail
+	}
+	for _, e := range m.current {
+		if err := m.reject[e]; err != nil {
+			m.rejects++
+			return err
+		}
+	}
+	m.cycles = append(m.cycles, m.current)
+	return nil
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
@@ -0,0 +1,308 @@
+package spool
+
+import (
+	"encoding"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"math"
+	"os"
+	"time"
+
+	"github.com/bsm/instruments"
+)
+
+// Each segment is a sequence of frames:
+//
+//	[4 byte payload length][4 byte CRC32-C of payload][payload]
+//
+// Frames are appended and synced one cycle at a time. A torn or corrupt
+// frame marks the end of a segment, all preceding frames remain valid.
+
+const frameHeaderSize = 8
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+var errInvalidCycle = errors.New("spool: invalid cycle")
+
+type segment struct {
+	Path    string
+	Size    int64
+	ModTime time.Time
+	Offset  int64 // delivered offset
+
+	Attempts int // failed attempts at offset
+}
+
+func appendFrame(dst, payload []byte) []byte {
+	var hdr [frameHeaderSize]byte
+	binary.LittleEndian.PutUint32(hdr[0:], uint32(len(payload)))
+	binary.LittleEndian.PutUint32(hdr[4:], crc32.Checksum(payload, crcTable))
+	dst = append(dst, hdr[:]...)
+	return append(dst, payload...)
+}
+
+// readFrames reads all valid frames of a segment, starting at offset.
+// It calls fn with each payload and the offset of the next frame.
+func readFrames(path string, offset int64, fn func(payload []byte, next int64) error) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	for pos := offset; pos+frameHeaderSize <= int64(len(data)); {
+		size := int64(binary.LittleEndian.Uint32(data[pos:]))
+		csum := binary.LittleEndian.Uint32(data[pos+4:])
+		end := pos + frameHeaderSize + size
+		if end > int64(len(data)) {
+			return nil // torn write
+		}
+
+		payload := data[pos+frameHeaderSize : end]
+		if crc32.Checksum(payload, crcTable) != csum {
+			return nil // corrupt frame
+		}
+		if err := fn(payload, end); err != nil {
+			return err
+		}
+		pos = end
+	}
+	return nil
+}
+
+// --------------------------------------------------------------------
+
+const (
+	entryDiscrete byte = iota
+	entrySample
+	entryHistogram
+	entryExpHistogram
+	entrySketch
+)
+
+const (
+	flagMetadata byte = 1 << iota
+	flagUnit
+	flagCumulative
+)
+
+type entry struct {
+	Name  string
+	Tags  []string
+	Value float64
+	Dist  instruments.Distribution
+	Meta  *instruments.Metadata
+}
+
+func appendEntry(dst []byte, e *entry) ([]byte, error) {
+	var dist encoding.BinaryMarshaler
+	if e.Dist != nil {
+		var typ byte
+		typ, dist = sampleEncoding(e.Dist)
+		dst = append(dst, typ)
+	} else {
+		dst = append(dst, entryDiscrete)
+	}
+	if e.Meta == nil {
+		dst = append(dst, 0)
+	} else {
+		flags := flagMetadata
+		if e.Meta.Unit != "" {
+			flags |= flagUnit
+		}
+		if e.Meta.Kind == instruments.KindCumulative {
+			flags |= flagCumulative
+		}
+
+		dst = append(dst, flags, byte(e.Meta.Kind))
+		if flags&flagUnit != 0 {
+			dst = appendString(dst, e.Meta.Unit)
+		}
+		if flags&flagCumulative != 0 {
+			var start uint64
+			if !e.Meta.StartTime.IsZero() {
+				start = uint64(e.Meta.StartTime.UnixNano())
+			}
+			dst = appendUvarint(dst, start)
+			dst = appendFloat64(dst, e.Meta.Delta)
+		}
+	}
+
+	dst = appendString(dst, e.Name)
+	dst = appendUvarint(dst, uint64(len(e.Tags)))
+	for _, t := range e.Tags {
+		dst = appendString(dst, t)
+	}
+
+	if dist == nil {
+		return appendFloat64(dst, e.Value), nil
+	}
+
+	data, err := dist.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	dst = appendUvarint(dst, uint64(len(data)))
+	return append(dst, data...), nil
+}
+
+func decodeEntries(data []byte) ([]entry, error) {
+	var entries []entry
+	r := reader{data: data}
+	for len(r.data) != 0 && !r.err {
+		var e entry
+
+		typ, flags := r.byte(), r.byte()
+		if flags&flagMetadata != 0 {
+			e.Meta = &instruments.Metadata{Kind: instruments.Kind(r.byte())}
+			if flags&flagUnit != 0 {
+				e.Meta.Unit = r.string()
+			}
+			if flags&flagCumulative != 0 {
+				if start := r.uvarint(); start != 0 {
+					e.Meta.StartTime = time.Unix(0, int64(start))
+				}
+				e.Meta.Delta = r.float64()
+			}
+		}
+
+		e.Name = r.string()
+		if n := r.uvarint(); n != 0 && n <= uint64(len(r.data)) {
+			e.Tags = make([]string, int(n))
+			for i := range e.Tags {
+				e.Tags[i] = r.string()
+			}
+		} else if n != 0 {
+			r.err = true
+		}
+
+		switch typ {
+		case entryDiscrete:
+			e.Value = r.float64()
+		default:
+			dist := newSample(typ)
+			if dist == nil {
+				r.err = true
+				break
+			}
+			if err := dist.UnmarshalBinary(r.bytes()); err != nil {
+				r.fail()
+				break
+			}
+			e.Dist = dist
+		}
+		entries = append(entries, e)
+	}
+	if r.err {
+		return nil, errInvalidCycle
+	}
+	return entries, nil
+}
+
+// sampleEncoding returns the entry type and the encoding of d. Built-in
+// snapshots are encoded as they are, to preserve their quantile
+// algorithms, other distributions are copied.
+func sampleEncoding(d instruments.Distribution) (byte, encoding.BinaryMarshaler) {
+	switch s := d.(type) {
+	case *instruments.HistogramSnapshot:
+		return entryHistogram, s
+	case *instruments.ExpHistogramSnapshot:
+		return entryExpHistogram, s
+	case *instruments.SketchSnapshot:
+		return entrySketch, s
+	case *instruments.DistributionSnapshot:
+		return entrySample, s
+	}
+	return entrySample, instruments.CopyDistribution(d)
+}
+
+type sample interface {
+	instruments.Distribution
+	encoding.BinaryUnmarshaler
+}
+
+func newSample(typ byte) sample {
+	switch typ {
+	case entrySample:
+		return new(instruments.DistributionSnapshot)
+	case entryHistogram:
+		return new(instruments.HistogramSnapshot)
+	case entryExpHistogram:
+		return new(instruments.ExpHistogramSnapshot)
+	case entrySketch:
+		return new(instruments.SketchSnapshot)
+	}
+	return nil
+}
+
+func appendUvarint(b []byte, v uint64) []byte {
+	var buf [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(buf[:], v)
+	return append(b, buf[:n]...)
+}
+
+func appendString(b []byte, s string) []byte {
+	b = appendUvarint(b, uint64(len(s)))
+	return append(b, s...)
+}
+
+func appendFloat64(b []byte, v float64) []byte {
+	var buf [8]byte
+	binary.LittleEndian.PutUint64(buf[:], math.Float64bits(v))
+	return append(b, buf[:]...)
+}
+
+type reader struct {
+	data []byte
+	err  bool
+}
+
+func (r *reader) fail() {
+	r.err = true
+	r.data = nil
+}
+
+func (r *reader) byte() byte {
+	if len(r.data) < 1 {
+		r.fail()
+		return 0
+	}
+	v := r.data[0]
+	r.data = r.data[1:]
+	return v
+}
+
+func (r *reader) uvarint() uint64 {
+	v, n := binary.Uvarint(r.data)
+	if n <= 0 {
+		r.fail()
+		return 0
+	}
+	r.data = r.data[n:]
+	return v
+}
+
+func (r *reader) bytes() []byte {
+	n := r.uvarint()
+	if n > uint64(len(r.data)) {
+		r.fail()
+		return nil
+	}
+	v := r.data[:n]
+	r.data = r.data[n:]
+	return v
+}
+
+func (r *reader) string() string {
+	return string(r.bytes())
+}
+
+func (r *reader) float64() float64 {
+	if len(r.data) < 8 {
+		r.fail()
+		return 0
+	}
+	v := math.Float64frombits(binary.LittleEndian.Uint64(r.data))
+	r.data = r.data[8:]
+	return v
+}
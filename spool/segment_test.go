@@ -0,0 +1,63 @@
+package spool
+
+import (
+	"github.com/bsm/ginkgo/v2"
+	. "github.com/bsm/gomega"
+	"github.com/bsm/instruments"
+)
+
+var _ = ginkgo.Describe("entry", func() {
+	roundtrip := func(dist instruments.Distribution) instruments.Distribution {
+		data, err := appendEntry(nil, &entry{Name: "tmr", Dist: dist})
+		Expect(err).NotTo(HaveOccurred())
+
+		entries, err := decodeEntries(data)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(entries).To(HaveLen(1))
+		return entries[0].Dist
+	}
+
+	ginkgo.It("should preserve distribution types", func() {
+		sketch := instruments.NewSketch(0.01)
+		hist := instruments.NewHistogram(instruments.LinearBuckets(100, 100, 10))
+		exp := instruments.NewExpHistogram(0)
+		for i := 1; i <= 1000; i++ {
+			sketch.Update(float64(i))
+			hist.Update(float64(i))
+			exp.Update(float64(i))
+		}
+
+		for _, dist := range []instruments.Distribution{
+			sketch.Snapshot(),
+			hist.Snapshot(),
+			exp.Snapshot(),
+		} {
+			decoded := roundtrip(dist)
+			Expect(decoded).To(BeAssignableToTypeOf(dist))
+			Expect(decoded).To(Equal(dist))
+			Expect(decoded.Quantile(0.99)).To(Equal(dist.Quantile(0.99)))
+		}
+	})
+
+	ginkgo.It("should copy other distributions", func() {
+		res := instruments.NewReservoir()
+		res.Update(4)
+		res.Update(6)
+
+		dist := res.Snapshot()
+		decoded := roundtrip(dist)
+		Expect(decoded).To(Equal(instruments.CopyDistribution(dist)))
+	})
+
+	ginkgo.It("should reject invalid entries", func() {
+		data := appendString([]byte{entrySketch, 0}, "tmr")
+		data = appendUvarint(data, 0)
+		data = appendString(data, "\xff")
+		_, err := decodeEntries(data)
+		Expect(err).To(MatchError(errInvalidCycle))
+
+		data[0] = 99
+		_, err = decodeEntries(data)
+		Expect(err).To(MatchError(errInvalidCycle))
+	})
+})
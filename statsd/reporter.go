@@ -0,0 +1,194 @@
+// Package statsd implements a reporter which emits metrics as StatsD
+// datagrams, using the DogStatsD extension for tags.
+package statsd
+
+import (
+	"math"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/bsm/instruments"
+)
+
+var _ instruments.MetadataReporter = (*Reporter)(nil)
+
+// DefaultMTU is the default maximum datagram size. It is safe for most
+// networks, including those with jumbo frames disabled.
+const DefaultMTU = 1432
+
+// DefaultQuantiles are the quantiles emitted for each distribution.
+var DefaultQuantiles = []float64{0.95, 0.99}
+
+// Reporter implements instruments.Reporter and sends metrics to
+// a StatsD/DogStatsD agent.
+type Reporter struct {
+	// MTU is the maximum datagram size. Multiple metric lines
+	// are packed into a single datagram up to this size.
+	// Default: DefaultMTU
+	MTU int
+
+	// Quantiles are emitted as name.pXX gauges for every distribution.
+	// Default: DefaultQuantiles
+	Quantiles []float64
+
+	// Distributions enables DogStatsD distributions. When enabled, the
+	// bins of each distribution are emitted as |d values, weighted by a
+	// sample rate, instead of quantile gauges. This allows the agent to
+	// aggregate percentiles across hosts.
+	Distributions bool
+
+	conn net.Conn
+	buf  []byte
+	line []byte
+}
+
+// New creates a new reporter, writing to a UDP or a Unix datagram socket.
+// Examples:
+//
+//	statsd.New("udp", "127.0.0.1:8125")
+//	statsd.New("unixgram", "/var/run/datadog/dsd.socket")
+func New(network, addr string) (*Reporter, error) {
+	conn, err := net.Dial(network, addr)
+	if err != nil {
+		return nil, err
+	}
+	return NewConn(conn), nil
+}
+
+// NewConn creates a new reporter using an existing connection.
+func NewConn(conn net.Conn) *Reporter {
+	return &Reporter{
+		MTU:       DefaultMTU,
+		Quantiles: DefaultQuantiles,
+		conn:      conn,
+	}
+}
+
+// Prep implements instruments.Reporter
+func (r *Reporter) Prep() error {
+	r.buf = r.buf[:0]
+	return nil
+}
+
+// Discrete implements instruments.Reporter
+func (r *Reporter) Discrete(name string, tags []string, val float64) error {
+	return r.write(name, tags, val, typeGauge, 1)
+}
+
+// DiscreteWithMetadata implements instruments.MetadataReporter. Counter
+// deltas are emitted as |c counts, all other values as gauges.
+func (r *Reporter) DiscreteWithMetadata(name string, tags []string, meta instruments.Metadata, val float64) error {
+	if meta.Kind == instruments.KindCounter {
+		return r.write(name, tags, val, typeCount, 1)
+	}
+	return r.write(name, tags, val, typeGauge, 1)
+}
+
+// Sample implements instruments.Reporter
+func (r *Reporter) Sample(name string, tags []string, dist instruments.Distribution) error {
+	if r.Distributions {
+		for i, n := 0, dist.NumBins(); i < n; i++ {
+			if v, w := dist.Bin(i); w > 0 {
+				if err := r.write(name, tags, v, typeDistribution, 1/w); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+
+	for _, q := range r.Quantiles {
+		if err := r.write(name+"."+instruments.QuantileSuffix(q), tags, dist.Quantile(q), typeGauge, 1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SampleWithMetadata implements instruments.MetadataReporter
+func (r *Reporter) SampleWithMetadata(name string, tags []string, _ instruments.Metadata, dist instruments.Distribution) error {
+	return r.Sample(name, tags, dist)
+}
+
+// Flush implements instruments.Reporter
+func (r *Reporter) Flush() error {
+	return r.send()
+}
+
+// Close closes the underlying connection.
+func (r *Reporter) Close() error {
+	return r.conn.Close()
+}
+
+func (r *Reporter) write(name string, tags []string, val float64, typ string, rate float64) error {
+	if math.IsNaN(val) || math.IsInf(val, 0) {
+		return nil
+	}
+
+	r.line = appendLine(r.line[:0], name, tags, val, typ, rate)
+
+	if len(r.buf) != 0 && len(r.buf)+1+len(r.line) > r.mtu() {
+		if err := r.send(); err != nil {
+			return err
+		}
+	}
+	if len(r.buf) != 0 {
+		r.buf = append(r.buf, '\n')
+	}
+	r.buf = append(r.buf, r.line...)
+	return nil
+}
+
+func (r *Reporter) send() error {
+	if len(r.buf) == 0 {
+		return nil
+	}
+
+	_, err := r.conn.Write(r.buf)
+	r.buf = r.buf[:0]
+	return err
+}
+
+func (r *Reporter) mtu() int {
+	if r.MTU > 0 {
+		return r.MTU
+	}
+	return DefaultMTU
+}
+
+// --------------------------------------------------------------------
+
+// Metric types.
+const (
+	typeGauge        = "g"
+	typeCount        = "c"
+	typeDistribution = "d"
+)
+
+var (
+	nameEscaper = strings.NewReplacer(":", "_", "|", "_", "@", "_", "\n", "_")
+	tagEscaper  = strings.NewReplacer("|", "_", ",", "_", "\n", "_")
+)
+
+func appendLine(dst []byte, name string, tags []string, val float64, typ string, rate float64) []byte {
+	dst = append(dst, nameEscaper.Replace(name)...)
+	dst = append(dst, ':')
+	dst = strconv.AppendFloat(dst, val, 'f', -1, 64)
+	dst = append(dst, '|')
+	dst = append(dst, typ...)
+	if rate != 1 {
+		dst = append(dst, "|@"...)
+		dst = strconv.AppendFloat(dst, rate, 'g', -1, 64)
+	}
+
+	for i, tag := range tags {
+		if i == 0 {
+			dst = append(dst, "|#"...)
+		} else {
+			dst = append(dst, ',')
+		}
+		dst = append(dst, tagEscaper.Replace(tag)...)
+	}
+	return dst
+}
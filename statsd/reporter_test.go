@@ -0,0 +1,155 @@
+package statsd
+
+import (
+	"math"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/bsm/ginkgo/v2"
+	. "github.com/bsm/gomega"
+	"github.com/bsm/instruments"
+)
+
+var _ = ginkgo.Describe("Reporter", func() {
+	var subject *Reporter
+	var server net.PacketConn
+
+	receive := func() []string {
+		var packets []string
+		buf := make([]byte, 65536)
+		for {
+			_ = server.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+			n, _, err := server.ReadFrom(buf)
+			if err != nil {
+				return packets
+			}
+			packets = append(packets, string(buf[:n]))
+		}
+	}
+
+	ginkgo.BeforeEach(func() {
+		var err error
+		server, err = net.ListenPacket("udp", "127.0.0.1:0")
+		Expect(err).NotTo(HaveOccurred())
+
+		subject, err = New("udp", server.LocalAddr().String())
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	ginkgo.AfterEach(func() {
+		Expect(subject.Close()).To(Succeed())
+		Expect(server.Close()).To(Succeed())
+	})
+
+	ginkgo.It("should support reporter cycle", func() {
+		Expect(subject.Prep()).To(Succeed())
+		Expect(subject.Discrete("cnt", []string{"a:1", "b"}, 3)).To(Succeed())
+		Expect(subject.Discrete("gauge", nil, 0.25)).To(Succeed())
+		Expect(subject.Sample("tmr", []string{"c"}, mockDistribution{})).To(Succeed())
+		Expect(receive()).To(BeEmpty())
+
+		Expect(subject.Flush()).To(Succeed())
+		Expect(receive()).To(Equal([]string{
+			"cnt:3|g|#a:1,b\n" +
+				"gauge:0.25|g\n" +
+				"tmr.p95:100.1|g|#c\n" +
+				"tmr.p99:100.1|g|#c",
+		}))
+	})
+
+	ginkgo.It("should emit metric types", func() {
+		Expect(subject.Prep()).To(Succeed())
+		Expect(subject.DiscreteWithMetadata("cnt", nil, instruments.Metadata{Kind: instruments.KindCounter}, 3)).To(Succeed())
+		Expect(subject.DiscreteWithMetadata("rate", nil, instruments.Metadata{Kind: instruments.KindRate}, 1.5)).To(Succeed())
+		Expect(subject.SampleWithMetadata("tmr", nil, instruments.Metadata{Kind: instruments.KindDistribution}, mockDistribution{})).To(Succeed())
+		Expect(subject.Flush()).To(Succeed())
+
+		Expect(receive()).To(Equal([]string{
+			"cnt:3|c\n" +
+				"rate:1.5|g\n" +
+				"tmr.p95:100.1|g\n" +
+				"tmr.p99:100.1|g",
+		}))
+	})
+
+	ginkgo.It("should emit distributions", func() {
+		res := instruments.NewReservoir()
+		res.Update(1)
+		res.Update(1)
+		res.Update(3)
+
+		subject.Distributions = true
+		Expect(subject.Prep()).To(Succeed())
+		Expect(subject.Sample("tmr", []string{"c"}, res.Snapshot())).To(Succeed())
+		Expect(subject.Flush()).To(Succeed())
+
+		Expect(receive()).To(Equal([]string{
+			"tmr:1|d|@0.5|#c\n" +
+				"tmr:3|d|#c",
+		}))
+	})
+
+	ginkgo.It("should skip non-finite values", func() {
+		Expect(subject.Prep()).To(Succeed())
+		Expect(subject.Discrete("nan", nil, math.NaN())).To(Succeed())
+		Expect(subject.Discrete("inf", nil, math.Inf(-1))).To(Succeed())
+		Expect(subject.Discrete("gauge", nil, 1)).To(Succeed())
+		Expect(subject.Flush()).To(Succeed())
+
+		Expect(receive()).To(Equal([]string{"gauge:1|g"}))
+	})
+
+	ginkgo.It("should pack datagrams up to MTU", func() {
+		subject.MTU = 20
+
+		Expect(subject.Prep()).To(Succeed())
+		Expect(subject.Discrete("metric.a", nil, 1)).To(Succeed())
+		Expect(subject.Discrete("metric.b", nil, 2)).To(Succeed())
+		Expect(subject.Discrete("metric.c", nil, 3)).To(Succeed())
+		Expect(subject.Discrete("metric.long.name", []string{"x:y"}, 4)).To(Succeed())
+		Expect(subject.Flush()).To(Succeed())
+
+		Expect(receive()).To(Equal([]string{
+			"metric.a:1|g",
+			"metric.b:2|g",
+			"metric.c:3|g",
+			"metric.long.name:4|g|#x:y",
+		}))
+
+		subject.MTU = 30
+		Expect(subject.Prep()).To(Succeed())
+		Expect(subject.Discrete("metric.a", nil, 1)).To(Succeed())
+		Expect(subject.Discrete("metric.b", nil, 2)).To(Succeed())
+		Expect(subject.Discrete("metric.c", nil, 3)).To(Succeed())
+		Expect(subject.Flush()).To(Succeed())
+
+		Expect(receive()).To(Equal([]string{
+			"metric.a:1|g\nmetric.b:2|g",
+			"metric.c:3|g",
+		}))
+	})
+
+	ginkgo.It("should escape names and tags", func() {
+		Expect(subject.Prep()).To(Succeed())
+		Expect(subject.Discrete("a:b|c@d", []string{"x|y", "p,q"}, 1e21)).To(Succeed())
+		Expect(subject.Flush()).To(Succeed())
+
+		Expect(receive()).To(Equal([]string{
+			"a_b_c_d:1000000000000000000000|g|#x_y,p_q",
+		}))
+	})
+})
+
+// --------------------------------------------------------------------
+
+func TestSuite(t *testing.T) {
+	RegisterFailHandler(ginkgo.Fail)
+	ginkgo.RunSpecs(t, "instruments/statsd")
+}
+
+type mockDistribution struct {
+	instruments.Distribution
+}
+
+func (mockDistribution) Quantile(_ float64) float64 { return 100.1 }
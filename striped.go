@@ -0,0 +1,112 @@
+package instruments
+
+import (
+	"math"
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+// stripePad pads shards to separate cache lines, accounting
+// for adjacent-line prefetching on modern CPUs.
+const stripePad = 128
+
+// shardSelector assigns shards to processors.
+type shardSelector struct {
+	ids  []int
+	next uint32
+	pool sync.Pool
+}
+
+func (s *shardSelector) init(n int) {
+	s.ids = make([]int, n)
+	for i := range s.ids {
+		s.ids[i] = i
+	}
+}
+
+// acquire returns the shard index for the current processor,
+// which must be released after use.
+func (s *shardSelector) acquire() *int {
+	// sync.Pool caches values per processor, which
+	// keeps goroutines on the same P on the same shard
+	id, _ := s.pool.Get().(*int)
+	if id == nil {
+		n := atomic.AddUint32(&s.next, 1)
+		id = &s.ids[int(n%uint32(len(s.ids)))]
+	}
+	return id
+}
+
+func (s *shardSelector) release(id *int) {
+	s.pool.Put(id)
+}
+
+type counterStripe struct {
+	value uint64
+	_     [stripePad - 8]byte
+}
+
+// StripedCounter is a Counter for hot paths, which spreads updates across
+// padded shards to avoid contention on a single cache line.
+//
+// Updates are applied to a base value until contention is first detected,
+// the counter then switches to shards, which are assigned per processor.
+// Shards are summed up on Snapshot, which is therefore more expensive
+// than Counter.Snapshot. With a single processor there is no contention
+// to avoid, updates cost about the same as Counter.Update while every
+// shard occupies its own cache lines, use Counter instead.
+type StripedCounter struct {
+	base counterStripe
+	updateFlag
+
+	contended uint32
+	stripes   []counterStripe
+	sel       shardSelector
+}
+
+// NewStripedCounter creates a new striped counter
+// with one shard per GOMAXPROCS.
+func NewStripedCounter() *StripedCounter {
+	return NewStripedCounterSize(runtime.GOMAXPROCS(0))
+}
+
+// NewStripedCounterSize creates a new striped counter with n shards.
+func NewStripedCounterSize(n int) *StripedCounter {
+	if n < 1 {
+		n = 1
+	}
+	c := &StripedCounter{stripes: make([]counterStripe, n)}
+	c.sel.init(n)
+	return c
+}
+
+// Update adds v to the counter.
+func (c *StripedCounter) Update(v float64) {
+	c.mark()
+	if atomic.LoadUint32(&c.contended) == 0 {
+		old := atomic.LoadUint64(&c.base.value)
+		if atomic.CompareAndSwapUint64(&c.base.value, old, math.Float64bits(math.Float64frombits(old)+v)) {
+			return
+		}
+		atomic.StoreUint32(&c.contended, 1)
+	}
+
+	id := c.sel.acquire()
+	atomicAddFloat64(&c.stripes[*id].value, v)
+	c.sel.release(id)
+}
+
+// Snapshot returns the current value and reset the counter.
+func (c *StripedCounter) Snapshot() float64 {
+	sum := math.Float64frombits(atomic.SwapUint64(&c.base.value, 0))
+	for i := range c.stripes {
+		sum += math.Float64frombits(atomic.SwapUint64(&c.stripes[i].value, 0))
+	}
+	return sum
+}
+
+// Metadata implements Describer.
+func (c *StripedCounter) Metadata() Metadata {
+	return Metadata{Kind: KindCounter}
+}
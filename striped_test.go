@@ -0,0 +1,52 @@
+package instruments
+
+import (
+	"sync"
+
+	"github.com/bsm/ginkgo/v2"
+	. "github.com/bsm/gomega"
+)
+
+var _ = ginkgo.Describe("StripedCounter", func() {
+	ginkgo.It("should update", func() {
+		c := NewStripedCounterSize(4)
+		c.Update(7)
+		c.Update(12)
+		Expect(c.Snapshot()).To(Equal(19.0))
+		Expect(c.Snapshot()).To(Equal(0.0))
+
+		// switch to shards
+		c.contended = 1
+		for i := 1; i < 100; i++ {
+			c.Update(float64(i))
+		}
+		Expect(c.Snapshot()).To(Equal(4950.0))
+		Expect(c.Snapshot()).To(Equal(0.0))
+		Expect(c.Metadata()).To(Equal(Metadata{Kind: KindCounter}))
+	})
+
+	ginkgo.It("should update atomically", func() {
+		c := NewStripedCounterSize(4)
+
+		var wg sync.WaitGroup
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for j := 0; j < 1000; j++ {
+					c.Update(1)
+				}
+			}()
+		}
+		wg.Wait()
+
+		Expect(c.Snapshot()).To(Equal(8000.0))
+	})
+
+	ginkgo.It("should fetch from registry", func() {
+		r := NewUnstarted("")
+		c := r.StripedCounter("c", nil)
+		Expect(r.StripedCounter("c", nil)).To(BeIdenticalTo(c))
+		Expect(NewStripedCounterSize(0).stripes).To(HaveLen(1))
+	})
+})
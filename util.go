@@ -1,6 +1,8 @@
 package instruments
 
 import (
+	"math"
+	"strconv"
 	"strings"
 	"sync"
 )
@@ -66,6 +68,13 @@ func SplitMetricID(metricID string) (name string, tags []string) {
 	return metricID, nil
 }
 
+// QuantileSuffix returns a name suffix for quantile q,
+// i.e. 0.95 => p95, 0.999 => p999.
+func QuantileSuffix(q float64) string {
+	s := strconv.FormatFloat(math.Round(q*1e4)/1e2, 'f', -1, 64)
+	return "p" + strings.Replace(s, ".", "", 1)
+}
+
 func findMinString(slice []string, greaterThan string) string {
 	min := greaterThan
 	for _, s := range slice {
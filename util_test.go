@@ -33,3 +33,14 @@ var _ = ginkgo.Describe("MetricID", func() {
 		ginkgo.Entry("", "counter", "counter", nil),
 	)
 })
+
+var _ = ginkgo.DescribeTable("QuantileSuffix",
+	func(q float64, exp string) {
+		Expect(QuantileSuffix(q)).To(Equal(exp))
+	},
+
+	ginkgo.Entry("p50", 0.5, "p50"),
+	ginkgo.Entry("p95", 0.95, "p95"),
+	ginkgo.Entry("p99", 0.99, "p99"),
+	ginkgo.Entry("p999", 0.999, "p999"),
+)